@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// defaultPushRecordFile is where a run records the tags it pushes, relative
+// to the working directory.
+const defaultPushRecordFile = ".relicta/gcr-push-{{.Version}}.json"
+
+// pushRecord lists every tag a release pushed together with the digest it
+// pointed to before, so the on_error hook can put the registries back.
+type pushRecord struct {
+	path string
+
+	Version string             `json:"version"`
+	Entries []*pushRecordEntry `json:"entries"`
+}
+
+// pushRecordEntry is one tag moved or created by a release.
+type pushRecordEntry struct {
+	Target     string `json:"target,omitempty"`
+	Region     string `json:"region"`
+	Repository string `json:"repository,omitempty"`
+	Image      string `json:"image"`
+	Tag        string `json:"tag"`
+
+	// Previous is the digest the tag pointed to before the push, empty if
+	// the tag was created.
+	Previous string `json:"previous,omitempty"`
+
+	// Digest is the pushed digest, empty if the push did not complete.
+	Digest string `json:"digest,omitempty"`
+}
+
+// ref returns the tag reference the entry was pushed as.
+func (e *pushRecordEntry) ref(client *GCRClient) string {
+	return fmt.Sprintf("%s:%s", client.GetImagePath(e.Image), e.Tag)
+}
+
+// recordPath returns the push record file of a release.
+func (p *GCRPlugin) recordPath(cfg *Config, ctx *plugin.ReleaseContext) string {
+	return p.processTemplate(cfg.CleanupRecordFile, ctx)
+}
+
+// loadPushRecord reads the push record at path. A missing file is an empty
+// record, so a retried release keeps the digests its first attempt saw. An
+// empty path gives a record that is only kept in memory.
+func loadPushRecord(path, version string) (*pushRecord, error) {
+	record := &pushRecord{path: path, Version: version}
+	if path == "" {
+		return record, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return record, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read push record: %w", err)
+	}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("failed to parse push record %s: %w", path, err)
+	}
+	return record, nil
+}
+
+// track records the digest tag points to before it is pushed. Tags already
+// in the record keep the digest seen by the first attempt.
+func (r *pushRecord) track(ctx context.Context, client *GCRClient, target *Config, region string, image ImageConfig, tag string) (*pushRecordEntry, error) {
+	for _, entry := range r.Entries {
+		if entry.Target == target.Name && entry.Region == region && entry.Repository == image.Repository &&
+			entry.Image == image.Image && entry.Tag == tag {
+			return entry, nil
+		}
+	}
+
+	previous, err := client.Registry().ManifestDigest(ctx, client.RepositoryPath(image.Image), tag)
+	if isNotFound(err) {
+		previous, err = "", nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current digest of %s:%s: %w", client.GetImagePath(image.Image), tag, err)
+	}
+
+	entry := &pushRecordEntry{
+		Target:     target.Name,
+		Region:     region,
+		Repository: image.Repository,
+		Image:      image.Image,
+		Tag:        tag,
+		Previous:   previous,
+	}
+	r.Entries = append(r.Entries, entry)
+	return entry, r.save()
+}
+
+// pushed records the digest a tracked tag was pushed as.
+func (r *pushRecord) pushed(ctx context.Context, client *GCRClient, entry *pushRecordEntry) error {
+	digest, err := client.Registry().ManifestDigest(ctx, client.RepositoryPath(entry.Image), entry.Tag)
+	if err != nil {
+		return fmt.Errorf("failed to read pushed digest of %s: %w", entry.ref(client), err)
+	}
+	entry.Digest = digest
+	return r.save()
+}
+
+// save writes the record atomically so an interrupted run never leaves a
+// truncated file behind.
+func (r *pushRecord) save() error {
+	if r.path == "" {
+		return nil
+	}
+	if err := writeJSONFile(r.path, r); err != nil {
+		return fmt.Errorf("failed to write push record: %w", err)
+	}
+	return nil
+}
+
+// writeJSONFile writes v as indented JSON through a temporary file, creating
+// the directory if needed.
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// remove deletes the record file.
+func (r *pushRecord) remove() error {
+	if r.path == "" {
+		return nil
+	}
+	if err := os.Remove(r.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove push record: %w", err)
+	}
+	return nil
+}
+
+// onSuccess discards the push record of a release that completed.
+func (p *GCRPlugin) onSuccess(req plugin.ExecuteRequest, cfg *Config) (*plugin.ExecuteResponse, error) {
+	if !cfg.CleanupOnError {
+		return &plugin.ExecuteResponse{Success: true, Message: "No cleanup configured"}, nil
+	}
+
+	record := &pushRecord{path: p.recordPath(cfg, &req.Context)}
+	if err := record.remove(); err != nil {
+		return nil, err
+	}
+	return &plugin.ExecuteResponse{Success: true, Message: "Release succeeded; push record discarded"}, nil
+}
+
+// onError deletes the tags a failed release created and moves the tags it
+// changed back to their previous digests. Tags that were moved again since
+// are left alone.
+func (p *GCRPlugin) onError(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, redactor *Redactor) (*plugin.ExecuteResponse, error) {
+	if !cfg.CleanupOnError {
+		return &plugin.ExecuteResponse{Success: true, Message: "No cleanup configured"}, nil
+	}
+
+	record, err := loadPushRecord(p.recordPath(cfg, &req.Context), req.Context.Version)
+	if err != nil {
+		return nil, err
+	}
+	if len(record.Entries) == 0 {
+		return &plugin.ExecuteResponse{Success: true, Message: "Nothing to clean up"}, nil
+	}
+
+	report, err := p.revertRecord(ctx, cfg, record, redactor)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.DryRun {
+		if err := record.remove(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &plugin.ExecuteResponse{
+		Success: true,
+		Message: fmt.Sprintf("Cleaned up %d tag(s) of the failed release", len(report)),
+		Outputs: map[string]any{"cleanup": report},
+	}, nil
+}
+
+// revertRecord puts back every tag in the record, newest first, and reports
+// what was done to each. Every tag is attempted before failures are returned.
+func (p *GCRPlugin) revertRecord(ctx context.Context, cfg *Config, record *pushRecord, redactor *Redactor) ([]map[string]any, error) {
+	targets := make(map[string]*Config)
+	credentials := make(map[string]*CredentialManager)
+	for _, target := range cfg.targets() {
+		if err := resolveSecrets(ctx, target, redactor); err != nil {
+			return nil, err
+		}
+		targets[target.Name] = target
+		credentials[target.Name] = NewCredentialManager(target.authConfig(), "", target.Endpoints)
+	}
+
+	report := []map[string]any{}
+	var failures []string
+	for i := len(record.Entries) - 1; i >= 0; i-- {
+		entry := record.Entries[i]
+		target, ok := targets[entry.Target]
+		if !ok {
+			redactor.Warnf("target '%s' of the push record is no longer configured; leaving %s:%s", entry.Target, entry.Image, entry.Tag)
+			continue
+		}
+
+		config := target.gcrConfig(entry.Region, "", credentials[entry.Target])
+		config.Repository = entry.Repository
+		client := NewGCRClient(config)
+
+		action, err := p.revertTag(ctx, client, entry, target.DryRun)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("  %s: %v", entry.ref(client), err))
+			action = "failed"
+		}
+
+		prefix := ""
+		if target.DryRun {
+			prefix = "[dry-run] "
+		}
+		redactor.Printf("%sReverted: %s %s\n", prefix, action, entry.ref(client))
+		report = append(report, map[string]any{
+			"image":    entry.ref(client),
+			"action":   action,
+			"previous": entry.Previous,
+			"digest":   entry.Digest,
+		})
+	}
+
+	if len(failures) > 0 {
+		return report, fmt.Errorf("failed to revert %d tag(s):\n%s", len(failures), strings.Join(failures, "\n"))
+	}
+	return report, nil
+}
+
+// revertTag puts one recorded tag back and returns what was done: "deleted",
+// "restored", "unchanged" when the tag is already back, or "kept" when it has
+// been moved since this release pushed it.
+func (p *GCRPlugin) revertTag(ctx context.Context, client *GCRClient, entry *pushRecordEntry, dryRun bool) (string, error) {
+	registry := client.Registry()
+	repository := client.RepositoryPath(entry.Image)
+
+	current, err := registry.ManifestDigest(ctx, repository, entry.Tag)
+	if isNotFound(err) {
+		current, err = "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read current digest: %w", err)
+	}
+
+	switch {
+	case current == entry.Previous:
+		return "unchanged", nil
+	case entry.Digest != "" && current != entry.Digest:
+		return "kept", nil
+	case dryRun && entry.Previous == "":
+		return "would delete", nil
+	case dryRun:
+		return "would restore", nil
+	case entry.Previous == "":
+		if err := client.DeleteTag(ctx, entry.Image, entry.Tag); err != nil {
+			return "", fmt.Errorf("failed to delete tag: %w", err)
+		}
+		return "deleted", nil
+	default:
+		if err := registry.CopyManifest(ctx, repository, entry.Previous, repository, entry.Tag); err != nil {
+			return "", fmt.Errorf("failed to restore %s: %w", entry.Previous, err)
+		}
+		return "restored", nil
+	}
+}
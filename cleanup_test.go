@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// cleanupConfig returns a legacy GCR configuration that promotes a staged
+// image and records its pushes in recordFile.
+func cleanupConfig(api *fakeGoogleAPI, registry *fakeRegistry, recordFile string) map[string]any {
+	endpoints := api.EndpointsConfig()
+	endpoints["registry"] = registry.URL
+
+	return map[string]any{
+		"artifact_registry": false,
+		"project":           "my-project",
+		"image":             "my-app",
+		"source_image":      "myapp:latest",
+		"tags":              []any{"{{.Version}}", "latest"},
+		"auth":              map[string]any{"method": "access_token", "access_token": "good-token"},
+		"endpoints":         endpoints,
+		"staging":           map[string]any{"enabled": true},
+		"cleanup":           map[string]any{"on_error": true, "record_file": recordFile},
+	}
+}
+
+func TestOnErrorRevertsPushedTags(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+	recordFile := filepath.Join(t.TempDir(), "push-{{.Version}}.json")
+	recordPath := filepath.Join(filepath.Dir(recordFile), "push-1.2.3.json")
+
+	previous := registry.SeedImage("my-project/my-app", "latest", "old layer")
+	registry.SeedImage("my-project/my-app", "relicta-staging-1.2.3", "new layer")
+
+	p := &GCRPlugin{}
+	release := plugin.ReleaseContext{Version: "1.2.3"}
+	if _, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook:    plugin.HookPostPublish,
+		Config:  cleanupConfig(api, registry, recordFile),
+		Context: release,
+	}); err != nil {
+		t.Fatalf("unexpected publish error: %v", err)
+	}
+
+	record, err := loadPushRecord(recordPath, "1.2.3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(record.Entries) != 2 || record.Entries[0].Previous != "" || record.Entries[1].Previous != previous {
+		data, _ := json.Marshal(record)
+		t.Fatalf("expected created 1.2.3 and moved latest in the record, got %s", data)
+	}
+
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook:    plugin.HookOnError,
+		Config:  cleanupConfig(api, registry, recordFile),
+		Context: release,
+	})
+	if err != nil {
+		t.Fatalf("unexpected cleanup error: %v", err)
+	}
+
+	if got := registry.Digest("my-project/my-app", "latest"); got != previous {
+		t.Errorf("expected latest to be restored to %s, got '%s'", previous, got)
+	}
+	if got := registry.Digest("my-project/my-app", "1.2.3"); got != "" {
+		t.Errorf("expected 1.2.3 to be deleted, got '%s'", got)
+	}
+
+	var actions []string
+	for _, entry := range resp.Outputs["cleanup"].([]map[string]any) {
+		actions = append(actions, entry["action"].(string))
+	}
+	if !reflect.DeepEqual(actions, []string{"restored", "deleted"}) {
+		t.Errorf("expected latest restored and 1.2.3 deleted, got %v", actions)
+	}
+
+	if _, err := os.Stat(recordPath); !os.IsNotExist(err) {
+		t.Errorf("expected the push record to be removed after cleanup, got %v", err)
+	}
+}
+
+func TestRevertTag(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		previous   string
+		pushed     string
+		wantAction string
+	}{
+		{name: "already restored", current: "old", previous: "old", pushed: "new", wantAction: "unchanged"},
+		{name: "moved since", current: "other", previous: "old", pushed: "new", wantAction: "kept"},
+		{name: "created", current: "new", pushed: "new", wantAction: "deleted"},
+		{name: "moved", current: "new", previous: "old", pushed: "new", wantAction: "restored"},
+		{name: "push not confirmed", current: "new", previous: "old", wantAction: "restored"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeGoogleAPI(t)
+			registry := newFakeRegistry(t)
+			digests := map[string]string{"": ""}
+			for _, layer := range []string{"old", "new", "other"} {
+				digests[layer] = registry.SeedImage("my-project/my-app", "", layer)
+			}
+			registry.SeedImage("my-project/my-app", "1.0.0", tt.current)
+
+			endpoints := api.Endpoints()
+			endpoints.Registry = registry.URL
+			client := NewGCRClient(&GCRConfig{
+				Project:     "my-project",
+				Region:      "us",
+				Endpoints:   endpoints,
+				Credentials: NewCredentialManager(&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", endpoints),
+			})
+
+			entry := &pushRecordEntry{Image: "my-app", Tag: "1.0.0", Previous: digests[tt.previous], Digest: digests[tt.pushed]}
+			action, err := (&GCRPlugin{}).revertTag(context.Background(), client, entry, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if action != tt.wantAction {
+				t.Errorf("expected action '%s', got '%s'", tt.wantAction, action)
+			}
+
+			want := map[string]string{
+				"unchanged": digests[tt.current],
+				"kept":      digests[tt.current],
+				"deleted":   "",
+				"restored":  digests[tt.previous],
+			}[tt.wantAction]
+			if got := registry.Digest("my-project/my-app", "1.0.0"); got != want {
+				t.Errorf("expected tag at '%s', got '%s'", want, got)
+			}
+		})
+	}
+}
+
+func TestPushRecordKeepsFirstAttempt(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+	endpoints := api.Endpoints()
+	endpoints.Registry = registry.URL
+	client := NewGCRClient(&GCRConfig{
+		Project:     "my-project",
+		Region:      "us",
+		Endpoints:   endpoints,
+		Credentials: NewCredentialManager(&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", endpoints),
+	})
+
+	path := filepath.Join(t.TempDir(), "record.json")
+	original := registry.SeedImage("my-project/my-app", "latest", "original")
+	image := ImageConfig{Image: "my-app"}
+
+	record, _ := loadPushRecord(path, "1.0.0")
+	if _, err := record.track(context.Background(), client, &Config{}, "us", image, "latest"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A first attempt moved the tag before failing; the retry must still
+	// remember the original digest.
+	registry.SeedImage("my-project/my-app", "latest", "partial")
+	retry, _ := loadPushRecord(path, "1.0.0")
+	entry, err := retry.track(context.Background(), client, &Config{}, "us", image, "latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Previous != original || len(retry.Entries) != 1 {
+		t.Errorf("expected the first attempt's digest %s, got %+v", original, retry.Entries)
+	}
+}
+
+func TestOnSuccessDiscardsPushRecord(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "push-1.2.3.json")
+	if err := os.WriteFile(path, []byte(`{"entries":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookOnSuccess,
+		Config: map[string]any{
+			"cleanup": map[string]any{"on_error": true, "record_file": filepath.Join(dir, "push-{{.Version}}.json")},
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil || !resp.Success {
+		t.Fatalf("unexpected result: %v %+v", err, resp)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the push record to be removed, got %v", err)
+	}
+}
@@ -3,8 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"os/exec"
-	"strings"
 )
 
 // GCRConfig holds GCR client configuration.
@@ -13,89 +11,64 @@ type GCRConfig struct {
 	Region           string
 	Repository       string
 	ArtifactRegistry bool
+	Endpoints        Endpoints
+
+	// DockerConfigDir overrides DOCKER_CONFIG for credential setup.
+	DockerConfigDir string
+
+	// Credentials is shared by every regional client of a run.
+	Credentials *CredentialManager
+}
+
+// Endpoints holds overridable Google API endpoints.
+type Endpoints struct {
+	TokenInfo        string
+	Token            string
+	ArtifactRegistry string
+	Storage          string
+	SecretManager    string
+	IAM              string
+
+	// Registry replaces https://<registry host> for registry API calls.
+	Registry string
 }
 
 // AuthConfig holds authentication configuration.
 type AuthConfig struct {
-	Method  string
-	KeyFile string
-	KeyJSON string
+	Method          string
+	KeyFile         string
+	KeyJSON         string
+	AccessToken     string
+	AccessTokenFile string
+
+	// TokenLogin exchanges service account keys for short-lived access
+	// tokens instead of storing the key in the Docker config.
+	TokenLogin bool
 }
 
 // GCRClient provides GCR/Artifact Registry operations.
 type GCRClient struct {
-	config *GCRConfig
+	config      *GCRConfig
+	credentials *CredentialManager
 }
 
-// NewGCRClient creates a new GCR client.
+// NewGCRClient creates a new GCR client. Clients without a shared credential
+// manager get a private one that authenticates with gcloud.
 func NewGCRClient(config *GCRConfig) *GCRClient {
-	return &GCRClient{
-		config: config,
-	}
-}
-
-// Authenticate authenticates with GCR/Artifact Registry.
-func (c *GCRClient) Authenticate(ctx context.Context, region string, auth *AuthConfig) error {
-	if auth == nil {
-		auth = &AuthConfig{Method: "gcloud"}
+	credentials := config.Credentials
+	if credentials == nil {
+		credentials = NewCredentialManager(nil, config.DockerConfigDir, config.Endpoints)
 	}
 
-	switch auth.Method {
-	case "gcloud", "":
-		return c.authenticateGcloud(ctx, region)
-	case "service_account":
-		return c.authenticateServiceAccount(ctx, region, auth)
-	default:
-		return fmt.Errorf("unknown auth method: %s", auth.Method)
-	}
-}
-
-// authenticateGcloud uses gcloud CLI for authentication.
-func (c *GCRClient) authenticateGcloud(ctx context.Context, region string) error {
-	registryHost := c.getRegistryHost(region)
-
-	cmd := exec.CommandContext(ctx, "gcloud", "auth", "configure-docker", registryHost, "--quiet")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("gcloud auth failed: %w\n%s", err, string(output))
+	return &GCRClient{
+		config:      config,
+		credentials: credentials,
 	}
-
-	return nil
 }
 
-// authenticateServiceAccount uses service account for authentication.
-func (c *GCRClient) authenticateServiceAccount(ctx context.Context, region string, auth *AuthConfig) error {
-	registryHost := c.getRegistryHost(region)
-
-	var keyData string
-	if auth.KeyFile != "" {
-		// Read key from file
-		cmd := exec.CommandContext(ctx, "cat", auth.KeyFile)
-		output, err := cmd.Output()
-		if err != nil {
-			return fmt.Errorf("failed to read key file: %w", err)
-		}
-		keyData = string(output)
-	} else if auth.KeyJSON != "" {
-		keyData = auth.KeyJSON
-	} else {
-		return fmt.Errorf("service account key not provided")
-	}
-
-	// Docker login with service account
-	cmd := exec.CommandContext(ctx, "docker", "login",
-		"-u", "_json_key",
-		"--password-stdin",
-		registryHost,
-	)
-	cmd.Stdin = strings.NewReader(keyData)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("docker login failed: %w\n%s", err, string(output))
-	}
-
-	return nil
+// Authenticate authenticates with the GCR/Artifact Registry host for region.
+func (c *GCRClient) Authenticate(ctx context.Context, region string) error {
+	return c.credentials.Authenticate(ctx, c.getRegistryHost(region))
 }
 
 // getRegistryHost returns the registry host URL.
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenRefreshWindow is how long before expiry a cached token is refreshed.
+const tokenRefreshWindow = 5 * time.Minute
+
+// CredentialManager logs in to each registry host once per run and keeps
+// token-based logins fresh. A single manager is shared by every regional
+// GCRClient so regions that resolve to the same host authenticate only once.
+type CredentialManager struct {
+	auth            *AuthConfig
+	dockerConfigDir string
+	endpoints       Endpoints
+	httpClient      *http.Client
+	now             func() time.Time
+	warnf           func(format string, args ...any)
+
+	mu    sync.Mutex
+	hosts map[string]time.Time
+	token *cachedToken
+}
+
+// cachedToken is an OAuth2 access token with its expiry and the identity it
+// belongs to. A zero expiry means the lifetime of the token is unknown.
+type cachedToken struct {
+	value      string
+	expiry     time.Time
+	email      string
+	shortLived bool
+}
+
+// NewCredentialManager creates a credential manager for the given auth
+// configuration. A nil auth configuration uses gcloud.
+func NewCredentialManager(auth *AuthConfig, dockerConfigDir string, endpoints Endpoints) *CredentialManager {
+	if auth == nil {
+		auth = &AuthConfig{Method: "gcloud"}
+	}
+	if endpoints.TokenInfo == "" {
+		endpoints.TokenInfo = defaultTokenInfoEndpoint
+	}
+	if endpoints.ArtifactRegistry == "" {
+		endpoints.ArtifactRegistry = defaultArtifactRegistryEndpoint
+	}
+	if endpoints.Storage == "" {
+		endpoints.Storage = defaultStorageEndpoint
+	}
+	if endpoints.SecretManager == "" {
+		endpoints.SecretManager = defaultSecretManagerEndpoint
+	}
+	if endpoints.IAM == "" {
+		endpoints.IAM = defaultIAMEndpoint
+	}
+
+	return &CredentialManager{
+		auth:            auth,
+		dockerConfigDir: dockerConfigDir,
+		endpoints:       endpoints,
+		httpClient:      http.DefaultClient,
+		now:             time.Now,
+		warnf:           func(string, ...any) {},
+		hosts:           make(map[string]time.Time),
+	}
+}
+
+// Authenticate logs in to the registry host unless a login that is still
+// valid has already been made during this run.
+func (m *CredentialManager) Authenticate(ctx context.Context, host string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if expiry, ok := m.hosts[host]; ok && !m.expiring(expiry) {
+		return nil
+	}
+
+	var expiry time.Time
+	var err error
+	switch m.auth.Method {
+	case "gcloud", "":
+		err = m.loginGcloud(ctx, host)
+	case "service_account":
+		if m.auth.TokenLogin {
+			expiry, err = m.loginToken(ctx, host)
+		} else {
+			err = m.loginServiceAccount(ctx, host)
+		}
+	case "access_token":
+		expiry, err = m.loginToken(ctx, host)
+	default:
+		err = fmt.Errorf("unknown auth method: %s", m.auth.Method)
+	}
+	if err != nil {
+		return err
+	}
+
+	m.hosts[host] = expiry
+	return nil
+}
+
+// expiring reports whether a credential expiring at expiry must be refreshed.
+func (m *CredentialManager) expiring(expiry time.Time) bool {
+	return !expiry.IsZero() && m.now().Add(tokenRefreshWindow).After(expiry)
+}
+
+// loginGcloud configures gcloud as the Docker credential helper for host.
+// The helper refreshes its own tokens, so the login never expires.
+func (m *CredentialManager) loginGcloud(ctx context.Context, host string) error {
+	cmd := dockerCommand(ctx, m.dockerConfigDir, "gcloud", "auth", "configure-docker", host, "--quiet")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("gcloud auth failed: %w\n%s", err, string(output))
+	}
+
+	return nil
+}
+
+// loginServiceAccount logs in to host with a service account JSON key.
+// Key logins do not expire.
+func (m *CredentialManager) loginServiceAccount(ctx context.Context, host string) error {
+	keyData, err := readServiceAccountKey(m.auth)
+	if err != nil {
+		return err
+	}
+
+	// Docker login with service account
+	cmd := dockerCommand(ctx, m.dockerConfigDir, "docker", "login",
+		"-u", "_json_key",
+		"--password-stdin",
+		host,
+	)
+	cmd.Stdin = bytes.NewReader(keyData)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker login failed: %w\n%s", err, string(output))
+	}
+
+	return nil
+}
+
+// loginToken stores the current access token for host. The token is written
+// straight into the Docker config, so neither gcloud nor docker login is
+// invoked. The returned expiry is the token's expiry.
+func (m *CredentialManager) loginToken(ctx context.Context, host string) (time.Time, error) {
+	token, err := m.accessToken(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	configDir := m.dockerConfigDir
+	if configDir == "" {
+		if configDir, err = dockerConfigDir(); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if err := writeDockerAuth(configDir, host, accessTokenUsername, token.value); err != nil {
+		return time.Time{}, fmt.Errorf("failed to store registry credentials: %w", err)
+	}
+
+	return token.expiry, nil
+}
+
+// Token returns an OAuth2 access token for calling Google APIs with the
+// configured credentials.
+func (m *CredentialManager) Token(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, err := m.accessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token.value, nil
+}
+
+// Identity returns the account the configured credentials act as, or an
+// empty string if it cannot be determined.
+func (m *CredentialManager) Identity(ctx context.Context) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, err := m.accessToken(ctx)
+	if err != nil {
+		return ""
+	}
+	return token.email
+}
+
+// accessToken returns the cached access token, obtaining a new one once it is
+// about to expire. For the access_token method this re-reads the configured
+// token so a rotated token file is picked up mid-run.
+func (m *CredentialManager) accessToken(ctx context.Context) (*cachedToken, error) {
+	if m.token != nil && !m.expiring(m.token.expiry) {
+		return m.token, nil
+	}
+
+	var token *cachedToken
+	var err error
+	switch m.auth.Method {
+	case "access_token":
+		token, err = m.configuredAccessToken(ctx)
+	case "service_account":
+		token, err = m.serviceAccountToken(ctx)
+	case "gcloud", "":
+		token, err = m.gcloudAccessToken(ctx)
+	default:
+		err = fmt.Errorf("unknown auth method: %s", m.auth.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.token = token
+	return token, nil
+}
+
+// configuredAccessToken reads and checks the pre-obtained access token.
+func (m *CredentialManager) configuredAccessToken(ctx context.Context) (*cachedToken, error) {
+	value, err := readAccessToken(m.auth)
+	if err != nil {
+		return nil, err
+	}
+	return m.inspectToken(ctx, value)
+}
+
+// gcloudAccessToken asks gcloud for an access token of the active account.
+func (m *CredentialManager) gcloudAccessToken(ctx context.Context) (*cachedToken, error) {
+	cmd := dockerCommand(ctx, m.dockerConfigDir, "gcloud", "auth", "print-access-token", "--quiet")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gcloud auth print-access-token failed: %w", err)
+	}
+
+	value := strings.TrimSpace(string(output))
+	if value == "" {
+		return nil, fmt.Errorf("gcloud returned an empty access token")
+	}
+	return m.inspectToken(ctx, value)
+}
+
+// serviceAccountToken exchanges the service account key for an access token.
+func (m *CredentialManager) serviceAccountToken(ctx context.Context) (*cachedToken, error) {
+	data, err := readServiceAccountKey(m.auth)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parseServiceAccountKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.exchangeToken(ctx, m.httpClient, m.endpoints.Token, m.now())
+}
+
+// inspectToken checks a token and records its expiry and identity.
+// Tokens that cannot be looked up are accepted with an unknown expiry. A
+// refreshed token that is still valid but close to expiry is used until it
+// expires, since the run has already started pushing with its predecessor.
+func (m *CredentialManager) inspectToken(ctx context.Context, value string) (*cachedToken, error) {
+	info, err := checkAccessToken(ctx, m.httpClient, m.endpoints.TokenInfo, value)
+	var lifetimeErr *tokenLifetimeError
+	shortLived := errors.As(err, &lifetimeErr) && m.token != nil
+	if shortLived {
+		if m.token.value != value || !m.token.shortLived {
+			m.warnf("%v; using it until it expires", err)
+		}
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := &cachedToken{value: value, shortLived: shortLived}
+	if info != nil {
+		token.expiry = m.now().Add(info.ExpiresIn)
+		token.email = info.Email
+	}
+	return token, nil
+}
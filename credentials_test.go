@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readDockerAuths returns the decoded auths entries of a Docker config.
+func readDockerAuths(t *testing.T, configDir string) map[string]string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		t.Fatalf("expected docker config to be written: %v", err)
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	auths := make(map[string]string, len(config.Auths))
+	for host, entry := range config.Auths {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auths[host] = string(decoded)
+	}
+	return auths
+}
+
+func TestAuthenticateAccessToken(t *testing.T) {
+	configDir := t.TempDir()
+	server := newTokenInfoServer(t, "3599")
+
+	credentials := NewCredentialManager(
+		&AuthConfig{Method: "access_token", AccessToken: "good-token"},
+		configDir,
+		Endpoints{TokenInfo: server.URL},
+	)
+	client := NewGCRClient(&GCRConfig{
+		Project:          "my-project",
+		Region:           "us-central1",
+		Repository:       "my-repo",
+		ArtifactRegistry: true,
+		Credentials:      credentials,
+	})
+
+	if err := client.Authenticate(context.Background(), "us-central1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auths := readDockerAuths(t, configDir)
+	if auths["us-central1-docker.pkg.dev"] != "oauth2accesstoken:good-token" {
+		t.Errorf("expected access token login for registry host, got %v", auths)
+	}
+
+	rejected := NewCredentialManager(
+		&AuthConfig{Method: "access_token", AccessToken: "bad-token"},
+		configDir,
+		Endpoints{TokenInfo: server.URL},
+	)
+	if err := rejected.Authenticate(context.Background(), "us-central1-docker.pkg.dev"); err == nil {
+		t.Error("expected error for rejected token")
+	}
+}
+
+func TestCredentialManagerDeduplicatesHosts(t *testing.T) {
+	logPath := installFakeCommands(t)
+
+	credentials := NewCredentialManager(nil, t.TempDir(), Endpoints{})
+
+	// Legacy GCR "us" and unknown regions both resolve to gcr.io.
+	for _, region := range []string{"us", "unknown", "eu", "us"} {
+		client := NewGCRClient(&GCRConfig{
+			Project:     "my-project",
+			Region:      region,
+			Credentials: credentials,
+		})
+		if err := client.Authenticate(context.Background(), region); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	lines := readFakeCommandLog(t, logPath)
+	if len(lines) != 2 {
+		t.Fatalf("expected one login per registry host, got %v", lines)
+	}
+	if !strings.Contains(lines[0], "configure-docker gcr.io ") || !strings.Contains(lines[1], "configure-docker eu.gcr.io ") {
+		t.Errorf("unexpected logins: %v", lines)
+	}
+}
+
+func TestCredentialManagerRefreshesExpiringTokens(t *testing.T) {
+	var lookups atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]string{"expires_in": "3600"})
+	}))
+	defer server.Close()
+
+	configDir := t.TempDir()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	credentials := NewCredentialManager(
+		&AuthConfig{Method: "access_token", AccessTokenFile: tokenFile},
+		configDir,
+		Endpoints{TokenInfo: server.URL},
+	)
+	credentials.now = func() time.Time { return now }
+
+	host := "europe-docker.pkg.dev"
+	if err := credentials.Authenticate(context.Background(), host); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Still well within the token lifetime: cached, no new lookup.
+	now = now.Add(30 * time.Minute)
+	if err := credentials.Authenticate(context.Background(), host); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lookups.Load() != 1 {
+		t.Errorf("expected cached token to be reused, got %d lookups", lookups.Load())
+	}
+
+	// Close to expiry: the rotated token file is re-read and stored again.
+	if err := os.WriteFile(tokenFile, []byte("second-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(27 * time.Minute)
+	if err := credentials.Authenticate(context.Background(), host); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lookups.Load() != 2 {
+		t.Errorf("expected token to be refreshed, got %d lookups", lookups.Load())
+	}
+
+	auths := readDockerAuths(t, configDir)
+	if auths[host] != "oauth2accesstoken:second-token" {
+		t.Errorf("expected refreshed token to be stored, got %v", auths)
+	}
+}
+
+func TestCredentialManagerKeepsShortLivedRefreshedToken(t *testing.T) {
+	var expiresIn atomic.Int32
+	expiresIn.Store(3600)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"expires_in": strconv.Itoa(int(expiresIn.Load()))})
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	credentials := NewCredentialManager(
+		&AuthConfig{Method: "access_token", AccessTokenFile: tokenFile},
+		t.TempDir(),
+		Endpoints{TokenInfo: server.URL},
+	)
+	credentials.now = func() time.Time { return now }
+	var warnings []string
+	credentials.warnf = func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if _, err := credentials.Token(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The token was not rotated: it is still valid for two minutes.
+	now = now.Add(58 * time.Minute)
+	expiresIn.Store(120)
+	for range 2 {
+		token, err := credentials.Token(context.Background())
+		if err != nil {
+			t.Fatalf("expected the still valid token to be used, got %v", err)
+		}
+		if token != "first-token" {
+			t.Errorf("expected first-token, got '%s'", token)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "access token expires in 2m0s") {
+		t.Errorf("expected one expiry warning, got %v", warnings)
+	}
+}
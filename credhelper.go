@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errCredentialsNotFound is the message Docker expects from a helper that has
+// no credentials for a server.
+const errCredentialsNotFound = "credentials not found in native keychain"
+
+// credentialHelperMethodEnv selects the auth method used by the credential
+// helper. When unset, the method is inferred from the credentials in the
+// environment.
+const credentialHelperMethodEnv = "RELICTA_GCR_AUTH_METHOD"
+
+// isCredentialHelperCommand reports whether the binary was invoked as a
+// Docker credential helper rather than as a plugin.
+func isCredentialHelperCommand(args []string) bool {
+	if len(args) != 2 {
+		return false
+	}
+	switch args[1] {
+	case "get", "store", "erase", "list":
+		return true
+	}
+	return false
+}
+
+// credentialHelperConfig builds the plugin configuration used by the
+// credential helper from the same environment variables the plugin reads.
+func (p *GCRPlugin) credentialHelperConfig() *Config {
+	method := os.Getenv(credentialHelperMethodEnv)
+	if method == "" {
+		switch {
+		case os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN") != "", os.Getenv("CLOUDSDK_AUTH_ACCESS_TOKEN_FILE") != "":
+			method = "access_token"
+		case os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") != "", os.Getenv("GCP_SERVICE_ACCOUNT_JSON") != "":
+			method = "service_account"
+		default:
+			method = "gcloud"
+		}
+	}
+
+	return p.parseConfig(map[string]any{
+		"auth": map[string]any{"method": method},
+	})
+}
+
+// runCredentialHelper implements the Docker credential helper protocol. Only
+// "get" returns credentials; the plugin never stores any, so "store" and
+// "erase" succeed without doing anything and "list" is always empty.
+func runCredentialHelper(ctx context.Context, cfg *Config, redactor *Redactor, command string, in io.Reader, out io.Writer) error {
+	switch command {
+	case "get":
+		serverURL, err := io.ReadAll(in)
+		if err != nil {
+			return fmt.Errorf("failed to read server URL: %w", err)
+		}
+		return credentialHelperGet(ctx, cfg, redactor, strings.TrimSpace(string(serverURL)), out)
+	case "store", "erase":
+		_, err := io.Copy(io.Discard, in)
+		return err
+	case "list":
+		return json.NewEncoder(out).Encode(map[string]string{})
+	default:
+		return fmt.Errorf("unknown credential helper command: %s", command)
+	}
+}
+
+// credentialHelperGet writes an access token for serverURL using the
+// configured auth method.
+func credentialHelperGet(ctx context.Context, cfg *Config, redactor *Redactor, serverURL string, out io.Writer) error {
+	if !isGoogleRegistryHost(registryHostFromURL(serverURL)) {
+		return errors.New(errCredentialsNotFound)
+	}
+
+	if err := resolveSecrets(ctx, cfg, redactor); err != nil {
+		return err
+	}
+
+	token, err := NewCredentialManager(cfg.authConfig(), "", cfg.Endpoints).Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	return json.NewEncoder(out).Encode(struct {
+		ServerURL string
+		Username  string
+		Secret    string
+	}{
+		ServerURL: serverURL,
+		Username:  accessTokenUsername,
+		Secret:    token,
+	})
+}
+
+// registryHostFromURL strips the scheme and path from a registry server URL.
+func registryHostFromURL(serverURL string) string {
+	host := serverURL
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+// isGoogleRegistryHost reports whether host is served by GCR or Artifact Registry.
+func isGoogleRegistryHost(host string) bool {
+	return host == "gcr.io" ||
+		strings.HasSuffix(host, ".gcr.io") ||
+		strings.HasSuffix(host, "-docker.pkg.dev")
+}
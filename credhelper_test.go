@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestIsCredentialHelperCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected bool
+	}{
+		{args: []string{"plugin-gcr"}, expected: false},
+		{args: []string{"plugin-gcr", "get"}, expected: true},
+		{args: []string{"plugin-gcr", "store"}, expected: true},
+		{args: []string{"plugin-gcr", "erase"}, expected: true},
+		{args: []string{"plugin-gcr", "list"}, expected: true},
+		{args: []string{"plugin-gcr", "serve"}, expected: false},
+		{args: []string{"plugin-gcr", "get", "extra"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			if got := isCredentialHelperCommand(tt.args); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsGoogleRegistryHost(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		expected  bool
+	}{
+		{serverURL: "gcr.io", expected: true},
+		{serverURL: "https://eu.gcr.io", expected: true},
+		{serverURL: "us-central1-docker.pkg.dev", expected: true},
+		{serverURL: "https://europe-docker.pkg.dev/v2/", expected: true},
+		{serverURL: "docker.io", expected: false},
+		{serverURL: "https://index.docker.io/v1/", expected: false},
+		{serverURL: "evilgcr.io", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverURL, func(t *testing.T) {
+			if got := isGoogleRegistryHost(registryHostFromURL(tt.serverURL)); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCredentialHelperConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{name: "defaults to gcloud", expected: "gcloud"},
+		{name: "access token", env: map[string]string{"GOOGLE_OAUTH_ACCESS_TOKEN": "good-token"}, expected: "access_token"},
+		{name: "key file", env: map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": "/path/to/key.json"}, expected: "service_account"},
+		{
+			name: "explicit method wins",
+			env: map[string]string{
+				"GOOGLE_APPLICATION_CREDENTIALS": "/path/to/key.json",
+				credentialHelperMethodEnv:        "gcloud",
+			},
+			expected: "gcloud",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{
+				credentialHelperMethodEnv, "GOOGLE_OAUTH_ACCESS_TOKEN", "CLOUDSDK_AUTH_ACCESS_TOKEN_FILE",
+				"GOOGLE_APPLICATION_CREDENTIALS", "GCP_SERVICE_ACCOUNT_JSON",
+			} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			p := &GCRPlugin{}
+			if method := p.credentialHelperConfig().AuthMethod; method != tt.expected {
+				t.Errorf("expected '%s', got '%s'", tt.expected, method)
+			}
+		})
+	}
+}
+
+func TestRunCredentialHelper(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	key := testServiceAccountKey(t, "my-project")
+
+	tests := []struct {
+		name    string
+		cfg     *Config
+		command string
+		input   string
+		secret  string
+		wantErr string
+	}{
+		{
+			name:    "access token",
+			cfg:     &Config{AuthMethod: "access_token", AccessToken: "good-token"},
+			command: "get",
+			input:   "us-docker.pkg.dev\n",
+			secret:  "good-token",
+		},
+		{
+			name:    "service account",
+			cfg:     &Config{AuthMethod: "service_account", KeyJSON: testServiceAccountKeyJSON(t, key)},
+			command: "get",
+			input:   "https://gcr.io",
+			secret:  "sa-token",
+		},
+		{
+			name:    "gcloud",
+			cfg:     &Config{AuthMethod: "gcloud"},
+			command: "get",
+			input:   "eu.gcr.io",
+			secret:  "good-token",
+		},
+		{
+			name:    "other registry",
+			cfg:     &Config{AuthMethod: "access_token", AccessToken: "good-token"},
+			command: "get",
+			input:   "docker.io",
+			wantErr: errCredentialsNotFound,
+		},
+		{
+			name:    "rejected token",
+			cfg:     &Config{AuthMethod: "access_token", AccessToken: "bad-token"},
+			command: "get",
+			input:   "us-docker.pkg.dev",
+			wantErr: "invalid or expired",
+		},
+		{
+			name:    "store is a no-op",
+			cfg:     &Config{AuthMethod: "gcloud"},
+			command: "store",
+			input:   `{"ServerURL":"gcr.io","Username":"u","Secret":"s"}`,
+		},
+		{
+			name:    "erase is a no-op",
+			cfg:     &Config{AuthMethod: "gcloud"},
+			command: "erase",
+			input:   "gcr.io",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakeCommands(t)
+			tt.cfg.Endpoints = api.Endpoints()
+
+			var out bytes.Buffer
+			err := runCredentialHelper(context.Background(), tt.cfg, NewRedactor(), tt.command, strings.NewReader(tt.input), &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing '%s', got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.secret == "" {
+				if out.Len() != 0 {
+					t.Errorf("expected no output, got '%s'", out.String())
+				}
+				return
+			}
+
+			var creds struct {
+				ServerURL string
+				Username  string
+				Secret    string
+			}
+			if err := json.Unmarshal(out.Bytes(), &creds); err != nil {
+				t.Fatalf("invalid helper output '%s': %v", out.String(), err)
+			}
+			if creds.ServerURL != strings.TrimSpace(tt.input) {
+				t.Errorf("expected server URL '%s', got '%s'", strings.TrimSpace(tt.input), creds.ServerURL)
+			}
+			if creds.Username != accessTokenUsername {
+				t.Errorf("expected username '%s', got '%s'", accessTokenUsername, creds.Username)
+			}
+			if creds.Secret != tt.secret {
+				t.Errorf("expected secret '%s', got '%s'", tt.secret, creds.Secret)
+			}
+		})
+	}
+}
@@ -1,22 +1,34 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
 // DockerClient provides Docker CLI operations.
-type DockerClient struct{}
+type DockerClient struct {
+	configDir string
+}
 
-// NewDockerClient creates a new Docker client.
-func NewDockerClient() *DockerClient {
-	return &DockerClient{}
+// NewDockerClient creates a new Docker client. When configDir is set it is
+// used as DOCKER_CONFIG for every command instead of the user's ~/.docker.
+func NewDockerClient(configDir string) *DockerClient {
+	return &DockerClient{
+		configDir: configDir,
+	}
 }
 
 // Tag tags a Docker image.
 func (d *DockerClient) Tag(ctx context.Context, source, target string) error {
-	cmd := exec.CommandContext(ctx, "docker", "tag", source, target)
+	cmd := dockerCommand(ctx, d.configDir, "docker", "tag", source, target)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("docker tag failed: %w\n%s", err, string(output))
@@ -26,7 +38,7 @@ func (d *DockerClient) Tag(ctx context.Context, source, target string) error {
 
 // Push pushes a Docker image.
 func (d *DockerClient) Push(ctx context.Context, image string) error {
-	cmd := exec.CommandContext(ctx, "docker", "push", image)
+	cmd := dockerCommand(ctx, d.configDir, "docker", "push", image)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("docker push failed: %w\n%s", err, string(output))
@@ -34,12 +46,102 @@ func (d *DockerClient) Push(ctx context.Context, image string) error {
 	return nil
 }
 
-// ImageExists checks if a Docker image exists locally.
+// ImageExists checks if a Docker image exists locally. Failures other than a
+// missing image, such as an unreachable daemon, are returned as errors.
 func (d *DockerClient) ImageExists(ctx context.Context, image string) (bool, error) {
-	cmd := exec.CommandContext(ctx, "docker", "image", "inspect", image)
-	err := cmd.Run()
-	if err != nil {
-		return false, nil
+	cmd := dockerCommand(ctx, d.configDir, "docker", "image", "inspect", image)
+	var stderr bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "No such image") || strings.Contains(stderr.String(), "No such object") {
+			return false, nil
+		}
+		return false, fmt.Errorf("docker image inspect failed: %w\n%s", err, stderr.String())
 	}
 	return true, nil
 }
+
+// dockerCommand builds a command that uses configDir as DOCKER_CONFIG when set.
+// gcloud honours DOCKER_CONFIG too, so it is used for credential setup as well.
+func dockerCommand(ctx context.Context, configDir, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if configDir != "" {
+		cmd.Env = append(os.Environ(), "DOCKER_CONFIG="+configDir)
+	}
+	return cmd
+}
+
+// newDockerConfigDir creates an empty, private Docker config directory.
+func newDockerConfigDir() (string, error) {
+	dir, err := os.MkdirTemp("", "relicta-gcr-docker-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create docker config directory: %w", err)
+	}
+	return dir, nil
+}
+
+// dockerConfigDir returns the Docker CLI configuration directory.
+func dockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate docker config: %w", err)
+	}
+	return filepath.Join(home, ".docker"), nil
+}
+
+// writeDockerAuth stores basic credentials for a registry host in config.json,
+// preserving any other settings already present in the file.
+func writeDockerAuth(configDir, host, username, password string) error {
+	path := filepath.Join(configDir, "config.json")
+
+	config := map[string]any{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	auths, _ := config["auths"].(map[string]any)
+	if auths == nil {
+		auths = map[string]any{}
+	}
+	auths[host] = map[string]any{
+		"auth": base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}
+	config["auths"] = auths
+
+	data, err = json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode docker config: %w", err)
+	}
+
+	if err := os.MkdirAll(configDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", configDir, err)
+	}
+
+	// Write atomically so a concurrent docker command never sees a partial file.
+	tmp, err := os.CreateTemp(configDir, "config.json.*")
+	if err != nil {
+		return fmt.Errorf("failed to write docker config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write docker config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write docker config: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
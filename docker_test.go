@@ -1,12 +1,189 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
+// fakeCommandScript logs every invocation together with the DOCKER_CONFIG it
+// saw, and fails when its first argument matches FAKE_COMMAND_FAIL, echoing
+// FAKE_COMMAND_STDERR as its error output. "gcloud auth print-access-token"
+// prints FAKE_GCLOUD_TOKEN, defaulting to "good-token". "docker image inspect"
+// and "docker manifest inspect" print FAKE_DOCKER_IMAGE and
+// FAKE_DOCKER_MANIFEST, and "docker buildx imagetools inspect" prints
+// FAKE_DOCKER_RAW_MANIFEST as is; when FAKE_DOCKER_PULLED names a file, the
+// image is missing locally until "docker pull" creates that file.
+const fakeCommandScript = `#!/bin/sh
+echo "$(basename "$0") $* DOCKER_CONFIG=$DOCKER_CONFIG" >> "$FAKE_COMMAND_LOG"
+if [ -n "$DOCKER_CONFIG" ] && [ ! -d "$DOCKER_CONFIG" ]; then
+	echo "missing docker config" >&2
+	exit 3
+fi
+if [ "$1" = "$FAKE_COMMAND_FAIL" ]; then
+	echo "$1 failed $FAKE_COMMAND_STDERR" >&2
+	exit 1
+fi
+if [ "$1 $2" = "auth print-access-token" ]; then
+	echo "${FAKE_GCLOUD_TOKEN:-good-token}"
+fi
+if [ "$1 $2" = "image inspect" ]; then
+	if [ -n "$FAKE_DOCKER_PULLED" ] && [ ! -f "$FAKE_DOCKER_PULLED" ]; then
+		echo "Error: No such image: $3" >&2
+		exit 1
+	fi
+	echo "$FAKE_DOCKER_IMAGE"
+fi
+if [ "$1 $2" = "manifest inspect" ]; then
+	echo "$FAKE_DOCKER_MANIFEST"
+fi
+if [ "$1 $2 $3" = "buildx imagetools inspect" ]; then
+	printf '%s' "$FAKE_DOCKER_RAW_MANIFEST"
+fi
+if [ "$1" = "pull" ] && [ -n "$FAKE_DOCKER_PULLED" ]; then
+	touch "$FAKE_DOCKER_PULLED"
+fi
+cat > /dev/null
+exit 0
+`
+
+// installFakeCommands puts fake docker and gcloud binaries first on PATH and
+// returns the path of the invocation log they append to.
+func installFakeCommands(t *testing.T) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands require a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"docker", "gcloud"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(fakeCommandScript), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logPath := filepath.Join(dir, "commands.log")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_COMMAND_LOG", logPath)
+	t.Setenv("FAKE_COMMAND_FAIL", "")
+	t.Setenv("FAKE_COMMAND_STDERR", "")
+	t.Setenv("FAKE_DOCKER_IMAGE", "")
+	t.Setenv("FAKE_DOCKER_MANIFEST", "")
+	t.Setenv("FAKE_DOCKER_RAW_MANIFEST", "")
+	t.Setenv("FAKE_DOCKER_PULLED", "")
+
+	return logPath
+}
+
+// readFakeCommandLog returns the logged fake command invocations.
+func readFakeCommandLog(t *testing.T, logPath string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
 func TestNewDockerClient(t *testing.T) {
-	client := NewDockerClient()
+	client := NewDockerClient("")
 	if client == nil {
 		t.Error("expected client, got nil")
 	}
 }
+
+func TestDockerClientUsesConfigDir(t *testing.T) {
+	logPath := installFakeCommands(t)
+	configDir := t.TempDir()
+
+	client := NewDockerClient(configDir)
+	if err := client.Tag(context.Background(), "myapp:latest", "gcr.io/my-project/my-app:1.0.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := readFakeCommandLog(t, logPath)
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 command, got %v", lines)
+	}
+	if !strings.HasSuffix(lines[0], "DOCKER_CONFIG="+configDir) {
+		t.Errorf("expected DOCKER_CONFIG=%s, got '%s'", configDir, lines[0])
+	}
+}
+
+func TestDockerClientImageExists(t *testing.T) {
+	tests := []struct {
+		name     string
+		missing  bool
+		fail     bool
+		expected bool
+		wantErr  bool
+	}{
+		{name: "present", expected: true},
+		{name: "missing", missing: true},
+		{name: "daemon unreachable", fail: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakeCommands(t)
+			if tt.missing {
+				t.Setenv("FAKE_DOCKER_PULLED", filepath.Join(t.TempDir(), "pulled"))
+			}
+			if tt.fail {
+				t.Setenv("FAKE_COMMAND_FAIL", "image")
+				t.Setenv("FAKE_COMMAND_STDERR", "Cannot connect to the Docker daemon")
+			}
+
+			exists, err := NewDockerClient("").ImageExists(context.Background(), "myapp:latest")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if exists != tt.expected {
+				t.Errorf("expected exists %v, got %v", tt.expected, exists)
+			}
+		})
+	}
+}
+
+func TestWriteDockerAuthPreservesConfig(t *testing.T) {
+	dir := t.TempDir()
+	existing := `{"credHelpers": {"gcr.io": "gcloud"}, "auths": {"ghcr.io": {"auth": "abc"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(existing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeDockerAuth(dir, "us-docker.pkg.dev", "oauth2accesstoken", "token"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := config["credHelpers"]; !ok {
+		t.Error("expected credHelpers to be preserved")
+	}
+
+	auths, _ := config["auths"].(map[string]any)
+	if _, ok := auths["ghcr.io"]; !ok {
+		t.Error("expected existing auth entry to be preserved")
+	}
+	if _, ok := auths["us-docker.pkg.dev"]; !ok {
+		t.Error("expected new auth entry")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// ReleaseFilter selects releases by branch, release type and version. Branch
+// and version patterns are globs in which '*' also matches '/'.
+type ReleaseFilter struct {
+	Branches     []string
+	ReleaseTypes []string
+	Versions     []string
+}
+
+// parseReleaseFilter parses an "only" or "except" block. A missing block is nil.
+func parseReleaseFilter(raw map[string]any) *ReleaseFilter {
+	if raw == nil {
+		return nil
+	}
+	parser := helpers.NewConfigParser(raw)
+	return &ReleaseFilter{
+		Branches:     parser.GetStringSlice("branches", nil),
+		ReleaseTypes: parser.GetStringSlice("release_types", nil),
+		Versions:     parser.GetStringSlice("versions", nil),
+	}
+}
+
+// matchesAll reports whether the release matches every non-empty list.
+func (f *ReleaseFilter) matchesAll(ctx *plugin.ReleaseContext) bool {
+	return (len(f.Branches) == 0 || matchesAnyGlob(f.Branches, ctx.Branch)) &&
+		(len(f.ReleaseTypes) == 0 || matchesReleaseType(f.ReleaseTypes, ctx)) &&
+		(len(f.Versions) == 0 || matchesAnyGlob(f.Versions, strings.TrimPrefix(ctx.Version, "v")))
+}
+
+// matchReason describes the first non-empty list the release matches.
+func (f *ReleaseFilter) matchReason(ctx *plugin.ReleaseContext) string {
+	switch {
+	case len(f.Branches) > 0 && matchesAnyGlob(f.Branches, ctx.Branch):
+		return fmt.Sprintf("branch '%s' is excluded", ctx.Branch)
+	case len(f.ReleaseTypes) > 0 && matchesReleaseType(f.ReleaseTypes, ctx):
+		return fmt.Sprintf("%s release is excluded", describeReleaseType(ctx))
+	case len(f.Versions) > 0 && matchesAnyGlob(f.Versions, strings.TrimPrefix(ctx.Version, "v")):
+		return fmt.Sprintf("version %s is excluded", ctx.Version)
+	}
+	return ""
+}
+
+// skipReason returns why the release is not pushed under the configuration's
+// only/except rules, or an empty string if it is.
+func (c *Config) skipReason(ctx *plugin.ReleaseContext) string {
+	if c.Only != nil && !c.Only.matchesAll(ctx) {
+		return fmt.Sprintf("release (branch '%s', %s, version %s) does not match 'only'",
+			ctx.Branch, describeReleaseType(ctx), ctx.Version)
+	}
+	if c.Except != nil {
+		if reason := c.Except.matchReason(ctx); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// releaseSkipReason returns why the release is not pushed anywhere. With
+// targets, the top-level filters are only defaults and the release is
+// skipped when every target skips it.
+func (c *Config) releaseSkipReason(ctx *plugin.ReleaseContext) string {
+	if len(c.Targets) == 0 {
+		return c.skipReason(ctx)
+	}
+	for _, target := range c.targets() {
+		if target.skipReason(ctx) == "" {
+			return ""
+		}
+	}
+	return "no target matches the release"
+}
+
+// matchesReleaseType reports whether the release has one of types. Versions
+// with a pre-release suffix are "prerelease" in addition to their type.
+func matchesReleaseType(types []string, ctx *plugin.ReleaseContext) bool {
+	for _, t := range types {
+		if strings.EqualFold(t, ctx.ReleaseType) || (t == "prerelease" && isPrerelease(ctx.Version)) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeReleaseType names the release type for skip messages.
+func describeReleaseType(ctx *plugin.ReleaseContext) string {
+	if isPrerelease(ctx.Version) {
+		return "prerelease"
+	}
+	if ctx.ReleaseType == "" {
+		return "untyped"
+	}
+	return ctx.ReleaseType
+}
+
+// isPrerelease reports whether a semantic version has a pre-release suffix.
+func isPrerelease(version string) bool {
+	version, _, _ = strings.Cut(version, "+")
+	return strings.Contains(version, "-")
+}
+
+// matchesAnyGlob reports whether value matches one of the patterns.
+func matchesAnyGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if globPattern(pattern).MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// globPattern compiles a glob in which '*' matches any run of characters and
+// '?' a single character.
+func globPattern(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// skippedResponse is the no-op response for a release excluded by only/except.
+func skippedResponse(reason string) *plugin.ExecuteResponse {
+	return &plugin.ExecuteResponse{
+		Success: true,
+		Message: "Skipped: " + reason,
+		Outputs: map[string]any{
+			"skipped":       true,
+			"skip_reason":   reason,
+			"pushed_images": []string{},
+		},
+	}
+}
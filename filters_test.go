@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]any
+		release  plugin.ReleaseContext
+		wantSkip string
+	}{
+		{
+			name:    "no filters",
+			config:  map[string]any{},
+			release: plugin.ReleaseContext{Branch: "feature/x", Version: "1.0.0"},
+		},
+		{
+			name:    "only branch matches",
+			config:  map[string]any{"only": map[string]any{"branches": []any{"main", "release/*"}}},
+			release: plugin.ReleaseContext{Branch: "release/1.x", Version: "1.0.0"},
+		},
+		{
+			name:     "only branch does not match",
+			config:   map[string]any{"only": map[string]any{"branches": []any{"main"}}},
+			release:  plugin.ReleaseContext{Branch: "feature/x", ReleaseType: "minor", Version: "1.1.0"},
+			wantSkip: "does not match 'only'",
+		},
+		{
+			name:    "glob star crosses slashes",
+			config:  map[string]any{"only": map[string]any{"branches": []any{"hotfix*"}}},
+			release: plugin.ReleaseContext{Branch: "hotfix/urgent/fix", Version: "1.0.1"},
+		},
+		{
+			name: "only requires every list",
+			config: map[string]any{"only": map[string]any{
+				"branches":      []any{"main"},
+				"release_types": []any{"major"},
+			}},
+			release:  plugin.ReleaseContext{Branch: "main", ReleaseType: "patch", Version: "1.0.1"},
+			wantSkip: "does not match 'only'",
+		},
+		{
+			name:    "only version glob ignores v prefix",
+			config:  map[string]any{"only": map[string]any{"versions": []any{"2.*"}}},
+			release: plugin.ReleaseContext{Version: "v2.3.0"},
+		},
+		{
+			name:     "except prerelease",
+			config:   map[string]any{"except": map[string]any{"release_types": []any{"prerelease"}}},
+			release:  plugin.ReleaseContext{Branch: "main", ReleaseType: "minor", Version: "1.1.0-rc.1"},
+			wantSkip: "prerelease release is excluded",
+		},
+		{
+			name:    "build metadata is not a prerelease",
+			config:  map[string]any{"except": map[string]any{"release_types": []any{"prerelease"}}},
+			release: plugin.ReleaseContext{ReleaseType: "patch", Version: "1.0.1+build-7"},
+		},
+		{
+			name:     "except branch",
+			config:   map[string]any{"except": map[string]any{"branches": []any{"hotfix/*"}}},
+			release:  plugin.ReleaseContext{Branch: "hotfix/cve", Version: "1.0.1"},
+			wantSkip: "branch 'hotfix/cve' is excluded",
+		},
+		{
+			name:     "except version",
+			config:   map[string]any{"except": map[string]any{"versions": []any{"0.*"}}},
+			release:  plugin.ReleaseContext{Version: "0.9.0"},
+			wantSkip: "version 0.9.0 is excluded",
+		},
+	}
+
+	p := &GCRPlugin{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := p.parseConfig(tt.config)
+			reason := cfg.skipReason(&tt.release)
+			if tt.wantSkip == "" {
+				if reason != "" {
+					t.Errorf("expected release to be pushed, got skip reason '%s'", reason)
+				}
+				return
+			}
+			if !strings.Contains(reason, tt.wantSkip) {
+				t.Errorf("expected skip reason containing '%s', got '%s'", tt.wantSkip, reason)
+			}
+		})
+	}
+}
+
+func TestValidateReleaseFilters(t *testing.T) {
+	p := &GCRPlugin{}
+	resp, err := p.Validate(context.Background(), map[string]any{
+		"project":      "my-project",
+		"repository":   "my-repo",
+		"image":        "my-app",
+		"source_image": "myapp:latest",
+		"only":         map[string]any{"release_types": []any{"major", "hotfix"}},
+		"except":       map[string]any{"branch": []any{"main"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fields := make([]string, 0, len(resp.Errors))
+	for _, e := range resp.Errors {
+		fields = append(fields, e.Field)
+	}
+	expected := []string{"except.branch", "only.release_types[1]"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected errors on %v, got %v", expected, resp.Errors)
+	}
+}
+
+func TestExecuteSkipsFilteredRelease(t *testing.T) {
+	logPath := installFakeCommands(t)
+
+	p := &GCRPlugin{}
+	for _, hook := range []plugin.Hook{plugin.HookPrePublish, plugin.HookPostPublish} {
+		resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+			Hook: hook,
+			Config: map[string]any{
+				"project":      "my-project",
+				"repository":   "my-repo",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"preflight":    map[string]any{"iam": true},
+				"only":         map[string]any{"branches": []any{"main"}},
+			},
+			Context: plugin.ReleaseContext{Branch: "feature/x", Version: "1.2.3"},
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", hook, err)
+		}
+		if !resp.Success || resp.Outputs["skipped"] != true {
+			t.Errorf("%s: expected a skipped success, got %+v", hook, resp)
+		}
+	}
+
+	if lines := readFakeCommandLog(t, logPath); len(lines) != 0 {
+		t.Errorf("expected no commands for a skipped release, got %v", lines)
+	}
+}
+
+func TestExecuteTargetFilters(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":      "my-project",
+			"repository":   "releases",
+			"region":       "us",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+			"auth":         map[string]any{"method": "access_token", "access_token": "good-token"},
+			"endpoints":    api.EndpointsConfig(),
+			"except":       map[string]any{"branches": []any{"hotfix/*"}},
+			"targets": []any{
+				map[string]any{"name": "releases"},
+				map[string]any{
+					"name":       "hotfixes",
+					"repository": "hotfixes",
+					"only":       map[string]any{"branches": []any{"hotfix/*"}},
+					"except":     map[string]any{},
+				},
+			},
+		},
+		Context: plugin.ReleaseContext{Branch: "hotfix/cve", Version: "1.2.4"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"us-docker.pkg.dev/my-project/hotfixes/my-app:1.2.4"}
+	if pushed := resp.Outputs["pushed_images"]; !reflect.DeepEqual(pushed, expected) {
+		t.Errorf("expected pushed images %v, got %v", expected, pushed)
+	}
+
+	targets, ok := resp.Outputs["targets"].([]map[string]any)
+	if !ok || len(targets) != 2 {
+		t.Fatalf("expected two target results, got %v", resp.Outputs["targets"])
+	}
+	if targets[0]["skipped"] != true || targets[0]["skip_reason"] != "branch 'hotfix/cve' is excluded" {
+		t.Errorf("expected releases target to be skipped, got %v", targets[0])
+	}
+	if _, skipped := targets[1]["skipped"]; skipped {
+		t.Errorf("expected hotfixes target to be pushed, got %v", targets[1])
+	}
+}
+
+func TestReleaseSkipReasonTargets(t *testing.T) {
+	p := &GCRPlugin{}
+	cfg := p.parseConfig(map[string]any{
+		"only": map[string]any{"branches": []any{"main"}},
+		"targets": []any{
+			map[string]any{"name": "main"},
+			map[string]any{"name": "hotfixes", "only": map[string]any{"branches": []any{"hotfix/*"}}},
+		},
+	})
+
+	if reason := cfg.releaseSkipReason(&plugin.ReleaseContext{Branch: "hotfix/cve"}); reason != "" {
+		t.Errorf("expected a release matched by one target to run, got '%s'", reason)
+	}
+	if reason := cfg.releaseSkipReason(&plugin.ReleaseContext{Branch: "feature/x"}); reason != "no target matches the release" {
+		t.Errorf("expected a release matched by no target to be skipped, got '%s'", reason)
+	}
+}
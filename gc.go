@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+)
+
+// defaultGCOlderThan is how old an untagged manifest must be to be collected.
+const defaultGCOlderThan = "30d"
+
+// cosignTagPattern matches the tags cosign stores signatures, attestations
+// and SBOMs of a digest under.
+var cosignTagPattern = regexp.MustCompile(`^sha256-([a-f0-9]{64})\.(sig|att|sbom)$`)
+
+// GCPolicy decides which untagged manifests are collected after a release.
+type GCPolicy struct {
+	Enabled   bool
+	OlderThan string
+}
+
+// parseGCPolicy parses the "garbage_collection" block.
+func parseGCPolicy(raw map[string]any) GCPolicy {
+	parser := helpers.NewConfigParser(raw)
+	return GCPolicy{
+		Enabled:   parser.GetBool("enabled", false),
+		OlderThan: parser.GetString("older_than", "", defaultGCOlderThan),
+	}
+}
+
+// referencingManifest is the part of a manifest that points at other
+// manifests: the children of an index and the subject of a referrer.
+type referencingManifest struct {
+	Manifests []manifestDescriptor `json:"manifests"`
+	Subject   *manifestDescriptor  `json:"subject"`
+}
+
+// isIndex reports whether mediaType is an image index or manifest list.
+func isIndex(mediaType string) bool {
+	return mediaType == manifestMediaTypes[0] || mediaType == manifestMediaTypes[1]
+}
+
+// garbageCandidates returns the untagged manifests of a listing that were
+// uploaded before cutoff and are not needed by another manifest, indexes
+// first so their children are no longer referenced when they are deleted.
+// The children and subject of a kept manifest, the referrers of a kept
+// manifest and images with cosign signature tags are never candidates.
+func garbageCandidates(list *TagList, manifests map[string]referencingManifest, cutoff time.Time) []string {
+	old := make(map[string]bool)
+	for digest, info := range list.Manifests {
+		uploaded := info.TimeUploadedMs
+		if uploaded == "" {
+			uploaded = info.TimeCreatedMs
+		}
+		ms, err := strconv.ParseInt(uploaded, 10, 64)
+		if len(info.Tags) == 0 && err == nil && ms > 0 && time.UnixMilli(ms).Before(cutoff) {
+			old[digest] = true
+		}
+	}
+
+	// Cosign attaches signatures by tag rather than by subject
+	for _, tag := range list.Tags {
+		if m := cosignTagPattern.FindStringSubmatch(tag); m != nil {
+			delete(old, "sha256:"+m[1])
+		}
+	}
+
+	// Anything a kept manifest points at is kept, until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for digest, manifest := range manifests {
+			if old[digest] {
+				continue
+			}
+			for _, child := range manifest.Manifests {
+				if old[child.Digest] {
+					delete(old, child.Digest)
+					changed = true
+				}
+			}
+			if manifest.Subject != nil && old[manifest.Subject.Digest] {
+				delete(old, manifest.Subject.Digest)
+				changed = true
+			}
+		}
+		for digest := range old {
+			subject := manifests[digest].Subject
+			if subject == nil {
+				continue
+			}
+			if _, exists := list.Manifests[subject.Digest]; exists && !old[subject.Digest] {
+				delete(old, digest)
+				changed = true
+			}
+		}
+	}
+
+	candidates := make([]string, 0, len(old))
+	for digest := range old {
+		candidates = append(candidates, digest)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := isIndex(list.Manifests[candidates[i]].MediaType), isIndex(list.Manifests[candidates[j]].MediaType)
+		if a != b {
+			return a
+		}
+		return candidates[i] < candidates[j]
+	})
+	return candidates
+}
+
+// collectGarbage deletes the untagged manifests the policy collects from
+// every image and region of a target and reports each with its size, along
+// with the sum of those sizes. Layers shared between manifests count once per
+// manifest, so the sum is more than the storage freed. Ages are measured
+// from now. On failure, the manifests deleted so far are returned along with
+// the error.
+func (p *GCRPlugin) collectGarbage(ctx context.Context, cfg *Config, credentials *CredentialManager, now time.Time, redactor *Redactor) ([]map[string]any, int64, error) {
+	age, err := parseAge(cfg.GC.OlderThan)
+	if err != nil {
+		return nil, 0, err
+	}
+	cutoff := now.Add(-age)
+
+	collected := []map[string]any{}
+	var deleted int64
+	for _, image := range cfg.images() {
+		for _, region := range cfg.regions() {
+			config := cfg.gcrConfig(region, "", credentials)
+			config.Repository = image.Repository
+			client := NewGCRClient(config)
+			registry := client.Registry()
+			repository := client.RepositoryPath(image.Image)
+			path := client.GetImagePath(image.Image)
+
+			list, err := registry.ListTags(ctx, repository)
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return collected, deleted, fmt.Errorf("failed to list manifests of %s: %w", path, err)
+			}
+
+			// Indexes and untagged manifests are read for the manifests they
+			// point at; tagged images point at nothing that could be collected.
+			manifests := make(map[string]referencingManifest)
+			for digest, info := range list.Manifests {
+				if len(info.Tags) > 0 && !isIndex(info.MediaType) {
+					continue
+				}
+				manifest, err := registry.GetManifest(ctx, repository, digest)
+				if err != nil {
+					return collected, deleted, fmt.Errorf("failed to read %s@%s: %w", path, digest, err)
+				}
+				var content referencingManifest
+				if err := json.Unmarshal(manifest.Data, &content); err != nil {
+					return collected, deleted, fmt.Errorf("failed to parse %s@%s: %w", path, digest, err)
+				}
+				manifests[digest] = content
+			}
+
+			for _, digest := range garbageCandidates(list, manifests, cutoff) {
+				ref := fmt.Sprintf("%s@%s", path, digest)
+				size, _ := strconv.ParseInt(list.Manifests[digest].ImageSizeBytes, 10, 64)
+
+				if cfg.DryRun {
+					redactor.Printf("[dry-run] Would delete untagged %s (%d bytes)\n", ref, size)
+				} else {
+					if err := registry.DeleteManifest(ctx, repository, digest); err != nil {
+						return collected, deleted, fmt.Errorf("failed to delete %s: %w", ref, err)
+					}
+					redactor.Printf("Deleted untagged: %s (%d bytes)\n", ref, size)
+				}
+
+				deleted += size
+				collected = append(collected, map[string]any{
+					"image":      ref,
+					"size_bytes": size,
+				})
+			}
+		}
+	}
+	return collected, deleted, nil
+}
+
+// validateGC checks the garbage collection policy.
+func (p *GCRPlugin) validateGC(vb *helpers.ValidationBuilder, cfg *Config) {
+	if !cfg.GC.Enabled {
+		return
+	}
+	if _, err := parseAge(cfg.GC.OlderThan); err != nil {
+		vb.AddError("garbage_collection.older_than", err.Error())
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+func TestGarbageCandidates(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-30 * 24 * time.Hour)
+	old := now.Add(-60 * 24 * time.Hour).UnixMilli()
+	recent := now.Add(-time.Hour).UnixMilli()
+	info := func(uploaded int64, mediaType string, tags ...string) ManifestInfo {
+		return ManifestInfo{MediaType: mediaType, Tags: tags, TimeUploadedMs: strconv.FormatInt(uploaded, 10)}
+	}
+	const image = "application/vnd.oci.image.manifest.v1+json"
+	const index = "application/vnd.oci.image.index.v1+json"
+	signed := "sha256:" + strings.Repeat("a", 64)
+
+	list := &TagList{
+		Tags: []string{"latest", "multi", "sha256-" + strings.Repeat("a", 64) + ".sig"},
+		Manifests: map[string]ManifestInfo{
+			"sha256:tagged":     info(old, image, "latest"),
+			"sha256:recent":     info(recent, image),
+			"sha256:orphan":     info(old, image),
+			"sha256:at-cutoff":  info(cutoff.UnixMilli(), image),
+			"sha256:before":     info(cutoff.UnixMilli()-1, image),
+			"sha256:unknown":    {MediaType: image},
+			"sha256:multi":      info(old, index, "multi"),
+			"sha256:child":      info(old, image),
+			"sha256:old-index":  info(old, index),
+			"sha256:old-child":  info(old, image),
+			"sha256:signature":  info(old, image),
+			"sha256:stray-sig":  info(old, image),
+			"sha256:stray-base": info(old, image),
+			signed:              info(old, image),
+		},
+	}
+	manifests := map[string]referencingManifest{
+		"sha256:multi":      {Manifests: []manifestDescriptor{{Digest: "sha256:child"}}},
+		"sha256:old-index":  {Manifests: []manifestDescriptor{{Digest: "sha256:old-child"}}},
+		"sha256:signature":  {Subject: &manifestDescriptor{Digest: "sha256:tagged"}},
+		"sha256:stray-sig":  {Subject: &manifestDescriptor{Digest: "sha256:stray-base"}},
+		"sha256:recent":     {},
+		"sha256:orphan":     {},
+		"sha256:at-cutoff":  {},
+		"sha256:before":     {},
+		"sha256:child":      {},
+		"sha256:old-child":  {},
+		"sha256:stray-base": {},
+		signed:              {},
+	}
+
+	// A manifest uploaded exactly at the cutoff is not old enough
+	got := garbageCandidates(list, manifests, cutoff)
+	want := []string{"sha256:old-index", "sha256:before", "sha256:old-child", "sha256:orphan", "sha256:stray-base", "sha256:stray-sig"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestPublishCollectsGarbage(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+	}{
+		{name: "collect"},
+		{name: "dry run", dryRun: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakeCommands(t)
+			api := newFakeGoogleAPI(t)
+			registry := newFakeRegistry(t)
+
+			const repository = "my-project/my-app"
+
+			// latest moves to the new release and leaves this one untagged
+			previous := registry.SeedImage(repository, "latest", "previous")
+			index := registry.SeedIndex(repository, "multi", "amd64", "arm64")
+			release := registry.SeedImage(repository, "1.0.0", "release")
+			signature := registry.SeedReferrer(repository, release, "signature")
+			cosigned := registry.SeedImage(repository, "", "cosigned")
+			registry.SeedImage(repository, "sha256-"+strings.TrimPrefix(cosigned, "sha256:")+".sig", "cosign signature")
+			registry.Backdate(repository, 60*24*time.Hour)
+
+			recent := registry.SeedImage(repository, "", "recent")
+			registry.SeedImage(repository, "relicta-staging-1.2.3", "new")
+
+			config := cleanupConfig(api, registry, "")
+			delete(config, "cleanup")
+			config["dry_run"] = tt.dryRun
+			config["garbage_collection"] = map[string]any{"enabled": true, "older_than": "30d"}
+
+			p := &GCRPlugin{}
+			resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+				Hook:    plugin.HookPostPublish,
+				Config:  config,
+				Context: plugin.ReleaseContext{Version: "1.2.3"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// In dry-run latest does not move, so nothing is untagged yet
+			var want []string
+			if !tt.dryRun {
+				want = []string{"gcr.io/my-project/my-app@" + previous}
+			}
+			var got []string
+			var total int64
+			for _, entry := range resp.Outputs["garbage_collected"].([]map[string]any) {
+				got = append(got, entry["image"].(string))
+				total += entry["size_bytes"].(int64)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected collected %v, got %v", want, got)
+			}
+			if resp.Outputs["deleted_manifest_bytes"] != total || (len(want) > 0 && total == 0) {
+				t.Errorf("expected %d deleted manifest bytes, got %v", total, resp.Outputs["deleted_manifest_bytes"])
+			}
+
+			if registry.HasManifest(repository, previous) == !tt.dryRun {
+				t.Errorf("expected previous manifest deleted=%v", !tt.dryRun)
+			}
+			for _, digest := range []string{recent, index, signature, cosigned} {
+				if !registry.HasManifest(repository, digest) {
+					t.Errorf("expected %s to be kept", digest)
+				}
+			}
+		})
+	}
+}
+
+func TestCollectGarbageUsesClock(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+
+	const repository = "my-project/my-app"
+	registry.SeedImage(repository, "latest", "current")
+	untagged := registry.SeedImage(repository, "", "untagged")
+
+	p := &GCRPlugin{}
+	cfg := p.parseConfig(cleanupConfig(api, registry, ""))
+	cfg.GC = GCPolicy{Enabled: true, OlderThan: "30d"}
+	credentials := NewCredentialManager(cfg.authConfig(), "", cfg.Endpoints)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want int
+	}{
+		{name: "before the manifest is old enough", now: time.Now().Add(29 * 24 * time.Hour)},
+		{name: "after the manifest is old enough", now: time.Now().Add(31 * 24 * time.Hour), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.DryRun = true
+			collected, _, err := p.collectGarbage(context.Background(), cfg, credentials, tt.now, &Redactor{out: &strings.Builder{}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(collected) != tt.want {
+				t.Fatalf("expected %d collected manifest(s), got %v", tt.want, collected)
+			}
+			if tt.want > 0 && collected[0]["image"] != "gcr.io/my-project/my-app@"+untagged {
+				t.Errorf("expected %s to be collected, got %v", untagged, collected[0])
+			}
+		})
+	}
+}
+
+func TestPublishReportsFailedRemoval(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+
+	const repository = "my-project/my-app"
+	registry.SeedImage(repository, "1.0.0", "1.0.0")
+	registry.SeedImage(repository, "1.0.1", "1.0.1")
+	registry.SeedImage(repository, "relicta-staging-1.0.2", "1.0.2")
+
+	// Retention succeeds; garbage collection fails on its age
+	config := cleanupConfig(api, registry, "")
+	delete(config, "cleanup")
+	config["retention"] = map[string]any{"enabled": true, "keep_patches": 1, "keep_minors": 1}
+	config["garbage_collection"] = map[string]any{"enabled": true, "older_than": "monthly"}
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook:    plugin.HookPostPublish,
+		Config:  config,
+		Context: plugin.ReleaseContext{Version: "1.0.2"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "garbage collection failed") {
+		t.Fatalf("expected a garbage collection error, got %v", err)
+	}
+	if resp == nil || resp.Success {
+		t.Fatalf("expected a failed response, got %+v", resp)
+	}
+
+	if pushed, _ := resp.Outputs["pushed_images"].([]string); len(pushed) != 2 {
+		t.Errorf("expected the pushed images in the outputs, got %v", resp.Outputs["pushed_images"])
+	}
+	want := []string{"gcr.io/my-project/my-app:1.0.0", "gcr.io/my-project/my-app:1.0.1"}
+	if !reflect.DeepEqual(resp.Outputs["pruned_tags"], want) {
+		t.Errorf("expected pruned tags %v, got %v", want, resp.Outputs["pruned_tags"])
+	}
+}
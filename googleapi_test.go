@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeGoogleAPI is a stand-in for the Google APIs used by the plugin. It
+// serves /tokeninfo and /token, and tests register further handlers on Mux.
+type fakeGoogleAPI struct {
+	*httptest.Server
+	Mux *http.ServeMux
+}
+
+// newFakeGoogleAPI starts a fake API server. /tokeninfo accepts "good-token"
+// and "sa-token"; /token issues "sa-token" for any JWT bearer assertion.
+func newFakeGoogleAPI(t *testing.T) *fakeGoogleAPI {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tokeninfo", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch r.Form.Get("access_token") {
+		case "good-token", "sa-token":
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"email":      "ci@my-project.iam.gserviceaccount.com",
+				"expires_in": "3599",
+			})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || r.Form.Get("assertion") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "sa-token",
+			"expires_in":   3599,
+			"token_type":   "Bearer",
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &fakeGoogleAPI{Server: server, Mux: mux}
+}
+
+// Endpoints points every API endpoint at the fake server.
+func (f *fakeGoogleAPI) Endpoints() Endpoints {
+	return Endpoints{
+		TokenInfo:        f.URL + "/tokeninfo",
+		Token:            f.URL + "/token",
+		ArtifactRegistry: f.URL,
+		Storage:          f.URL,
+		SecretManager:    f.URL,
+		IAM:              f.URL,
+	}
+}
+
+// EndpointsConfig returns the plugin "endpoints" configuration for the fake server.
+func (f *fakeGoogleAPI) EndpointsConfig() map[string]any {
+	return map[string]any{
+		"tokeninfo":         f.URL + "/tokeninfo",
+		"token":             f.URL + "/token",
+		"artifact_registry": f.URL,
+		"storage":           f.URL,
+		"secret_manager":    f.URL,
+		"iam":               f.URL,
+	}
+}
+
+// requireBearer fails the request unless it carries the expected token.
+func requireBearer(w http.ResponseWriter, r *http.Request, token string) bool {
+	if r.Header.Get("Authorization") != "Bearer "+token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func TestCallAPI(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	api.Mux.HandleFunc("/v1/echo", func(w http.ResponseWriter, r *http.Request) {
+		if !requireBearer(w, r, "good-token") {
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_ = json.NewEncoder(w).Encode(body)
+	})
+	api.Mux.HandleFunc("/v1/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": {"code": 404, "message": "Requested entity was not found."}}`))
+	})
+
+	var out map[string]any
+	err := callAPI(context.Background(), api.Client(), http.MethodPost, api.URL+"/v1/echo", "good-token",
+		map[string]any{"name": "value"}, &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out["name"] != "value" {
+		t.Errorf("expected echoed body, got %v", out)
+	}
+
+	err = callAPI(context.Background(), api.Client(), http.MethodGet, api.URL+"/v1/missing", "good-token", nil, nil)
+	if !isNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "Requested entity was not found.") {
+		t.Errorf("expected API error message, got '%s'", err)
+	}
+
+	err = callAPI(context.Background(), api.Client(), http.MethodPost, api.URL+"/v1/echo", "bad-token", nil, nil)
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 API error, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// artifactRegistryPushPermissions are required to push and move tags in an
+// Artifact Registry repository.
+var artifactRegistryPushPermissions = []string{
+	"artifactregistry.repositories.downloadArtifacts",
+	"artifactregistry.repositories.uploadArtifacts",
+	"artifactregistry.tags.create",
+	"artifactregistry.tags.update",
+}
+
+// gcrPushPermissions are required on the storage bucket backing legacy GCR.
+var gcrPushPermissions = []string{
+	"storage.objects.create",
+	"storage.objects.get",
+	"storage.objects.list",
+}
+
+// PermissionCheck is the result of a pre-flight IAM check for one region.
+type PermissionCheck struct {
+	Region   string
+	Resource string
+	Identity string
+	Missing  []string
+}
+
+// CheckPermissions tests whether the configured credentials may push to the
+// repository (or GCR bucket) of region, without changing anything.
+func (c *GCRClient) CheckPermissions(ctx context.Context, region string) (*PermissionCheck, error) {
+	token, err := c.credentials.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	check := &PermissionCheck{
+		Region:   region,
+		Identity: c.credentials.Identity(ctx),
+	}
+
+	var required, granted []string
+	if c.config.ArtifactRegistry {
+		required = artifactRegistryPushPermissions
+		check.Resource = c.repositoryName(region)
+		granted, err = c.testRepositoryPermissions(ctx, token, check.Resource, required)
+	} else {
+		required = gcrPushPermissions
+		check.Resource = c.gcrBucket(region)
+		granted, err = c.testBucketPermissions(ctx, token, check.Resource, required)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to test permissions on %s: %w", check.Resource, err)
+	}
+
+	has := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		has[permission] = true
+	}
+	for _, permission := range required {
+		if !has[permission] {
+			check.Missing = append(check.Missing, permission)
+		}
+	}
+
+	return check, nil
+}
+
+// repositoryName returns the Artifact Registry resource name for region.
+func (c *GCRClient) repositoryName(region string) string {
+	return fmt.Sprintf("projects/%s/locations/%s/repositories/%s", c.config.Project, region, c.config.Repository)
+}
+
+// gcrBucket returns the Cloud Storage bucket backing legacy GCR for region.
+func (c *GCRClient) gcrBucket(region string) string {
+	host := c.getRegistryHost(region)
+	prefix := strings.TrimSuffix(host, "gcr.io")
+	return fmt.Sprintf("%sartifacts.%s.appspot.com", prefix, c.config.Project)
+}
+
+// testRepositoryPermissions calls testIamPermissions on an Artifact Registry repository.
+func (c *GCRClient) testRepositoryPermissions(ctx context.Context, token, resource string, permissions []string) ([]string, error) {
+	endpoint := fmt.Sprintf("%s/v1/%s:testIamPermissions", c.credentials.endpoints.ArtifactRegistry, resource)
+
+	var resp struct {
+		Permissions []string `json:"permissions"`
+	}
+	err := callAPI(ctx, c.credentials.httpClient, http.MethodPost, endpoint, token,
+		map[string]any{"permissions": permissions}, &resp)
+	return resp.Permissions, err
+}
+
+// testBucketPermissions calls testPermissions on a Cloud Storage bucket.
+func (c *GCRClient) testBucketPermissions(ctx context.Context, token, bucket string, permissions []string) ([]string, error) {
+	query := url.Values{"permissions": permissions}
+	endpoint := fmt.Sprintf("%s/storage/v1/b/%s/iam/testPermissions?%s",
+		c.credentials.endpoints.Storage, url.PathEscape(bucket), query.Encode())
+
+	var resp struct {
+		Permissions []string `json:"permissions"`
+	}
+	err := callAPI(ctx, c.credentials.httpClient, http.MethodGet, endpoint, token, nil, &resp)
+	return resp.Permissions, err
+}
+
+// formatMissingPermissions describes the failed checks, one line per region.
+func formatMissingPermissions(checks []*PermissionCheck) string {
+	var lines []string
+	for _, check := range checks {
+		if len(check.Missing) == 0 {
+			continue
+		}
+		identity := check.Identity
+		if identity == "" {
+			identity = "the configured credentials"
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s): %s lacks %s",
+			check.Region, check.Resource, identity, strings.Join(check.Missing, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// grantPermissions registers testIamPermissions handlers that grant the given
+// permissions on every Artifact Registry repository and GCR bucket.
+func grantPermissions(api *fakeGoogleAPI, token string, granted ...string) {
+	has := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		has[permission] = true
+	}
+
+	filter := func(requested []string) []string {
+		result := []string{}
+		for _, permission := range requested {
+			if has[permission] {
+				result = append(result, permission)
+			}
+		}
+		return result
+	}
+
+	api.Mux.HandleFunc("/v1/projects/", func(w http.ResponseWriter, r *http.Request) {
+		if !requireBearer(w, r, token) || !strings.HasSuffix(r.URL.Path, ":testIamPermissions") {
+			return
+		}
+		var body struct {
+			Permissions []string `json:"permissions"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_ = json.NewEncoder(w).Encode(map[string]any{"permissions": filter(body.Permissions)})
+	})
+	api.Mux.HandleFunc("/storage/v1/b/", func(w http.ResponseWriter, r *http.Request) {
+		if !requireBearer(w, r, token) || !strings.HasSuffix(r.URL.Path, "/iam/testPermissions") {
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"permissions": filter(r.URL.Query()["permissions"])})
+	})
+}
+
+func TestCheckPermissions(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           *GCRConfig
+		region           string
+		granted          []string
+		expectedResource string
+		expectedMissing  []string
+	}{
+		{
+			name: "artifact registry writer",
+			config: &GCRConfig{
+				Project:          "my-project",
+				Repository:       "my-repo",
+				ArtifactRegistry: true,
+			},
+			region:           "us-central1",
+			granted:          artifactRegistryPushPermissions,
+			expectedResource: "projects/my-project/locations/us-central1/repositories/my-repo",
+		},
+		{
+			name: "artifact registry reader",
+			config: &GCRConfig{
+				Project:          "my-project",
+				Repository:       "my-repo",
+				ArtifactRegistry: true,
+			},
+			region:           "europe-west1",
+			granted:          []string{"artifactregistry.repositories.downloadArtifacts"},
+			expectedResource: "projects/my-project/locations/europe-west1/repositories/my-repo",
+			expectedMissing: []string{
+				"artifactregistry.repositories.uploadArtifacts",
+				"artifactregistry.tags.create",
+				"artifactregistry.tags.update",
+			},
+		},
+		{
+			name:             "legacy GCR us bucket",
+			config:           &GCRConfig{Project: "my-project"},
+			region:           "us",
+			granted:          gcrPushPermissions,
+			expectedResource: "artifacts.my-project.appspot.com",
+		},
+		{
+			name:             "legacy GCR eu bucket without create",
+			config:           &GCRConfig{Project: "my-project"},
+			region:           "eu",
+			granted:          []string{"storage.objects.get", "storage.objects.list"},
+			expectedResource: "eu.artifacts.my-project.appspot.com",
+			expectedMissing:  []string{"storage.objects.create"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeGoogleAPI(t)
+			grantPermissions(api, "good-token", tt.granted...)
+
+			tt.config.Credentials = NewCredentialManager(
+				&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", api.Endpoints())
+			client := NewGCRClient(tt.config)
+
+			check, err := client.CheckPermissions(context.Background(), tt.region)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if check.Resource != tt.expectedResource {
+				t.Errorf("expected resource '%s', got '%s'", tt.expectedResource, check.Resource)
+			}
+			if check.Identity != "ci@my-project.iam.gserviceaccount.com" {
+				t.Errorf("expected identity from token info, got '%s'", check.Identity)
+			}
+			if strings.Join(check.Missing, ",") != strings.Join(tt.expectedMissing, ",") {
+				t.Errorf("expected missing %v, got %v", tt.expectedMissing, check.Missing)
+			}
+		})
+	}
+}
+
+func TestCheckPermissionsAPIError(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	api.Mux.HandleFunc("/v1/projects/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	client := NewGCRClient(&GCRConfig{
+		Project:          "my-project",
+		Repository:       "missing-repo",
+		ArtifactRegistry: true,
+		Credentials: NewCredentialManager(
+			&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", api.Endpoints()),
+	})
+
+	if _, err := client.CheckPermissions(context.Background(), "us-central1"); err == nil {
+		t.Error("expected error for missing repository")
+	}
+}
+
+func TestFormatMissingPermissions(t *testing.T) {
+	result := formatMissingPermissions([]*PermissionCheck{
+		{Region: "us-central1", Resource: "projects/p/locations/us-central1/repositories/r"},
+		{
+			Region:   "europe-west1",
+			Resource: "projects/p/locations/europe-west1/repositories/r",
+			Identity: "ci@p.iam.gserviceaccount.com",
+			Missing:  []string{"artifactregistry.repositories.uploadArtifacts"},
+		},
+	})
+
+	expected := "europe-west1 (projects/p/locations/europe-west1/repositories/r): " +
+		"ci@p.iam.gserviceaccount.com lacks artifactregistry.repositories.uploadArtifacts"
+	if result != expected {
+		t.Errorf("expected '%s', got '%s'", expected, result)
+	}
+}
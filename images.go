@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+)
+
+// ImageConfig describes one image to push. Empty fields inherit the
+// top-level settings of the plugin configuration.
+type ImageConfig struct {
+	Image       string
+	SourceImage string
+	Tags        []string
+	Repository  string
+}
+
+// parseImages parses the "images" list. Entries that are not maps are kept
+// as empty entries so validation can report their position.
+func parseImages(raw map[string]any) []ImageConfig {
+	list, ok := raw["images"].([]any)
+	if !ok {
+		return nil
+	}
+
+	images := make([]ImageConfig, 0, len(list))
+	for _, item := range list {
+		entry, _ := item.(map[string]any)
+		parser := helpers.NewConfigParser(entry)
+		images = append(images, ImageConfig{
+			Image:       parser.GetString("image", "", ""),
+			SourceImage: parser.GetString("source_image", "", ""),
+			Tags:        parser.GetStringSlice("tags", nil),
+			Repository:  parser.GetString("repository", "", ""),
+		})
+	}
+	return images
+}
+
+// images returns the images to push with inherited settings filled in. A
+// configuration without an "images" list pushes the top-level image.
+func (c *Config) images() []ImageConfig {
+	if len(c.Images) == 0 {
+		return []ImageConfig{{
+			Image:       c.Image,
+			SourceImage: c.SourceImage,
+			Tags:        c.Tags,
+			Repository:  c.Repository,
+		}}
+	}
+
+	images := make([]ImageConfig, 0, len(c.Images))
+	for _, image := range c.Images {
+		if image.SourceImage == "" {
+			image.SourceImage = c.SourceImage
+		}
+		if len(image.Tags) == 0 {
+			image.Tags = c.Tags
+		}
+		if image.Repository == "" {
+			image.Repository = c.Repository
+		}
+		images = append(images, image)
+	}
+	return images
+}
+
+// repositories returns the distinct repositories the images are pushed to.
+func (c *Config) repositories() []string {
+	seen := make(map[string]bool)
+	var repositories []string
+	for _, image := range c.images() {
+		if !seen[image.Repository] {
+			seen[image.Repository] = true
+			repositories = append(repositories, image.Repository)
+		}
+	}
+	return repositories
+}
+
+// validateImages checks the "images" list entry by entry.
+func (p *GCRPlugin) validateImages(vb *helpers.ValidationBuilder, cfg *Config) {
+	seen := make(map[string]int)
+	for i, image := range cfg.images() {
+		field := fmt.Sprintf("images[%d]", i)
+
+		if image.Image == "" {
+			vb.AddError(field+".image", "image name is required")
+		}
+		// Migrations copy from the registry, not from a local image
+		if image.SourceImage == "" && !cfg.Migration.Enabled {
+			vb.AddError(field+".source_image", "source image is required")
+		}
+
+		if image.Image == "" {
+			continue
+		}
+		key := image.Repository + "/" + image.Image
+		if first, ok := seen[key]; ok {
+			vb.AddError(field+".image", fmt.Sprintf("image '%s' is already pushed by images[%d]", image.Image, first))
+			continue
+		}
+		seen[key] = i
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+func TestConfigImages(t *testing.T) {
+	p := &GCRPlugin{}
+	cfg := p.parseConfig(map[string]any{
+		"project":      "my-project",
+		"repository":   "my-repo",
+		"source_image": "shared:latest",
+		"tags":         []any{"{{.Version}}", "latest"},
+		"images": []any{
+			map[string]any{"image": "api", "source_image": "api:latest"},
+			map[string]any{"image": "worker", "tags": []any{"{{.Version}}"}},
+			map[string]any{"image": "migrator", "source_image": "migrator:latest", "repository": "tools"},
+		},
+	})
+
+	expected := []ImageConfig{
+		{Image: "api", SourceImage: "api:latest", Tags: []string{"{{.Version}}", "latest"}, Repository: "my-repo"},
+		{Image: "worker", SourceImage: "shared:latest", Tags: []string{"{{.Version}}"}, Repository: "my-repo"},
+		{Image: "migrator", SourceImage: "migrator:latest", Tags: []string{"{{.Version}}", "latest"}, Repository: "tools"},
+	}
+	if images := cfg.images(); !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected %+v, got %+v", expected, images)
+	}
+
+	if repositories := cfg.repositories(); !reflect.DeepEqual(repositories, []string{"my-repo", "tools"}) {
+		t.Errorf("expected repositories [my-repo tools], got %v", repositories)
+	}
+}
+
+func TestConfigImagesWithoutList(t *testing.T) {
+	p := &GCRPlugin{}
+	cfg := p.parseConfig(map[string]any{
+		"repository":   "my-repo",
+		"image":        "my-app",
+		"source_image": "myapp:latest",
+	})
+
+	expected := []ImageConfig{
+		{Image: "my-app", SourceImage: "myapp:latest", Tags: []string{"{{.Version}}"}, Repository: "my-repo"},
+	}
+	if images := cfg.images(); !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected %+v, got %+v", expected, images)
+	}
+}
+
+func TestValidateImages(t *testing.T) {
+	tests := []struct {
+		name       string
+		images     []any
+		wantFields []string
+	}{
+		{
+			name: "valid images",
+			images: []any{
+				map[string]any{"image": "api", "source_image": "api:latest"},
+				map[string]any{"image": "worker", "source_image": "worker:latest"},
+			},
+		},
+		{
+			name: "missing fields",
+			images: []any{
+				map[string]any{"image": "api"},
+				map[string]any{"source_image": "worker:latest"},
+			},
+			wantFields: []string{"images[0].source_image", "images[1].image"},
+		},
+		{
+			name: "duplicate image",
+			images: []any{
+				map[string]any{"image": "api", "source_image": "api:latest"},
+				map[string]any{"image": "api", "source_image": "api2:latest"},
+			},
+			wantFields: []string{"images[1].image"},
+		},
+		{
+			name: "same name in another repository",
+			images: []any{
+				map[string]any{"image": "api", "source_image": "api:latest"},
+				map[string]any{"image": "api", "source_image": "api:latest", "repository": "mirror"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &GCRPlugin{}
+			resp, err := p.Validate(context.Background(), map[string]any{
+				"project":    "my-project",
+				"repository": "my-repo",
+				"images":     tt.images,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var fields []string
+			for _, e := range resp.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestExecuteMultipleImages(t *testing.T) {
+	logPath := installFakeCommands(t)
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":    "my-project",
+			"repository": "my-repo",
+			"region":     "us-central1",
+			"tags":       []any{"{{.Version}}"},
+			"images": []any{
+				map[string]any{"image": "api", "source_image": "api:local"},
+				map[string]any{"image": "worker", "source_image": "worker:local", "tags": []any{"{{.Version}}", "latest"}},
+			},
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"us-central1-docker.pkg.dev/my-project/my-repo/api:1.2.3",
+		"us-central1-docker.pkg.dev/my-project/my-repo/worker:1.2.3",
+		"us-central1-docker.pkg.dev/my-project/my-repo/worker:latest",
+	}
+	if pushed := resp.Outputs["pushed_images"]; !reflect.DeepEqual(pushed, expected) {
+		t.Errorf("expected pushed images %v, got %v", expected, pushed)
+	}
+
+	results, ok := resp.Outputs["images"].([]map[string]any)
+	if !ok || len(results) != 2 {
+		t.Fatalf("expected two image results, got %v", resp.Outputs["images"])
+	}
+	if results[1]["image"] != "worker" || len(results[1]["pushed_images"].([]string)) != 2 {
+		t.Errorf("unexpected worker result %v", results[1])
+	}
+
+	tagged := 0
+	for _, line := range readFakeCommandLog(t, logPath) {
+		if strings.HasPrefix(line, "docker tag ") {
+			tagged++
+		}
+	}
+	if tagged != 3 {
+		t.Errorf("expected 3 docker tag calls, got %d", tagged)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultIAMEndpoint is the IAM API used to look up service account keys.
+const defaultIAMEndpoint = "https://iam.googleapis.com"
+
+// KeyAge describes when a service account key was created.
+type KeyAge struct {
+	KeyID   string
+	Created time.Time
+	Age     time.Duration
+}
+
+// Days returns the age of the key in whole days.
+func (a *KeyAge) Days() int {
+	return int(a.Age / (24 * time.Hour))
+}
+
+// KeyAgePolicy holds key rotation thresholds in days. A zero threshold is disabled.
+type KeyAgePolicy struct {
+	WarnDays int
+	MaxDays  int
+}
+
+// Enabled reports whether any threshold is set.
+func (p KeyAgePolicy) Enabled() bool {
+	return p.WarnDays > 0 || p.MaxDays > 0
+}
+
+// Check returns an error for keys past MaxDays and a warning for keys past WarnDays.
+func (p KeyAgePolicy) Check(age *KeyAge) (warning string, err error) {
+	days := age.Days()
+	if p.MaxDays > 0 && days >= p.MaxDays {
+		return "", fmt.Errorf("service account key %s is %d days old, exceeding the maximum of %d days; rotate the key",
+			age.KeyID, days, p.MaxDays)
+	}
+	if p.WarnDays > 0 && days >= p.WarnDays {
+		return fmt.Sprintf("service account key %s is %d days old; rotate it before it reaches the limit", age.KeyID, days), nil
+	}
+	return "", nil
+}
+
+// describe summarizes the age of a key and, with a maximum age, the days
+// left before it is enforced.
+func (p KeyAgePolicy) describe(age *KeyAge) string {
+	description := fmt.Sprintf("Service account key %s is %d day(s) old", age.KeyID, age.Days())
+	if p.MaxDays > 0 {
+		description += fmt.Sprintf(", %d day(s) before key_max_age_days", p.MaxDays-age.Days())
+	}
+	return description
+}
+
+// KeyAge looks up the creation time of the configured service account key
+// through the IAM keys API.
+func (m *CredentialManager) KeyAge(ctx context.Context) (*KeyAge, error) {
+	if m.auth.Method != "service_account" {
+		return nil, fmt.Errorf("key age is only known for service account keys")
+	}
+
+	data, err := readServiceAccountKey(m.auth)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseServiceAccountKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := m.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/serviceAccounts/%s/keys/%s", m.endpoints.IAM,
+		url.PathEscape(key.ProjectID), url.PathEscape(key.ClientEmail), url.PathEscape(key.PrivateKeyID))
+
+	var resp struct {
+		ValidAfterTime string `json:"validAfterTime"`
+	}
+	if err := callAPI(ctx, m.httpClient, http.MethodGet, endpoint, token, nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to look up service account key %s: %w", key.PrivateKeyID, err)
+	}
+
+	created, err := time.Parse(time.RFC3339, resp.ValidAfterTime)
+	if err != nil {
+		return nil, fmt.Errorf("service account key %s has no valid creation time", key.PrivateKeyID)
+	}
+
+	return &KeyAge{
+		KeyID:   key.PrivateKeyID,
+		Created: created,
+		Age:     m.now().Sub(created),
+	}, nil
+}
+
+// checkKeyAge enforces the key rotation thresholds of a service account
+// configuration and returns the key's age for the caller to report. It
+// returns nil when no threshold is set. A key whose age
+// cannot be determined is an error only when a maximum age is enforced.
+func (p *GCRPlugin) checkKeyAge(ctx context.Context, cfg *Config, credentials *CredentialManager, redactor *Redactor) (*KeyAge, error) {
+	policy := cfg.keyAgePolicy()
+	if cfg.AuthMethod != "service_account" || !policy.Enabled() {
+		return nil, nil
+	}
+
+	age, err := credentials.KeyAge(ctx)
+	if err != nil {
+		if policy.MaxDays > 0 {
+			return nil, fmt.Errorf("cannot enforce key_max_age_days: %w", err)
+		}
+		redactor.Warnf("cannot determine service account key age: %v", err)
+		return nil, nil
+	}
+
+	warning, err := policy.Check(age)
+	if err != nil {
+		return nil, err
+	}
+	if warning != "" {
+		redactor.Warnf("%s", warning)
+	}
+
+	return age, nil
+}
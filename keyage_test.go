@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// serveKeyCreated registers the IAM keys API for key, reporting it as
+// created at the given time.
+func serveKeyCreated(api *fakeGoogleAPI, key *ServiceAccountKey, created time.Time) {
+	path := "/v1/projects/" + key.ProjectID + "/serviceAccounts/" + key.ClientEmail + "/keys/" + key.PrivateKeyID
+	api.Mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if !requireBearer(w, r, "sa-token") {
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"name":           strings.TrimPrefix(path, "/v1/"),
+			"validAfterTime": created.UTC().Format(time.RFC3339),
+		})
+	})
+}
+
+func TestKeyAgePolicyCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      KeyAgePolicy
+		days        int
+		wantWarning bool
+		wantErr     bool
+	}{
+		{name: "no thresholds", policy: KeyAgePolicy{}, days: 400},
+		{name: "young key", policy: KeyAgePolicy{WarnDays: 75, MaxDays: 90}, days: 10},
+		{name: "past warning", policy: KeyAgePolicy{WarnDays: 75, MaxDays: 90}, days: 80, wantWarning: true},
+		{name: "past maximum", policy: KeyAgePolicy{WarnDays: 75, MaxDays: 90}, days: 90, wantErr: true},
+		{name: "maximum only", policy: KeyAgePolicy{MaxDays: 90}, days: 89},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			age := &KeyAge{KeyID: "abc", Age: time.Duration(tt.days) * 24 * time.Hour}
+			warning, err := tt.policy.Check(age)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("expected warning %v, got '%s'", tt.wantWarning, warning)
+			}
+		})
+	}
+}
+
+func TestCredentialManagerKeyAge(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	key := testServiceAccountKey(t, "my-project")
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	serveKeyCreated(api, key, now.Add(-100*24*time.Hour))
+
+	credentials := NewCredentialManager(&AuthConfig{
+		Method:  "service_account",
+		KeyJSON: testServiceAccountKeyJSON(t, key),
+	}, "", api.Endpoints())
+	credentials.now = func() time.Time { return now }
+
+	age, err := credentials.KeyAge(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if age.KeyID != key.PrivateKeyID {
+		t.Errorf("expected key ID '%s', got '%s'", key.PrivateKeyID, age.KeyID)
+	}
+	if age.Days() != 100 {
+		t.Errorf("expected 100 days, got %d", age.Days())
+	}
+
+	gcloud := NewCredentialManager(nil, "", api.Endpoints())
+	if _, err := gcloud.KeyAge(context.Background()); err == nil {
+		t.Error("expected error for gcloud credentials")
+	}
+}
+
+func TestValidateKeyAge(t *testing.T) {
+	tests := []struct {
+		name      string
+		age       time.Duration
+		auth      map[string]any
+		wantField string
+	}{
+		{
+			name: "key within limits",
+			age:  10 * 24 * time.Hour,
+			auth: map[string]any{"key_warn_age_days": 75, "key_max_age_days": 90},
+		},
+		{
+			name:      "key too old",
+			age:       120 * 24 * time.Hour,
+			auth:      map[string]any{"key_max_age_days": 90},
+			wantField: "auth.key_max_age_days",
+		},
+		{
+			name:      "warning not below maximum",
+			auth:      map[string]any{"key_warn_age_days": 90, "key_max_age_days": 90},
+			wantField: "auth.key_warn_age_days",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeGoogleAPI(t)
+			key := testServiceAccountKey(t, "my-project")
+			serveKeyCreated(api, key, time.Now().Add(-tt.age))
+
+			auth := map[string]any{
+				"method":   "service_account",
+				"key_json": testServiceAccountKeyJSON(t, key),
+			}
+			for k, v := range tt.auth {
+				auth[k] = v
+			}
+
+			p := &GCRPlugin{}
+			resp, err := p.Validate(context.Background(), map[string]any{
+				"project":      "my-project",
+				"repository":   "my-repo",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"auth":         auth,
+				"endpoints":    api.EndpointsConfig(),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.wantField == "" {
+				if len(resp.Errors) != 0 {
+					t.Errorf("expected no errors, got %v", resp.Errors)
+				}
+				return
+			}
+			if len(resp.Errors) != 1 || resp.Errors[0].Field != tt.wantField {
+				t.Errorf("expected a single '%s' error, got %v", tt.wantField, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestExecuteReportsKeyAge(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	key := testServiceAccountKey(t, "my-project")
+	serveKeyCreated(api, key, time.Now().Add(-30*24*time.Hour-time.Hour))
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":      "my-project",
+			"repository":   "my-repo",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+			"auth": map[string]any{
+				"method":            "service_account",
+				"key_json":          testServiceAccountKeyJSON(t, key),
+				"key_warn_age_days": 75,
+				"key_max_age_days":  90,
+			},
+			"endpoints": api.EndpointsConfig(),
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.Outputs["key_age_days"] != 30 {
+		t.Errorf("expected key_age_days 30, got %v", resp.Outputs["key_age_days"])
+	}
+	if resp.Outputs["key_id"] != key.PrivateKeyID {
+		t.Errorf("expected key_id '%s', got %v", key.PrivateKeyID, resp.Outputs["key_id"])
+	}
+	if resp.Outputs["key_days_left"] != 60 {
+		t.Errorf("expected key_days_left 60, got %v", resp.Outputs["key_days_left"])
+	}
+}
+
+func TestKeyAgePolicyDescribe(t *testing.T) {
+	age := &KeyAge{KeyID: "abc123", Age: 30*24*time.Hour + time.Hour}
+
+	tests := []struct {
+		policy   KeyAgePolicy
+		expected string
+	}{
+		{policy: KeyAgePolicy{WarnDays: 75}, expected: "Service account key abc123 is 30 day(s) old"},
+		{policy: KeyAgePolicy{MaxDays: 90}, expected: "Service account key abc123 is 30 day(s) old, 60 day(s) before key_max_age_days"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.describe(age); got != tt.expected {
+			t.Errorf("expected '%s', got '%s'", tt.expected, got)
+		}
+	}
+}
+
+func TestDryRunSkipsKeyAgeLookup(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	key := testServiceAccountKey(t, "my-project")
+
+	// The IAM keys API is not served: a lookup would fail the release.
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":      "my-project",
+			"repository":   "my-repo",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+			"dry_run":      true,
+			"auth": map[string]any{
+				"method":           "service_account",
+				"key_json":         testServiceAccountKeyJSON(t, key),
+				"key_max_age_days": 90,
+			},
+			"endpoints": api.EndpointsConfig(),
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := resp.Outputs["key_age_days"]; ok {
+		t.Errorf("expected no key age in dry-run, got %v", resp.Outputs)
+	}
+}
+
+func TestValidateTargetKeyAge(t *testing.T) {
+	tests := []struct {
+		name       string
+		targetAuth map[string]any
+		wantFields []string
+	}{
+		{name: "inherited thresholds", targetAuth: map[string]any{}},
+		{name: "stricter maximum", targetAuth: map[string]any{"key_max_age_days": 30}, wantFields: []string{"targets[1].auth.key_max_age_days"}},
+		{
+			name:       "warning not below maximum",
+			targetAuth: map[string]any{"key_warn_age_days": 20, "key_max_age_days": 20},
+			wantFields: []string{"targets[1].auth.key_warn_age_days"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeGoogleAPI(t)
+			key := testServiceAccountKey(t, "my-project")
+			serveKeyCreated(api, key, time.Now().Add(-45*24*time.Hour))
+
+			targetAuth := map[string]any{"method": "service_account", "key_json": testServiceAccountKeyJSON(t, key)}
+			for k, v := range tt.targetAuth {
+				targetAuth[k] = v
+			}
+
+			p := &GCRPlugin{}
+			resp, err := p.Validate(context.Background(), map[string]any{
+				"project":      "my-project",
+				"repository":   "my-repo",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"auth":         map[string]any{"method": "gcloud", "key_max_age_days": 90},
+				"endpoints":    api.EndpointsConfig(),
+				"targets": []any{
+					map[string]any{"name": "prod"},
+					map[string]any{"name": "partner", "auth": targetAuth},
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var fields []string
+			for _, e := range resp.Errors {
+				fields = append(fields, e.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, resp.Errors)
+			}
+		})
+	}
+}
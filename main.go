@@ -1,9 +1,39 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+
 	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
 )
 
 func main() {
+	if len(os.Args) == 2 && os.Args[1] == "schema" {
+		fmt.Fprint(os.Stdout, configSchema)
+		return
+	}
+
+	if len(os.Args) == 3 && os.Args[1] == "migrate" {
+		if err := runMigrationCommand(context.Background(), os.Args[2], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if isCredentialHelperCommand(os.Args) {
+		p := &GCRPlugin{}
+		cfg := p.credentialHelperConfig()
+		redactor := newConfigRedactor(cfg)
+
+		if err := runCredentialHelper(context.Background(), cfg, redactor, os.Args[1], os.Stdin, os.Stdout); err != nil {
+			// Docker reads helper errors from stdout.
+			fmt.Fprintln(os.Stdout, redactor.Error(err))
+			os.Exit(1)
+		}
+		return
+	}
+
 	plugin.Serve(&GCRPlugin{})
 }
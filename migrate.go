@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// defaultMigrationStateFile records the progress of a migration, relative to
+// the working directory.
+const defaultMigrationStateFile = ".relicta/gcr-migration.json"
+
+// MigrationConfig describes the Artifact Registry repository legacy GCR
+// images are migrated to.
+type MigrationConfig struct {
+	Enabled    bool
+	Project    string
+	Region     string
+	Repository string
+	StateFile  string
+}
+
+// parseMigrationConfig parses the "migrate" block. The project defaults to
+// the GCR project and the region to the multi-region matching the GCR host.
+func parseMigrationConfig(raw map[string]any, project, gcrRegion string) MigrationConfig {
+	parser := helpers.NewConfigParser(raw)
+	return MigrationConfig{
+		Enabled:    parser.GetBool("enabled", false),
+		Project:    parser.GetString("project", "", project),
+		Region:     parser.GetString("region", "", migrationRegion(gcrRegion)),
+		Repository: parser.GetString("repository", "", ""),
+		StateFile:  parser.GetString("state_file", "", defaultMigrationStateFile),
+	}
+}
+
+// migrationRegion returns the Artifact Registry multi-region that replaces a
+// legacy GCR region.
+func migrationRegion(gcrRegion string) string {
+	switch gcrRegion {
+	case "eu", "europe":
+		return "europe"
+	case "asia":
+		return "asia"
+	default:
+		return "us"
+	}
+}
+
+// migrationState records every reference a migration has copied and
+// verified, so an interrupted migration resumes where it stopped.
+type migrationState struct {
+	path string
+
+	Source  string                     `json:"source"`
+	Target  string                     `json:"target"`
+	Entries map[string]*migrationEntry `json:"entries"`
+}
+
+// migrationEntry maps one source reference to its copy.
+type migrationEntry struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Digest string `json:"digest"`
+}
+
+// loadMigrationState reads the state at path. A missing file starts a new
+// migration; a file written for another source or target is refused.
+func loadMigrationState(path, source, target string) (*migrationState, error) {
+	state := &migrationState{path: path, Source: source, Target: target, Entries: map[string]*migrationEntry{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse migration state %s: %w", path, err)
+	}
+	if state.Source != source || state.Target != target {
+		return nil, fmt.Errorf("migration state %s is for %s to %s; remove it or set migrate.state_file", path, state.Source, state.Target)
+	}
+	if state.Entries == nil {
+		state.Entries = map[string]*migrationEntry{}
+	}
+	return state, nil
+}
+
+// done reports whether source was already migrated at digest.
+func (s *migrationState) done(source, digest string) bool {
+	entry, ok := s.Entries[source]
+	return ok && entry.Digest == digest
+}
+
+// record saves a verified reference.
+func (s *migrationState) record(entry *migrationEntry) error {
+	s.Entries[entry.Source] = entry
+	if err := writeJSONFile(s.path, s); err != nil {
+		return fmt.Errorf("failed to write migration state: %w", err)
+	}
+	return nil
+}
+
+// migrationTarget returns the Artifact Registry configuration images are
+// migrated to.
+func (c *Config) migrationTarget() *Config {
+	target := *c
+	target.ArtifactRegistry = true
+	target.Project = c.Migration.Project
+	target.Region = c.Migration.Region
+	target.regionSet = true
+	target.Repository = c.Migration.Repository
+	target.MultiRegionEnabled = false
+	target.Images = nil
+	return &target
+}
+
+// migrate copies every tag of the configured images from legacy GCR to
+// Artifact Registry, together with their untagged manifests such as
+// signatures attached by digest, and verifies each copy by digest.
+func (p *GCRPlugin) migrate(ctx context.Context, cfg *Config, redactor *Redactor) (*plugin.ExecuteResponse, error) {
+	if err := resolveSecrets(ctx, cfg, redactor); err != nil {
+		return nil, err
+	}
+	credentials := NewCredentialManager(cfg.authConfig(), "", cfg.Endpoints)
+	credentials.warnf = redactor.Warnf
+	target := cfg.migrationTarget()
+
+	sourceClient := NewGCRClient(cfg.gcrConfig(cfg.Region, "", credentials))
+	targetClient := NewGCRClient(target.gcrConfig(target.Region, "", credentials))
+	source := fmt.Sprintf("%s/%s", sourceClient.GetRegistryHost(), cfg.Project)
+	destination := fmt.Sprintf("%s/%s/%s", targetClient.GetRegistryHost(), target.Project, target.Repository)
+
+	if _, err := p.ensureRepositories(ctx, target, []string{target.Repository}, nil, credentials, redactor); err != nil {
+		return nil, err
+	}
+
+	state, err := loadMigrationState(cfg.Migration.StateFile, source, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	report := []map[string]any{}
+	copied := 0
+	for _, image := range cfg.images() {
+		results, err := p.migrateImage(ctx, cfg, sourceClient, targetClient, image.Image, state, redactor)
+		report = append(report, results...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range report {
+		if entry["status"] == "copied" {
+			copied++
+		}
+	}
+
+	message := fmt.Sprintf("Migrated %d reference(s) from %s to %s", copied, source, destination)
+	if cfg.DryRun {
+		message = fmt.Sprintf("Would migrate %d reference(s) from %s to %s", len(report), source, destination)
+	}
+	return &plugin.ExecuteResponse{
+		Success: true,
+		Message: message,
+		Outputs: map[string]any{
+			"migration":  report,
+			"state_file": cfg.Migration.StateFile,
+		},
+	}, nil
+}
+
+// migrateImage migrates the tags, referrers and other untagged manifests of
+// one image.
+func (p *GCRPlugin) migrateImage(ctx context.Context, cfg *Config, sourceClient, targetClient *GCRClient, image string, state *migrationState, redactor *Redactor) ([]map[string]any, error) {
+	sourceRegistry, targetRegistry := sourceClient.Registry(), targetClient.Registry()
+	from, to := sourceClient.RepositoryPath(image), targetClient.RepositoryPath(image)
+	sourcePath, targetPath := sourceClient.GetImagePath(image), targetClient.GetImagePath(image)
+
+	list, err := sourceRegistry.ListTags(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", sourcePath, err)
+	}
+	digests, err := sourceRegistry.TagDigests(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	type reference struct{ name, digest, separator string }
+	var references []reference
+	sort.Strings(list.Tags)
+	for _, tag := range list.Tags {
+		references = append(references, reference{tag, digests[tag], ":"})
+	}
+
+	// Indexes are read for their children, which are copied along with them,
+	// and untagged manifests for their subject.
+	contents := make(map[string]referencingManifest)
+	for digest, info := range list.Manifests {
+		if len(info.Tags) > 0 && !isIndex(info.MediaType) {
+			continue
+		}
+		manifest, err := sourceRegistry.GetManifest(ctx, from, digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s@%s: %w", sourcePath, digest, err)
+		}
+		var content referencingManifest
+		if err := json.Unmarshal(manifest.Data, &content); err != nil {
+			return nil, fmt.Errorf("failed to parse %s@%s: %w", sourcePath, digest, err)
+		}
+		contents[digest] = content
+	}
+	children := make(map[string]bool)
+	for _, content := range contents {
+		for _, child := range content.Manifests {
+			children[child.Digest] = true
+		}
+	}
+
+	// Every other untagged manifest is copied by digest, referrers last so
+	// their subject is already there.
+	var untagged, referrers []reference
+	for digest, info := range list.Manifests {
+		if len(info.Tags) > 0 || children[digest] {
+			continue
+		}
+		if contents[digest].Subject != nil {
+			referrers = append(referrers, reference{digest, digest, "@"})
+		} else {
+			untagged = append(untagged, reference{digest, digest, "@"})
+		}
+	}
+	for _, group := range [][]reference{untagged, referrers} {
+		sort.Slice(group, func(i, j int) bool { return group[i].digest < group[j].digest })
+		references = append(references, group...)
+	}
+
+	results := []map[string]any{}
+	for _, ref := range references {
+		entry := &migrationEntry{
+			Source: sourcePath + ref.separator + ref.name,
+			Target: targetPath + ref.separator + ref.name,
+			Digest: ref.digest,
+		}
+		status, err := p.migrateReference(ctx, cfg, sourceRegistry, from, targetRegistry, to, ref.name, entry, state, redactor)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, map[string]any{
+			"source": entry.Source,
+			"target": entry.Target,
+			"digest": entry.Digest,
+			"status": status,
+		})
+	}
+	return results, nil
+}
+
+// migrateReference copies and verifies one tag or untagged digest and
+// returns "copied", "migrated" when an earlier run already did, or
+// "would copy" in dry-run.
+func (p *GCRPlugin) migrateReference(ctx context.Context, cfg *Config, source *RegistryClient, from string, target *RegistryClient, to, name string, entry *migrationEntry, state *migrationState, redactor *Redactor) (string, error) {
+	if state.done(entry.Source, entry.Digest) {
+		current, err := target.ManifestDigest(ctx, to, name)
+		if err == nil && current == entry.Digest {
+			return "migrated", nil
+		}
+	}
+
+	if cfg.DryRun {
+		redactor.Printf("[dry-run] Would copy %s to %s\n", entry.Source, entry.Target)
+		return "would copy", nil
+	}
+
+	if err := source.CopyManifestTo(ctx, from, entry.Digest, target, to, name); err != nil {
+		return "", fmt.Errorf("failed to copy %s: %w", entry.Source, err)
+	}
+	current, err := target.ManifestDigest(ctx, to, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify %s: %w", entry.Target, err)
+	}
+	if current != entry.Digest {
+		return "", fmt.Errorf("verification of %s failed: digest %s, expected %s", entry.Target, current, entry.Digest)
+	}
+	if err := state.record(entry); err != nil {
+		return "", err
+	}
+
+	redactor.Printf("Migrated: %s -> %s (%s)\n", entry.Source, entry.Target, entry.Digest)
+	return "copied", nil
+}
+
+// validateMigration checks the migration source and target.
+func (p *GCRPlugin) validateMigration(vb *helpers.ValidationBuilder, cfg *Config) {
+	if !cfg.Migration.Enabled {
+		return
+	}
+
+	if cfg.ArtifactRegistry {
+		vb.AddError("artifact_registry", "migrate copies from legacy GCR; set artifact_registry to false and configure the GCR project and region")
+	}
+	if len(cfg.Targets) > 0 {
+		vb.AddError("targets", "migrate does not support targets")
+	}
+	if cfg.MultiRegionEnabled {
+		vb.AddError("multi_region", "migrate copies from one GCR region; set region instead")
+	}
+
+	if cfg.Migration.Repository == "" {
+		vb.AddError("migrate.repository", "Artifact Registry repository to migrate to is required")
+	} else if err := checkRepositoryName(cfg.Migration.Repository); err != nil {
+		vb.AddError("migrate.repository", err.Error())
+	}
+	if cfg.Migration.Project != "" {
+		if err := checkProjectID(cfg.Migration.Project); err != nil {
+			vb.AddError("migrate.project", err.Error())
+		}
+	}
+	if err := checkRegion(cfg.Migration.Region, true); err != nil {
+		vb.AddError("migrate.region", err.Error())
+	}
+}
+
+// runMigrationCommand runs the migration described by the JSON configuration
+// file at path, for "plugin-gcr migrate <config.json>".
+func runMigrationCommand(ctx context.Context, path string, out io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("failed to parse configuration %s: %w", path, err)
+	}
+	migrate, _ := raw["migrate"].(map[string]any)
+	if migrate == nil {
+		migrate = map[string]any{}
+	}
+	migrate["enabled"] = true
+	raw["migrate"] = migrate
+
+	p := &GCRPlugin{}
+	validation, err := p.Validate(ctx, raw)
+	if err != nil {
+		return err
+	}
+	if !validation.Valid {
+		var lines []string
+		for _, e := range validation.Errors {
+			lines = append(lines, fmt.Sprintf("  %s: %s", e.Field, e.Message))
+		}
+		return fmt.Errorf("invalid configuration:\n%s", strings.Join(lines, "\n"))
+	}
+
+	resp, err := p.Execute(ctx, plugin.ExecuteRequest{Hook: plugin.HookPostPublish, Config: raw})
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+	fmt.Fprintln(out, resp.Message)
+	return nil
+}
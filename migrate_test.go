@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// migrationConfig returns a legacy GCR configuration that migrates my-app to
+// the containers repository, with progress kept in stateFile.
+func migrationConfig(api *fakeGoogleAPI, registry *fakeRegistry, stateFile string) map[string]any {
+	endpoints := api.EndpointsConfig()
+	endpoints["registry"] = registry.URL
+
+	return map[string]any{
+		"artifact_registry": false,
+		"project":           "my-project",
+		"image":             "my-app",
+		"auth":              map[string]any{"method": "access_token", "access_token": "good-token"},
+		"endpoints":         endpoints,
+		"migrate":           map[string]any{"enabled": true, "repository": "containers", "state_file": stateFile},
+	}
+}
+
+// migrationStatuses maps each migrated source reference to its status.
+func migrationStatuses(t *testing.T, resp *plugin.ExecuteResponse) map[string]string {
+	t.Helper()
+	statuses := map[string]string{}
+	for _, entry := range resp.Outputs["migration"].([]map[string]any) {
+		statuses[strings.TrimPrefix(entry["source"].(string), "gcr.io/my-project/my-app")] = entry["status"].(string)
+	}
+	return statuses
+}
+
+func TestMigrateCopiesTagsReferrersAndUntagged(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+	stateFile := filepath.Join(t.TempDir(), "migration.json")
+
+	const source = "my-project/my-app"
+	const target = "my-project/containers/my-app"
+	release := registry.SeedImage(source, "1.0.0", "release")
+	index := registry.SeedIndex(source, "1.1.0", "amd64", "arm64")
+	registry.SeedIndex(source, "latest", "amd64", "arm64")
+	cosignTag := "sha256-" + strings.TrimPrefix(release, "sha256:") + ".sig"
+	registry.SeedImage(source, cosignTag, "cosign signature")
+	referrer := registry.SeedReferrer(source, release, "attestation")
+	orphan := registry.SeedImage(source, "", "orphan")
+
+	p := &GCRPlugin{}
+	execute := func() *plugin.ExecuteResponse {
+		t.Helper()
+		resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+			Hook:   plugin.HookPostPublish,
+			Config: migrationConfig(api, registry, stateFile),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	resp := execute()
+	want := map[string]string{
+		":1.0.0": "copied", ":1.1.0": "copied", ":latest": "copied", ":" + cosignTag: "copied", "@" + referrer: "copied",
+		"@" + orphan: "copied",
+	}
+	if got := migrationStatuses(t, resp); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	for _, tag := range []string{"1.0.0", "1.1.0", "latest", cosignTag} {
+		if got := registry.Digest(target, tag); got != registry.Digest(source, tag) {
+			t.Errorf("expected %s at %s, got '%s'", tag, registry.Digest(source, tag), got)
+		}
+	}
+	if registry.Digest(target, "1.1.0") != index || !registry.HasManifest(target, referrer) {
+		t.Error("expected the index and the referrer to keep their digests")
+	}
+	if !registry.HasManifest(target, orphan) {
+		t.Error("expected the untagged manifest to be copied")
+	}
+
+	var state migrationState
+	data, err := os.ReadFile(stateFile)
+	if err != nil || json.Unmarshal(data, &state) != nil || len(state.Entries) != 6 {
+		t.Fatalf("expected six entries in the migration state, got %s (%v)", data, err)
+	}
+
+	// A resumed migration copies only what is new or missing.
+	if err := testRegistryClient(t, registry).DeleteManifest(context.Background(), target, "latest"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	registry.SeedImage(source, "1.2.0", "next")
+
+	resp = execute()
+	want = map[string]string{
+		":1.0.0": "migrated", ":1.1.0": "migrated", ":1.2.0": "copied", ":latest": "copied",
+		":" + cosignTag: "migrated", "@" + referrer: "migrated", "@" + orphan: "migrated",
+	}
+	if got := migrationStatuses(t, resp); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v on resume, got %v", want, got)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+	stateFile := filepath.Join(t.TempDir(), "migration.json")
+	registry.SeedImage("my-project/my-app", "1.0.0", "release")
+
+	config := migrationConfig(api, registry, stateFile)
+	config["dry_run"] = true
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{Hook: plugin.HookPostPublish, Config: config})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := migrationStatuses(t, resp); !reflect.DeepEqual(got, map[string]string{":1.0.0": "would copy"}) {
+		t.Errorf("expected a planned copy, got %v", got)
+	}
+	if registry.Digest("my-project/containers/my-app", "1.0.0") != "" {
+		t.Error("expected nothing to be copied in dry-run")
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("expected no migration state in dry-run, got %v", err)
+	}
+}
+
+func TestLoadMigrationStateRefusesOtherMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migration.json")
+	if err := writeJSONFile(path, &migrationState{Source: "gcr.io/other", Target: "us-docker.pkg.dev/other/repo"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := loadMigrationState(path, "gcr.io/my-project", "us-docker.pkg.dev/my-project/containers")
+	if err == nil || !strings.Contains(err.Error(), "is for gcr.io/other to us-docker.pkg.dev/other/repo") {
+		t.Errorf("expected state mismatch error, got %v", err)
+	}
+}
+
+func TestValidateMigration(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     map[string]any
+		wantFields []string
+	}{
+		{name: "valid"},
+		{name: "artifact registry source", config: map[string]any{"artifact_registry": true, "repository": "old"}, wantFields: []string{"artifact_registry"}},
+		{name: "missing repository", config: map[string]any{"migrate": map[string]any{"enabled": true}}, wantFields: []string{"migrate.repository"}},
+		{
+			name:       "unknown region",
+			config:     map[string]any{"migrate": map[string]any{"enabled": true, "repository": "containers", "region": "mars"}},
+			wantFields: []string{"migrate.region"},
+		},
+	}
+
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+	p := &GCRPlugin{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := migrationConfig(api, registry, "")
+			for k, v := range tt.config {
+				config[k] = v
+			}
+
+			resp, err := p.Validate(context.Background(), config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var fields []string
+			for _, e := range resp.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestMigrationRegion(t *testing.T) {
+	for gcrRegion, want := range map[string]string{"us": "us", "eu": "europe", "europe": "europe", "asia": "asia"} {
+		if got := migrationRegion(gcrRegion); got != want {
+			t.Errorf("expected %s to migrate to %s, got %s", gcrRegion, want, got)
+		}
+	}
+}
+
+func TestRunMigrationCommand(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+	dir := t.TempDir()
+	registry.SeedImage("my-project/my-app", "1.0.0", "release")
+
+	config := migrationConfig(api, registry, filepath.Join(dir, "migration.json"))
+	delete(config, "migrate")
+	config["migrate"] = map[string]any{"repository": "containers", "state_file": filepath.Join(dir, "migration.json")}
+	data, _ := json.Marshal(config)
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runMigrationCommand(context.Background(), path, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Migrated 1 reference(s) from gcr.io/my-project to us-docker.pkg.dev/my-project/containers") {
+		t.Errorf("unexpected output '%s'", out.String())
+	}
+	if registry.Digest("my-project/containers/my-app", "1.0.0") == "" {
+		t.Error("expected the tag to be migrated")
+	}
+}
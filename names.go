@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+var (
+	// projectIDPattern matches GCP project IDs, optionally domain-scoped.
+	projectIDPattern = regexp.MustCompile(`^([a-z][a-z0-9.-]*[a-z0-9]:)?[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+
+	// repositoryNamePattern matches Artifact Registry repository IDs.
+	repositoryNamePattern = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+	// pathComponentPattern matches one component of an OCI repository path.
+	pathComponentPattern = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*$`)
+
+	// tagPattern matches OCI tags.
+	tagPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+)
+
+// maxImagePathLength is the longest repository path registries accept.
+const maxImagePathLength = 255
+
+// sampleReleaseContext renders tag templates during validation, before the
+// real release context is known.
+var sampleReleaseContext = plugin.ReleaseContext{
+	Version:         "1.0.0",
+	PreviousVersion: "0.9.0",
+	TagName:         "v1.0.0",
+	ReleaseType:     "minor",
+	Branch:          "main",
+}
+
+// checkProjectID returns an error if id is not a valid GCP project ID.
+func checkProjectID(id string) error {
+	if !projectIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid project ID '%s': must be 6-30 lowercase letters, digits or hyphens, start with a letter and not end with a hyphen", id)
+	}
+	return nil
+}
+
+// checkRepositoryName returns an error if name is not a valid Artifact
+// Registry repository ID.
+func checkRepositoryName(name string) error {
+	if !repositoryNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid repository name '%s': must be up to 63 lowercase letters, digits or hyphens, start with a letter and end with a letter or digit", name)
+	}
+	return nil
+}
+
+// checkImagePath returns an error if path is not a valid OCI repository
+// path. Nested paths such as "team/api" are allowed.
+func checkImagePath(path string) error {
+	if len(path) > maxImagePathLength {
+		return fmt.Errorf("invalid image name '%s': longer than %d characters", path, maxImagePathLength)
+	}
+	for _, component := range strings.Split(path, "/") {
+		if !pathComponentPattern.MatchString(component) {
+			return fmt.Errorf("invalid image name '%s': path component '%s' must be lowercase letters and digits, separated by '.', '_', '__' or '-'", path, component)
+		}
+	}
+	return nil
+}
+
+// checkTag returns an error if tag is not a valid OCI tag.
+func checkTag(tag string) error {
+	if len(tag) > 128 {
+		return fmt.Errorf("invalid tag '%s': longer than 128 characters", tag)
+	}
+	if !tagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid tag '%s': must be letters, digits, '_', '.' or '-' and must not start with '.' or '-'", tag)
+	}
+	return nil
+}
+
+// validateTags checks that every tag template renders to a valid tag.
+func (p *GCRPlugin) validateTags(vb *helpers.ValidationBuilder, field string, tags []string) {
+	for i, tmpl := range tags {
+		rendered := p.processTemplate(tmpl, &sampleReleaseContext)
+		if rendered == "" {
+			continue
+		}
+		if err := checkTag(rendered); err != nil {
+			vb.AddError(fmt.Sprintf("%s[%d]", field, i), err.Error())
+		}
+	}
+}
+
+// validateNames checks the image names and tags of the configuration.
+func (p *GCRPlugin) validateNames(vb *helpers.ValidationBuilder, cfg *Config) {
+	if len(cfg.Images) == 0 {
+		if cfg.Image != "" {
+			if err := checkImagePath(cfg.Image); err != nil {
+				vb.AddError("image", err.Error())
+			}
+		}
+		p.validateTags(vb, "tags", cfg.Tags)
+		return
+	}
+
+	p.validateTags(vb, "tags", cfg.Tags)
+	for i, image := range cfg.Images {
+		field := fmt.Sprintf("images[%d]", i)
+		if image.Image != "" {
+			if err := checkImagePath(image.Image); err != nil {
+				vb.AddError(field+".image", err.Error())
+			}
+		}
+		if image.Repository != "" && cfg.ArtifactRegistry {
+			if err := checkRepositoryName(image.Repository); err != nil {
+				vb.AddError(field+".repository", err.Error())
+			}
+		}
+		p.validateTags(vb, field+".tags", image.Tags)
+	}
+}
+
+// checkRenderedTags verifies the tags of every image for the actual release
+// before anything is pushed.
+func (p *GCRPlugin) checkRenderedTags(cfg *Config, ctx *plugin.ReleaseContext) error {
+	for _, image := range cfg.images() {
+		for _, tag := range p.processTags(image.Tags, ctx) {
+			if err := checkTag(tag); err != nil {
+				return fmt.Errorf("image %s: %w", image.Image, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+func TestCheckProjectID(t *testing.T) {
+	tests := []struct {
+		id      string
+		wantErr bool
+	}{
+		{id: "my-project"},
+		{id: "project-123456"},
+		{id: "example.com:my-project"},
+		{id: "abc", wantErr: true},
+		{id: "My-Project", wantErr: true},
+		{id: "1project", wantErr: true},
+		{id: "my-project-", wantErr: true},
+		{id: "my_project", wantErr: true},
+		{id: "a-very-long-project-id-that-is-too-long", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if err := checkProjectID(tt.id); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckRepositoryName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "my-repo"},
+		{name: "r"},
+		{name: "docker1"},
+		{name: "My-Repo", wantErr: true},
+		{name: "1repo", wantErr: true},
+		{name: "repo-", wantErr: true},
+		{name: "my_repo", wantErr: true},
+		{name: strings.Repeat("a", 64), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRepositoryName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckImagePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "my-app"},
+		{path: "team/api"},
+		{path: "team/sub.group/my__app"},
+		{path: "a--b"},
+		{path: "My-App", wantErr: true},
+		{path: "team//api", wantErr: true},
+		{path: "/api", wantErr: true},
+		{path: "api-", wantErr: true},
+		{path: "api:latest", wantErr: true},
+		{path: strings.Repeat("a/", 128) + "a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if err := checkImagePath(tt.path); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckTag(t *testing.T) {
+	tests := []struct {
+		tag     string
+		wantErr bool
+	}{
+		{tag: "1.2.3"},
+		{tag: "latest"},
+		{tag: "_internal"},
+		{tag: "v1.2.3-rc.1"},
+		{tag: strings.Repeat("a", 128)},
+		{tag: strings.Repeat("a", 129), wantErr: true},
+		{tag: ".hidden", wantErr: true},
+		{tag: "-dash", wantErr: true},
+		{tag: "1.2.3+build", wantErr: true},
+		{tag: "{{.Commit}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if err := checkTag(tt.tag); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     map[string]any
+		wantFields []string
+	}{
+		{
+			name: "valid names",
+			config: map[string]any{
+				"image": "team/my-app",
+				"tags":  []any{"{{.Version}}", "{{.Branch}}-latest"},
+			},
+		},
+		{
+			name: "invalid project, repository and image",
+			config: map[string]any{
+				"project":    "My_Project",
+				"repository": "My_Repo",
+				"image":      "My-App",
+			},
+			wantFields: []string{"image", "project", "repository"},
+		},
+		{
+			name: "invalid tag template",
+			config: map[string]any{
+				"tags": []any{"{{.Version}}", "build+{{.Version}}", "{{.Unknown}}"},
+			},
+			wantFields: []string{"tags[1]", "tags[2]"},
+		},
+		{
+			name: "invalid image entries",
+			config: map[string]any{
+				"images": []any{
+					map[string]any{"image": "api", "source_image": "api:latest", "tags": []any{"-bad"}},
+					map[string]any{"image": "Worker", "source_image": "worker:latest", "repository": "Tools"},
+				},
+			},
+			wantFields: []string{"images[0].tags[0]", "images[1].image", "images[1].repository"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]any{
+				"project":      "my-project",
+				"repository":   "my-repo",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+			}
+			for k, v := range tt.config {
+				config[k] = v
+			}
+			if _, ok := tt.config["images"]; ok {
+				delete(config, "image")
+			}
+
+			p := &GCRPlugin{}
+			resp, err := p.Validate(context.Background(), config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var fields []string
+			for _, e := range resp.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestExecuteRejectsInvalidRenderedTag(t *testing.T) {
+	logPath := installFakeCommands(t)
+
+	p := &GCRPlugin{}
+	_, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":      "my-project",
+			"repository":   "my-repo",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3+build.5"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid tag '1.2.3+build.5'") {
+		t.Fatalf("expected invalid tag error, got %v", err)
+	}
+
+	if lines := readFakeCommandLog(t, logPath); len(lines) != 0 {
+		t.Errorf("expected no commands before the tag check, got %v", lines)
+	}
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
 	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
@@ -17,17 +20,34 @@ type GCRPlugin struct{}
 
 // Config holds the plugin configuration.
 type Config struct {
+	// Name identifies the target a configuration was derived for; it is
+	// empty for a configuration without targets.
+	Name  string
+	index int
+
 	// GCP Configuration
 	ArtifactRegistry bool
 	Project          string
 	Region           string
 	Repository       string
 	Image            string
+	regionSet        bool
 
 	// Authentication
-	AuthMethod string
-	KeyFile    string
-	KeyJSON    string
+	AuthMethod      string
+	KeyFile         string
+	KeyJSON         string
+	AccessToken     string
+	AccessTokenFile string
+	TokenLogin      bool
+
+	// secrets caches resolved Secret Manager references by reference. The
+	// map is shared by every target, so each reference is fetched once.
+	secrets map[string]string
+
+	// Key rotation thresholds in days
+	KeyWarnAgeDays int
+	KeyMaxAgeDays  int
 
 	// Source image
 	SourceImage string
@@ -35,22 +55,75 @@ type Config struct {
 	// Tags
 	Tags []string
 
+	// Images pushed in one run; empty pushes Image from SourceImage
+	Images []ImageConfig
+
+	// Destinations, each with its own registry and credentials
+	Targets []TargetConfig
+
+	// Release filters
+	Only   *ReleaseFilter
+	Except *ReleaseFilter
+
+	// Staging push in pre_publish, promoted by digest in post_publish
+	StagingEnabled    bool
+	StagingRepository string
+	StagingTag        string
+
+	// Cleanup of a failed release's tags in on_error
+	CleanupOnError    bool
+	CleanupRecordFile string
+
+	// Transactional rolls back every moved tag when a push fails
+	Transactional bool
+
+	// Artifact Registry repositories created before the first push
+	EnsureRepository   bool
+	RepositorySettings RepositorySettings
+
+	// Retention prunes old version tags after a successful push
+	Retention RetentionPolicy
+
+	// GC deletes old untagged manifests after a successful push
+	GC GCPolicy
+
+	// Migration copies legacy GCR images to Artifact Registry instead of
+	// pushing
+	Migration MigrationConfig
+
 	// Multi-region
 	MultiRegionEnabled bool
 	MultiRegionRegions []string
 
+	// Pre-flight checks
+	PreflightIAM         bool
+	PreflightSourceImage bool
+	PullSourceImage      bool
+
+	// API endpoints
+	Endpoints Endpoints
+
 	// Behavior
 	DryRun bool
+
+	// Profile is the profile merged into the configuration, if any.
+	Profile       string
+	profileReason string
+	profileErr    error
 }
 
 // GetInfo returns plugin metadata.
 func (p *GCRPlugin) GetInfo() plugin.Info {
 	return plugin.Info{
-		Name:        "gcr",
-		Version:     Version,
-		Description: "Push container images to Google Artifact Registry and Google Container Registry",
+		Name:         "gcr",
+		Version:      Version,
+		Description:  "Push container images to Google Artifact Registry and Google Container Registry",
+		ConfigSchema: configSchema,
 		Hooks: []plugin.Hook{
+			plugin.HookPrePublish,
 			plugin.HookPostPublish,
+			plugin.HookOnSuccess,
+			plugin.HookOnError,
 		},
 	}
 }
@@ -59,131 +132,717 @@ func (p *GCRPlugin) GetInfo() plugin.Info {
 func (p *GCRPlugin) Validate(ctx context.Context, config map[string]any) (*plugin.ValidateResponse, error) {
 	vb := helpers.NewValidationBuilder()
 	cfg := p.parseConfig(config)
+	redactor := newConfigRedactor(cfg)
+
+	// Types and keys are checked against the published schema
+	validateSchema(vb, config)
+	validateProfiles(vb, config)
+
+	// Every profile a release may select is checked merged with the base
+	variants := p.configVariants(config, cfg)
+	validateVariants(vb, variants, p.validateSettings)
+
+	if vb.HasErrors() {
+		return redactor.ValidateResponse(vb.Build()), nil
+	}
+
+	validateVariants(vb, variants, func(vb *helpers.ValidationBuilder, cfg *Config, redactor *Redactor) {
+		p.validateRemote(ctx, vb, cfg, redactor)
+	})
+
+	return redactor.ValidateResponse(vb.Build()), nil
+}
+
+// validateSettings checks a configuration without contacting any service.
+func (p *GCRPlugin) validateSettings(vb *helpers.ValidationBuilder, cfg *Config, redactor *Redactor) {
+	if len(cfg.Images) > 0 {
+		// Every image needs a name and source, inherited or its own
+		p.validateImages(vb, cfg)
+	} else {
+		// Image name is required
+		if cfg.Image == "" {
+			vb.AddError("image", "image name is required")
+		}
+
+		// Source image is required, except to migrate from the registry
+		if cfg.SourceImage == "" && !cfg.Migration.Enabled {
+			vb.AddError("source_image", "source image is required")
+		}
+	}
+
+	// Image names and rendered tags must be valid OCI references
+	p.validateNames(vb, cfg)
+	p.validateStaging(vb, cfg)
+	p.validateRepositorySettings(vb, cfg)
+	p.validateRetention(vb, cfg)
+	p.validateGC(vb, cfg)
+	p.validateMigration(vb, cfg)
 
+	// Destination and credentials, once per target
+	if len(cfg.Targets) > 0 {
+		p.validateTargets(vb, cfg, redactor)
+	} else {
+		p.validateTarget(vb, cfg, "", redactor)
+	}
+
+	// Key rotation thresholds must be consistent
+	if cfg.KeyWarnAgeDays > 0 && cfg.KeyMaxAgeDays > 0 && cfg.KeyWarnAgeDays >= cfg.KeyMaxAgeDays {
+		vb.AddError("auth.key_warn_age_days", "key_warn_age_days must be less than key_max_age_days")
+	}
+}
+
+// validateRemote runs the optional checks that contact Docker and Google APIs.
+func (p *GCRPlugin) validateRemote(ctx context.Context, vb *helpers.ValidationBuilder, cfg *Config, redactor *Redactor) {
+	// Optional check that source images exist locally or in their registry
+	if cfg.PreflightSourceImage {
+		sources, err := p.resolveSourceImages(ctx, cfg, false, true)
+		if err != nil {
+			vb.AddError("preflight.source_image", err.Error())
+		} else {
+			printSourceImages(redactor, sources)
+		}
+	}
+
+	for _, target := range cfg.targets() {
+		prefix := target.fieldPrefix()
+
+		// Optional key rotation check against the IAM keys API
+		if target.AuthMethod == "service_account" && target.keyAgePolicy().Enabled() {
+			var age *KeyAge
+			err := resolveSecrets(ctx, target, redactor)
+			if err == nil {
+				age, err = p.checkKeyAge(ctx, target, NewCredentialManager(target.authConfig(), "", target.Endpoints), redactor)
+			}
+			if err != nil {
+				vb.AddError(prefix+"auth.key_max_age_days", err.Error())
+			} else if age != nil {
+				redactor.Printf("%s%s\n", target.outputLabel(), target.keyAgePolicy().describe(age))
+			}
+		}
+
+		// Optional pre-flight IAM check against the target repositories
+		if target.PreflightIAM {
+			var checks []*PermissionCheck
+			err := resolveSecrets(ctx, target, redactor)
+			if err == nil {
+				checks, err = p.checkPermissions(ctx, target, NewCredentialManager(target.authConfig(), "", target.Endpoints))
+			}
+			if err != nil {
+				vb.AddError(prefix+"preflight.iam", err.Error())
+			} else if missing := formatMissingPermissions(checks); missing != "" {
+				vb.AddError(prefix+"preflight.iam", "missing permissions:\n"+missing)
+			}
+		}
+	}
+}
+
+// validateTarget checks the destination and credentials of a single target.
+// Field names are prefixed with prefix.
+func (p *GCRPlugin) validateTarget(vb *helpers.ValidationBuilder, cfg *Config, prefix string, redactor *Redactor) {
 	// Project is required
 	if cfg.Project == "" {
-		vb.AddError("project", "GCP project ID is required")
+		vb.AddError(prefix+"project", "GCP project ID is required")
+	} else if err := checkProjectID(cfg.Project); err != nil {
+		vb.AddError(prefix+"project", err.Error())
 	}
 
-	// Image name is required
-	if cfg.Image == "" {
-		vb.AddError("image", "image name is required")
+	// Regions must exist for the registry type
+	p.validateRegions(vb, cfg, prefix, redactor)
+
+	// Repository required for Artifact Registry
+	if cfg.ArtifactRegistry {
+		if cfg.Repository != "" {
+			if err := checkRepositoryName(cfg.Repository); err != nil {
+				vb.AddError(prefix+"repository", err.Error())
+			}
+		}
+		if len(cfg.Images) == 0 {
+			if cfg.Repository == "" {
+				vb.AddError(prefix+"repository", "repository name required for Artifact Registry")
+			}
+		} else {
+			for i, image := range cfg.images() {
+				if image.Repository == "" {
+					vb.AddError(fmt.Sprintf("%simages[%d].repository", prefix, i), "repository name required for Artifact Registry")
+				}
+			}
+		}
 	}
 
-	// Source image is required
-	if cfg.SourceImage == "" {
-		vb.AddError("source_image", "source image is required")
+	// Service account requires a well-formed key
+	if cfg.AuthMethod == "service_account" {
+		if cfg.KeyFile == "" && cfg.KeyJSON == "" {
+			vb.AddError(prefix+"auth", "service account requires key_file or key_json")
+		} else {
+			p.validateServiceAccountKey(vb, cfg, prefix, redactor)
+		}
 	}
 
-	// Repository required for Artifact Registry
-	if cfg.ArtifactRegistry && cfg.Repository == "" {
-		vb.AddError("repository", "repository name required for Artifact Registry")
+	// Access token requires a token source
+	if cfg.AuthMethod == "access_token" && cfg.AccessToken == "" && cfg.AccessTokenFile == "" {
+		vb.AddError(prefix+"auth", "access token auth requires access_token or access_token_file")
 	}
 
-	// Validate auth method
-	if cfg.AuthMethod != "" && cfg.AuthMethod != "gcloud" && cfg.AuthMethod != "service_account" {
-		vb.AddError("auth.method", "auth method must be 'gcloud' or 'service_account'")
+	// Secret Manager references must be well-formed
+	secretFields := []struct{ field, value string }{
+		{"auth.key_json", cfg.KeyJSON},
+		{"auth.access_token", cfg.AccessToken},
+	}
+	for _, secret := range secretFields {
+		if isSecretRef(secret.value) {
+			if _, err := parseSecretRef(secret.value); err != nil {
+				vb.AddError(prefix+secret.field, err.Error())
+			}
+		}
+	}
+}
+
+// validateServiceAccountKey checks the configured key before any release work starts.
+func (p *GCRPlugin) validateServiceAccountKey(vb *helpers.ValidationBuilder, cfg *Config, prefix string, redactor *Redactor) {
+	// Keys stored in Secret Manager are checked once resolved at execution time.
+	if cfg.KeyFile == "" && isSecretRef(cfg.KeyJSON) {
+		return
+	}
+
+	field := prefix + "auth.key_json"
+	if cfg.KeyFile != "" {
+		field = prefix + "auth.key_file"
+
+		warning, err := checkKeyFilePermissions(cfg.KeyFile)
+		if err != nil {
+			vb.AddError(field, err.Error())
+			return
+		}
+		if warning != "" {
+			redactor.Warnf("%s", warning)
+		}
+	}
+
+	data, err := readServiceAccountKey(&AuthConfig{KeyFile: cfg.KeyFile, KeyJSON: cfg.KeyJSON})
+	if err != nil {
+		vb.AddError(field, err.Error())
+		return
+	}
+
+	key, err := parseServiceAccountKey(data)
+	if err != nil {
+		vb.AddError(field, err.Error())
+		return
 	}
 
-	// Service account requires key
-	if cfg.AuthMethod == "service_account" && cfg.KeyFile == "" && cfg.KeyJSON == "" {
-		vb.AddError("auth", "service account requires key_file or key_json")
+	for _, problem := range key.Problems() {
+		vb.AddError(field, problem)
 	}
 
-	return vb.Build(), nil
+	if key.ProjectID != "" && cfg.Project != "" && key.ProjectID != cfg.Project {
+		redactor.Warnf("service account key belongs to project '%s' but pushing to project '%s'", key.ProjectID, cfg.Project)
+	}
 }
 
-// Execute runs the plugin logic.
+// Execute runs the plugin logic. Every error, output line and response field
+// is passed through a Redactor so credentials never leave the plugin.
 func (p *GCRPlugin) Execute(ctx context.Context, req plugin.ExecuteRequest) (*plugin.ExecuteResponse, error) {
-	cfg := p.parseConfig(req.Config)
+	cfg := p.parseReleaseConfig(req.Config, &req.Context)
 	cfg.DryRun = cfg.DryRun || req.DryRun
+	redactor := newConfigRedactor(cfg)
+
+	if cfg.profileErr != nil {
+		return nil, redactor.Error(cfg.profileErr)
+	}
+	printProfile(redactor, cfg)
+
+	// Secret Manager references are resolved in memory before authenticating
+	if err := resolveSecrets(ctx, cfg, redactor); err != nil {
+		return nil, redactor.Error(err)
+	}
 
+	resp, err := p.execute(ctx, req, cfg, redactor)
+	if err != nil {
+		// Some failures, such as a rolled back push, still report what was done
+		if resp != nil {
+			resp = redactor.Response(resp)
+		}
+		return resp, redactor.Error(err)
+	}
+	return redactor.Response(resp), nil
+}
+
+// execute dispatches the request to the handler for its hook.
+func (p *GCRPlugin) execute(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, redactor *Redactor) (*plugin.ExecuteResponse, error) {
+	// Releases excluded by only/except are a clean no-op
+	if reason := cfg.releaseSkipReason(&req.Context); reason != "" {
+		redactor.Printf("Skipping: %s\n", reason)
+		return skippedResponse(reason), nil
+	}
+
+	switch req.Hook {
+	case plugin.HookPrePublish:
+		return p.prePublish(ctx, req, cfg, redactor)
+	case plugin.HookOnSuccess:
+		return p.onSuccess(req, cfg)
+	case plugin.HookOnError:
+		return p.onError(ctx, req, cfg, redactor)
+	}
+
+	if cfg.Migration.Enabled {
+		return p.migrate(ctx, cfg, redactor)
+	}
+	return p.publish(ctx, req, cfg, redactor)
+}
+
+// publish pushes the configured images to every target.
+func (p *GCRPlugin) publish(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, redactor *Redactor) (*plugin.ExecuteResponse, error) {
 	// Process tag templates
 	tags := p.processTags(cfg.Tags, &req.Context)
 
-	// Create GCR client
-	client := NewGCRClient(&GCRConfig{
-		Project:          cfg.Project,
-		Region:           cfg.Region,
-		Repository:       cfg.Repository,
-		ArtifactRegistry: cfg.ArtifactRegistry,
-	})
+	// Refuse tags the registry would reject before anything is pushed
+	if err := p.checkRenderedTags(cfg, &req.Context); err != nil {
+		return nil, err
+	}
 
-	// Determine regions to push to
-	regions := []string{cfg.Region}
-	if cfg.MultiRegionEnabled && len(cfg.MultiRegionRegions) > 0 {
-		regions = cfg.MultiRegionRegions
+	// Resolve source images up front so a missing image fails before tagging.
+	// Staged images were checked when they were pushed in pre_publish.
+	var sources []*SourceImage
+	if cfg.checksSourceImages() && !cfg.DryRun && !cfg.StagingEnabled {
+		var err error
+		sources, err = p.resolveSourceImages(ctx, cfg, cfg.PullSourceImage, false)
+		if err != nil {
+			return nil, err
+		}
+		printSourceImages(redactor, sources)
 	}
 
+	// Log in and push against a throwaway Docker config so credentials never
+	// land in the caller's ~/.docker/config.json.
+	dockerConfig := ""
+	if !cfg.DryRun {
+		dir, err := newDockerConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		dockerConfig = dir
+	}
+
+	// Record every tag before it moves so a failed run can be put back, by
+	// the on_error hook from the record file or right away in a transaction
+	var record *pushRecord
+	if (cfg.CleanupOnError || cfg.Transactional) && !cfg.DryRun {
+		path := ""
+		if cfg.CleanupOnError {
+			path = p.recordPath(cfg, &req.Context)
+		}
+
+		var err error
+		record, err = loadPushRecord(path, req.Context.Version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pushedImages := []string{}
+	results := make([]*targetResult, 0, len(cfg.Targets))
+	for _, target := range cfg.targets() {
+		if reason := target.skipReason(&req.Context); reason != "" {
+			redactor.Printf("Skipping target %s: %s\n", target.Name, reason)
+			results = append(results, &targetResult{target: target, skipReason: reason, pushedImages: []string{}})
+			continue
+		}
+
+		targetDockerConfig, err := targetDockerConfig(dockerConfig, target)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := p.publishTarget(ctx, req, target, targetDockerConfig, record, redactor)
+		if err != nil {
+			if target.Name != "" {
+				err = fmt.Errorf("target %s: %w", target.Name, err)
+			}
+			if cfg.Transactional && record != nil && len(record.Entries) > 0 {
+				return p.rollback(ctx, cfg, record, err, redactor)
+			}
+			return nil, err
+		}
+
+		pushedImages = append(pushedImages, result.pushedImages...)
+		results = append(results, result)
+	}
+
+	// Old versions and manifests are removed only once every target has
+	// the new release. This is outside the transaction: a failure here fails
+	// the release but leaves the pushed tags in place, and the outputs still
+	// report what was pushed and removed.
+	var removeErr error
+	now := time.Now()
+	for _, result := range results {
+		if result.skipReason != "" {
+			continue
+		}
+		if err := p.removeOld(ctx, req, result, now, redactor); err != nil {
+			removeErr = err
+			if result.target.Name != "" {
+				removeErr = fmt.Errorf("target %s: %w", result.target.Name, err)
+			}
+			break
+		}
+	}
+
+	outputs := map[string]any{
+		"project":       cfg.Project,
+		"repository":    cfg.Repository,
+		"tags":          tags,
+		"pushed_images": pushedImages,
+	}
+	if sources != nil {
+		outputs["source_images"] = sourceImageOutputs(sources)
+	}
+	if cfg.Profile != "" {
+		outputs["profile"] = cfg.Profile
+	}
+	if len(cfg.Targets) == 0 {
+		for k, v := range results[0].outputs() {
+			outputs[k] = v
+		}
+	} else {
+		targetOutputs := make([]map[string]any, 0, len(results))
+		for _, result := range results {
+			targetOutputs = append(targetOutputs, result.outputs())
+		}
+		outputs["targets"] = targetOutputs
+	}
+
+	if removeErr != nil {
+		return &plugin.ExecuteResponse{
+			Success: false,
+			Message: fmt.Sprintf("Pushed %d image(s) to GCR, but removing old versions failed", len(pushedImages)),
+			Error:   removeErr.Error(),
+			Outputs: outputs,
+		}, removeErr
+	}
+
+	return &plugin.ExecuteResponse{
+		Success: true,
+		Message: fmt.Sprintf("Successfully pushed %d image(s) to GCR", len(pushedImages)),
+		Outputs: outputs,
+	}, nil
+}
+
+// removeOld prunes old version tags and then collects the untagged
+// manifests of a target, as configured, measuring manifest ages from now.
+// Errors name the step that failed; what was removed before it is kept in
+// result.
+func (p *GCRPlugin) removeOld(ctx context.Context, req plugin.ExecuteRequest, result *targetResult, now time.Time, redactor *Redactor) error {
+	cfg := result.target
+	if cfg.Retention.Enabled {
+		pruned, err := p.prune(ctx, req, cfg, result.credentials, redactor)
+		result.prunedTags = pruned
+		if err != nil {
+			return fmt.Errorf("retention failed: %w", err)
+		}
+	}
+
+	if cfg.GC.Enabled {
+		collected, deleted, err := p.collectGarbage(ctx, cfg, result.credentials, now, redactor)
+		result.collected = collected
+		result.deletedManifestBytes = deleted
+		if err != nil {
+			return fmt.Errorf("garbage collection failed: %w", err)
+		}
+		redactor.Printf("Garbage collection: %d untagged manifest(s), %d bytes of deleted manifests\n", len(collected), deleted)
+	}
+	return nil
+}
+
+// targetDockerConfig returns the Docker config directory of a target. Targets
+// may log in to the same host with different credentials, so each gets its
+// own directory below the run's Docker config.
+func targetDockerConfig(dockerConfig string, target *Config) (string, error) {
+	if target.Name == "" || dockerConfig == "" {
+		return dockerConfig, nil
+	}
+	dir := filepath.Join(dockerConfig, fmt.Sprintf("target-%d", target.index))
+	if err := os.Mkdir(dir, 0o700); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("failed to create Docker config directory: %w", err)
+	}
+	return dir, nil
+}
+
+// targetResult records what was pushed to one target.
+type targetResult struct {
+	target       *Config
+	skipReason   string
+	pushedImages []string
+	images       []map[string]any
+	keyAge       *KeyAge
+	repositories []map[string]any
+	credentials  *CredentialManager
+	prunedTags   []string
+
+	collected            []map[string]any
+	deletedManifestBytes int64
+}
+
+// outputs returns the execute outputs describing the target.
+func (r *targetResult) outputs() map[string]any {
+	outputs := map[string]any{
+		"pushed_images": r.pushedImages,
+		"images":        r.images,
+	}
+	if r.target.Name != "" {
+		outputs["name"] = r.target.Name
+		outputs["project"] = r.target.Project
+		outputs["repository"] = r.target.Repository
+		outputs["artifact_registry"] = r.target.ArtifactRegistry
+		outputs["regions"] = r.target.regions()
+	}
+	if r.skipReason != "" {
+		outputs["skipped"] = true
+		outputs["skip_reason"] = r.skipReason
+	}
+	if r.keyAge != nil {
+		outputs["key_id"] = r.keyAge.KeyID
+		outputs["key_age_days"] = r.keyAge.Days()
+		if policy := r.target.keyAgePolicy(); policy.MaxDays > 0 {
+			outputs["key_days_left"] = policy.MaxDays - r.keyAge.Days()
+		}
+	}
+	if len(r.repositories) > 0 {
+		outputs["repositories"] = r.repositories
+	}
+	if r.prunedTags != nil {
+		outputs["pruned_tags"] = r.prunedTags
+	}
+	if r.collected != nil {
+		outputs["garbage_collected"] = r.collected
+		outputs["deleted_manifest_bytes"] = r.deletedManifestBytes
+	}
+	return outputs
+}
+
+// publishTarget pushes every image to the regions of one target.
+// Tags are tracked in record, when set, before they are pushed.
+func (p *GCRPlugin) publishTarget(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, dockerConfig string, record *pushRecord, redactor *Redactor) (*targetResult, error) {
+	// Target credentials may be Secret Manager references of their own
+	if err := resolveSecrets(ctx, cfg, redactor); err != nil {
+		return nil, err
+	}
+
+	// One credential manager per target: hosts shared by several regions are
+	// logged in to only once, and expiring tokens are refreshed before pushes.
+	credentials := NewCredentialManager(cfg.authConfig(), dockerConfig, cfg.Endpoints)
+	credentials.warnf = redactor.Warnf
+
+	// Enforce service account key rotation before anything is pushed. Dry
+	// runs make no API calls, so the key age is not looked up.
+	var keyAge *KeyAge
+	if cfg.DryRun {
+		if cfg.AuthMethod == "service_account" && cfg.keyAgePolicy().Enabled() {
+			redactor.Printf("[dry-run] Would check the service account key age\n")
+		}
+	} else {
+		var err error
+		keyAge, err = p.checkKeyAge(ctx, cfg, credentials, redactor)
+		if err != nil {
+			return nil, err
+		}
+		if keyAge != nil {
+			redactor.Printf("%s\n", cfg.keyAgePolicy().describe(keyAge))
+		}
+	}
+
+	// Determine regions to push to
+	regions := cfg.regions()
+
 	// Authenticate with GCR
 	if !cfg.DryRun {
 		for _, region := range regions {
-			authCfg := &AuthConfig{
-				Method:  cfg.AuthMethod,
-				KeyFile: cfg.KeyFile,
-				KeyJSON: cfg.KeyJSON,
-			}
-			if err := client.Authenticate(ctx, region, authCfg); err != nil {
+			client := NewGCRClient(cfg.gcrConfig(region, dockerConfig, credentials))
+			if err := client.Authenticate(ctx, region); err != nil {
 				return nil, fmt.Errorf("failed to authenticate with %s: %w", region, err)
 			}
 		}
 	}
 
+	// Missing repositories are created before anything is pushed to them
+	repositories, err := p.ensureRepositories(ctx, cfg, cfg.repositories(), p.releaseTags(cfg, &req.Context), credentials, redactor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transactions snapshot every tag before the first one moves
+	if cfg.Transactional && record != nil {
+		if err := p.snapshotTags(ctx, req, cfg, dockerConfig, credentials, record); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create Docker client
-	docker := NewDockerClient()
+	docker := NewDockerClient(dockerConfig)
 
-	// Push images to each region
-	pushedImages := []string{}
-	for _, region := range regions {
-		regionClient := NewGCRClient(&GCRConfig{
-			Project:          cfg.Project,
-			Region:           region,
-			Repository:       cfg.Repository,
-			ArtifactRegistry: cfg.ArtifactRegistry,
-		})
+	// Push every image to each region
+	result := &targetResult{target: cfg, pushedImages: []string{}, images: []map[string]any{}, keyAge: keyAge, repositories: repositories, credentials: credentials}
+	for _, image := range cfg.images() {
+		imageTags := p.processTags(image.Tags, &req.Context)
+		imagePushed := []string{}
 
-		for _, tag := range tags {
-			if tag == "" {
-				continue
-			}
+		imageDigest := ""
 
-			targetImage := fmt.Sprintf("%s:%s", regionClient.GetImagePath(cfg.Image), tag)
+		for _, region := range regions {
+			imageConfig := cfg.gcrConfig(region, dockerConfig, credentials)
+			imageConfig.Repository = image.Repository
+			regionClient := NewGCRClient(imageConfig)
 
-			if cfg.DryRun {
-				fmt.Printf("[dry-run] Would tag %s as %s\n", cfg.SourceImage, targetImage)
-				fmt.Printf("[dry-run] Would push %s\n", targetImage)
-			} else {
-				// Tag the image
-				if err := docker.Tag(ctx, cfg.SourceImage, targetImage); err != nil {
-					return nil, fmt.Errorf("failed to tag image: %w", err)
+			// Images staged by pre_publish are promoted by digest
+			var staged *stagedImage
+			if cfg.StagingEnabled {
+				staged = p.stagedImage(cfg, region, dockerConfig, credentials, image, &req.Context)
+				if !cfg.DryRun {
+					if err := staged.resolve(ctx); err != nil {
+						return nil, err
+					}
+					imageDigest = staged.digest
 				}
+			}
 
-				// Push the image
-				if err := docker.Push(ctx, targetImage); err != nil {
-					return nil, fmt.Errorf("failed to push image: %w", err)
+			for _, tag := range imageTags {
+				if tag == "" {
+					continue
 				}
 
-				fmt.Printf("Pushed: %s\n", targetImage)
+				targetImage := fmt.Sprintf("%s:%s", regionClient.GetImagePath(image.Image), tag)
+
+				if cfg.DryRun && staged != nil {
+					redactor.Printf("[dry-run] Would promote %s to %s\n", staged.ref(), targetImage)
+				} else if cfg.DryRun {
+					redactor.Printf("[dry-run] Would tag %s as %s\n", image.SourceImage, targetImage)
+					redactor.Printf("[dry-run] Would push %s\n", targetImage)
+				} else {
+					// Remember where the tag pointed before it moves
+					var entry *pushRecordEntry
+					if record != nil {
+						var err error
+						if entry, err = record.track(ctx, regionClient, cfg, region, image, tag); err != nil {
+							return nil, err
+						}
+					}
+
+					if staged != nil {
+						if err := p.promote(ctx, staged, regionClient, image.Image, tag); err != nil {
+							return nil, err
+						}
+
+						redactor.Printf("Promoted: %s (%s)\n", targetImage, staged.digest)
+					} else {
+						// Refresh credentials that are about to expire
+						if err := regionClient.Authenticate(ctx, region); err != nil {
+							return nil, fmt.Errorf("failed to authenticate with %s: %w", region, err)
+						}
+
+						// Tag the image
+						if err := docker.Tag(ctx, image.SourceImage, targetImage); err != nil {
+							return nil, fmt.Errorf("failed to tag image: %w", err)
+						}
+
+						// Push the image
+						if err := docker.Push(ctx, targetImage); err != nil {
+							return nil, fmt.Errorf("failed to push image: %w", err)
+						}
+
+						redactor.Printf("Pushed: %s\n", targetImage)
+					}
+
+					if entry != nil {
+						if err := record.pushed(ctx, regionClient, entry); err != nil {
+							return nil, err
+						}
+					}
+				}
+
+				imagePushed = append(imagePushed, targetImage)
 			}
 
-			pushedImages = append(pushedImages, targetImage)
+			// Staging tags in the final repository are removed once promoted
+			if staged != nil && !cfg.DryRun && cfg.StagingRepository == "" && !containsString(imageTags, staged.tag) {
+				if err := staged.client.DeleteTag(ctx, staged.name, staged.tag); err != nil {
+					return nil, fmt.Errorf("failed to remove staging tag %s: %w", staged.ref(), err)
+				}
+			}
+		}
+
+		result.pushedImages = append(result.pushedImages, imagePushed...)
+		result.images = append(result.images, map[string]any{
+			"image":         image.Image,
+			"source_image":  image.SourceImage,
+			"repository":    image.Repository,
+			"tags":          imageTags,
+			"pushed_images": imagePushed,
+		})
+		if imageDigest != "" {
+			result.images[len(result.images)-1]["digest"] = imageDigest
 		}
 	}
 
-	return &plugin.ExecuteResponse{
-		Success: true,
-		Message: fmt.Sprintf("Successfully pushed %d image(s) to GCR", len(pushedImages)),
-		Outputs: map[string]any{
-			"project":       cfg.Project,
-			"repository":    cfg.Repository,
-			"tags":          tags,
-			"pushed_images": pushedImages,
-		},
-	}, nil
+	return result, nil
+}
+
+// authConfig returns the authentication settings of the configuration.
+func (c *Config) authConfig() *AuthConfig {
+	return &AuthConfig{
+		Method:          c.AuthMethod,
+		KeyFile:         c.KeyFile,
+		KeyJSON:         c.KeyJSON,
+		AccessToken:     c.AccessToken,
+		AccessTokenFile: c.AccessTokenFile,
+		TokenLogin:      c.TokenLogin,
+	}
+}
+
+// keyAgePolicy returns the service account key rotation thresholds.
+func (c *Config) keyAgePolicy() KeyAgePolicy {
+	return KeyAgePolicy{WarnDays: c.KeyWarnAgeDays, MaxDays: c.KeyMaxAgeDays}
+}
+
+// regions returns the regions to push to.
+func (c *Config) regions() []string {
+	if c.MultiRegionEnabled && len(c.MultiRegionRegions) > 0 {
+		return dedupeRegions(c.MultiRegionRegions)
+	}
+	return []string{c.Region}
 }
 
-// parseConfig parses the raw configuration into a Config struct.
+// gcrConfig returns the client configuration for region.
+func (c *Config) gcrConfig(region, dockerConfig string, credentials *CredentialManager) *GCRConfig {
+	return &GCRConfig{
+		Project:          c.Project,
+		Region:           region,
+		Repository:       c.Repository,
+		ArtifactRegistry: c.ArtifactRegistry,
+		Endpoints:        c.Endpoints,
+		DockerConfigDir:  dockerConfig,
+		Credentials:      credentials,
+	}
+}
+
+// parseConfig parses the raw configuration into a Config struct, merging an
+// explicitly selected profile on top of the base settings.
 func (p *GCRPlugin) parseConfig(raw map[string]any) *Config {
+	return p.parseReleaseConfig(raw, nil)
+}
+
+// parseReleaseConfig parses the raw configuration for a release, merging the
+// profile the release selects on top of the base settings.
+func (p *GCRPlugin) parseReleaseConfig(raw map[string]any, release *plugin.ReleaseContext) *Config {
+	name, reason, err := selectProfile(raw, release)
+	cfg := p.parseSettings(mergeProfile(raw, name))
+	cfg.Profile = name
+	cfg.profileReason = reason
+	cfg.profileErr = err
+	return cfg
+}
+
+// parseSettings parses raw settings, with any profile already merged in.
+func (p *GCRPlugin) parseSettings(raw map[string]any) *Config {
 	parser := helpers.NewConfigParser(raw)
 
 	tags := parser.GetStringSlice("tags", nil)
@@ -191,38 +850,79 @@ func (p *GCRPlugin) parseConfig(raw map[string]any) *Config {
 		tags = []string{"{{.Version}}"}
 	}
 
-	multiRegionRegions := parser.GetStringSlice("multi_region.regions", nil)
-
 	// Parse nested auth config
 	authMethod := "gcloud"
 	keyFile := ""
 	keyJSON := ""
+	accessToken := ""
+	accessTokenFile := ""
+	keyWarnAgeDays := 0
+	keyMaxAgeDays := 0
 	if authRaw, ok := raw["auth"].(map[string]any); ok {
 		authParser := helpers.NewConfigParser(authRaw)
 		authMethod = authParser.GetString("method", "", "gcloud")
 		keyFile = authParser.GetString("key_file", "GOOGLE_APPLICATION_CREDENTIALS", "")
 		keyJSON = authParser.GetString("key_json", "GCP_SERVICE_ACCOUNT_JSON", "")
+		accessToken = authParser.GetString("access_token", "GOOGLE_OAUTH_ACCESS_TOKEN", "")
+		accessTokenFile = authParser.GetString("access_token_file", "CLOUDSDK_AUTH_ACCESS_TOKEN_FILE", "")
+		keyWarnAgeDays = authParser.GetInt("key_warn_age_days", 0)
+		keyMaxAgeDays = authParser.GetInt("key_max_age_days", 0)
 	}
 
 	// Parse nested multi_region config
 	multiRegionEnabled := false
+	var multiRegionRegions []string
 	if mrRaw, ok := raw["multi_region"].(map[string]any); ok {
 		mrParser := helpers.NewConfigParser(mrRaw)
 		multiRegionEnabled = mrParser.GetBool("enabled", false)
+		multiRegionRegions = mrParser.GetStringSlice("regions", nil)
 	}
 
-	return &Config{
+	// Parse endpoint overrides
+	endpointsParser := helpers.NewConfigParser(parser.GetMap("endpoints"))
+	endpoints := Endpoints{
+		TokenInfo:        endpointsParser.GetString("tokeninfo", "", defaultTokenInfoEndpoint),
+		Token:            endpointsParser.GetString("token", "", ""),
+		ArtifactRegistry: endpointsParser.GetString("artifact_registry", "", defaultArtifactRegistryEndpoint),
+		Storage:          endpointsParser.GetString("storage", "", defaultStorageEndpoint),
+		SecretManager:    endpointsParser.GetString("secret_manager", "", defaultSecretManagerEndpoint),
+		IAM:              endpointsParser.GetString("iam", "", defaultIAMEndpoint),
+		Registry:         endpointsParser.GetString("registry", "", ""),
+	}
+
+	// Parse nested preflight config
+	preflightParser := helpers.NewConfigParser(parser.GetMap("preflight"))
+
+	// Parse nested staging config
+	stagingParser := helpers.NewConfigParser(parser.GetMap("staging"))
+
+	// Parse nested cleanup config
+	cleanupParser := helpers.NewConfigParser(parser.GetMap("cleanup"))
+
+	// Parse nested ensure_repository config
+	ensureRaw := parser.GetMap("ensure_repository")
+	ensureParser := helpers.NewConfigParser(ensureRaw)
+
+	artifactRegistry := parser.GetBool("artifact_registry", true)
+
+	cfg := &Config{
 		// GCP Configuration
-		ArtifactRegistry: parser.GetBool("artifact_registry", true),
+		ArtifactRegistry: artifactRegistry,
 		Project:          parser.GetString("project", "CLOUDSDK_CORE_PROJECT", ""),
-		Region:           parser.GetString("region", "", "us-central1"),
+		Region:           parser.GetString("region", "", defaultRegion(artifactRegistry)),
+		regionSet:        parser.GetString("region", "", "") != "",
 		Repository:       parser.GetString("repository", "", ""),
 		Image:            parser.GetString("image", "", ""),
 
 		// Authentication
-		AuthMethod: authMethod,
-		KeyFile:    keyFile,
-		KeyJSON:    keyJSON,
+		AuthMethod:      authMethod,
+		KeyFile:         keyFile,
+		KeyJSON:         keyJSON,
+		AccessToken:     accessToken,
+		AccessTokenFile: accessTokenFile,
+		secrets:         make(map[string]string),
+		KeyWarnAgeDays:  keyWarnAgeDays,
+		KeyMaxAgeDays:   keyMaxAgeDays,
 
 		// Source image
 		SourceImage: parser.GetString("source_image", "", ""),
@@ -230,13 +930,55 @@ func (p *GCRPlugin) parseConfig(raw map[string]any) *Config {
 		// Tags
 		Tags: tags,
 
+		// Images
+		Images: parseImages(raw),
+
+		// Targets
+		Targets: parseTargets(raw),
+
+		// Release filters
+		Only:   parseReleaseFilter(parser.GetMap("only")),
+		Except: parseReleaseFilter(parser.GetMap("except")),
+
+		// Staging
+		StagingEnabled:    stagingParser.GetBool("enabled", false),
+		StagingRepository: stagingParser.GetString("repository", "", ""),
+		StagingTag:        stagingParser.GetString("tag", "", defaultStagingTag),
+
+		// Cleanup
+		CleanupOnError:    cleanupParser.GetBool("on_error", false),
+		CleanupRecordFile: cleanupParser.GetString("record_file", "", defaultPushRecordFile),
+		Transactional:     parser.GetBool("transactional", false),
+
+		// Repository creation
+		EnsureRepository:   ensureParser.GetBool("enabled", false),
+		RepositorySettings: parseRepositorySettings(ensureRaw),
+
+		// Retention
+		Retention: parseRetentionPolicy(parser.GetMap("retention")),
+
+		// Garbage collection
+		GC: parseGCPolicy(parser.GetMap("garbage_collection")),
+
 		// Multi-region
 		MultiRegionEnabled: multiRegionEnabled,
 		MultiRegionRegions: multiRegionRegions,
 
+		// Pre-flight checks
+		PreflightIAM:         preflightParser.GetBool("iam", false),
+		PreflightSourceImage: preflightParser.GetBool("source_image", false),
+		PullSourceImage:      preflightParser.GetBool("pull_source_image", false),
+
+		// API endpoints
+		Endpoints: endpoints,
+
 		// Behavior
 		DryRun: parser.GetBool("dry_run", false),
 	}
+
+	// Migration defaults to the GCR project and matching multi-region
+	cfg.Migration = parseMigrationConfig(parser.GetMap("migrate"), cfg.Project, cfg.Region)
+	return cfg
 }
 
 // processTags processes tag templates with release context.
@@ -253,6 +995,15 @@ func (p *GCRPlugin) processTags(tags []string, ctx *plugin.ReleaseContext) []str
 	return processed
 }
 
+// releaseTags returns the tags the release pushes, across every image.
+func (p *GCRPlugin) releaseTags(cfg *Config, ctx *plugin.ReleaseContext) []string {
+	var tags []string
+	for _, image := range cfg.images() {
+		tags = append(tags, p.processTags(image.Tags, ctx)...)
+	}
+	return tags
+}
+
 // processTemplate replaces template variables with actual values.
 func (p *GCRPlugin) processTemplate(tmpl string, ctx *plugin.ReleaseContext) string {
 	result := tmpl
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
@@ -36,6 +39,10 @@ func TestGetInfo(t *testing.T) {
 }
 
 func TestValidate(t *testing.T) {
+	keyJSON := testServiceAccountKeyJSON(t, testServiceAccountKey(t, "my-project"))
+	keyFile := writeTestKeyFile(t, keyJSON, 0o600)
+	openKeyFile := writeTestKeyFile(t, keyJSON, 0o644)
+
 	tests := []struct {
 		name       string
 		config     map[string]any
@@ -119,6 +126,33 @@ func TestValidate(t *testing.T) {
 			},
 			wantErrors: 1,
 		},
+		{
+			name: "access token without token",
+			config: map[string]any{
+				"project":      "my-project",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"repository":   "my-repo",
+				"auth": map[string]any{
+					"method": "access_token",
+				},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "valid config with access token file",
+			config: map[string]any{
+				"project":      "my-project",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"repository":   "my-repo",
+				"auth": map[string]any{
+					"method":            "access_token",
+					"access_token_file": "/path/to/token",
+				},
+			},
+			wantErrors: 0,
+		},
 		{
 			name: "valid config with gcloud auth",
 			config: map[string]any{
@@ -141,11 +175,81 @@ func TestValidate(t *testing.T) {
 				"repository":   "my-repo",
 				"auth": map[string]any{
 					"method":   "service_account",
-					"key_file": "/path/to/key.json",
+					"key_file": keyFile,
 				},
 			},
 			wantErrors: 0,
 		},
+		{
+			name: "valid config with service account key json",
+			config: map[string]any{
+				"project":      "my-project",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"repository":   "my-repo",
+				"auth": map[string]any{
+					"method":   "service_account",
+					"key_json": keyJSON,
+				},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "service account key file missing",
+			config: map[string]any{
+				"project":      "my-project",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"repository":   "my-repo",
+				"auth": map[string]any{
+					"method":   "service_account",
+					"key_file": "/path/to/missing-key.json",
+				},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "service account key file world readable",
+			config: map[string]any{
+				"project":      "my-project",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"repository":   "my-repo",
+				"auth": map[string]any{
+					"method":   "service_account",
+					"key_file": openKeyFile,
+				},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "truncated service account key json",
+			config: map[string]any{
+				"project":      "my-project",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"repository":   "my-repo",
+				"auth": map[string]any{
+					"method":   "service_account",
+					"key_json": keyJSON[:len(keyJSON)/2],
+				},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "service account key with wrong type",
+			config: map[string]any{
+				"project":      "my-project",
+				"image":        "my-app",
+				"source_image": "myapp:latest",
+				"repository":   "my-repo",
+				"auth": map[string]any{
+					"method":   "service_account",
+					"key_json": `{"type": "authorized_user"}`,
+				},
+			},
+			wantErrors: 5, // type, project_id, client_email, private_key_id, private_key
+		},
 		{
 			name: "valid legacy GCR config",
 			config: map[string]any{
@@ -226,6 +330,10 @@ func TestParseConfig(t *testing.T) {
 		t.Errorf("expected 2 tags, got %d", len(cfg.Tags))
 	}
 
+	if len(cfg.MultiRegionRegions) != 3 || cfg.MultiRegionRegions[1] != "europe" {
+		t.Errorf("expected multi_region regions [us europe asia], got %v", cfg.MultiRegionRegions)
+	}
+
 	if !cfg.DryRun {
 		t.Error("expected dry_run to be true")
 	}
@@ -364,3 +472,87 @@ func TestProcessTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteUsesIsolatedDockerConfig(t *testing.T) {
+	logPath := installFakeCommands(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("DOCKER_CONFIG", "")
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":      "my-project",
+			"repository":   "my-repo",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+			"tags":         []string{"{{.Version}}", "latest"},
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Success {
+		t.Fatalf("expected success, got %+v", resp)
+	}
+
+	lines := readFakeCommandLog(t, logPath)
+	if len(lines) != 5 {
+		t.Fatalf("expected auth plus tag/push per tag, got %v", lines)
+	}
+
+	configDir := ""
+	for _, line := range lines {
+		idx := strings.LastIndex(line, "DOCKER_CONFIG=")
+		dir := line[idx+len("DOCKER_CONFIG="):]
+		if dir == "" {
+			t.Fatalf("expected DOCKER_CONFIG to be set: %s", line)
+		}
+		if configDir != "" && dir != configDir {
+			t.Errorf("expected a single DOCKER_CONFIG per run, got %s and %s", configDir, dir)
+		}
+		configDir = dir
+	}
+
+	if strings.HasPrefix(configDir, home) {
+		t.Errorf("expected DOCKER_CONFIG outside of HOME, got %s", configDir)
+	}
+	if _, err := os.Stat(configDir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed after execution", configDir)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".docker")); !os.IsNotExist(err) {
+		t.Error("expected ~/.docker to be left untouched")
+	}
+}
+
+func TestExecuteRemovesDockerConfigOnFailure(t *testing.T) {
+	logPath := installFakeCommands(t)
+	t.Setenv("FAKE_COMMAND_FAIL", "push")
+
+	p := &GCRPlugin{}
+	_, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":      "my-project",
+			"repository":   "my-repo",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err == nil {
+		t.Fatal("expected push failure")
+	}
+
+	lines := readFakeCommandLog(t, logPath)
+	if len(lines) == 0 {
+		t.Fatal("expected commands to run")
+	}
+	last := lines[len(lines)-1]
+	configDir := last[strings.LastIndex(last, "DOCKER_CONFIG=")+len("DOCKER_CONFIG="):]
+	if _, err := os.Stat(configDir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed after failure", configDir)
+	}
+}
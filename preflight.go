@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// prePublish runs the enabled pre-flight checks and stages images, so that
+// a release which cannot be pushed is stopped before it is published.
+func (p *GCRPlugin) prePublish(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, redactor *Redactor) (*plugin.ExecuteResponse, error) {
+	if !cfg.PreflightIAM && !cfg.checksSourceImages() && !cfg.StagingEnabled {
+		return &plugin.ExecuteResponse{
+			Success: true,
+			Message: "No pre-publish checks enabled",
+		}, nil
+	}
+
+	outputs := map[string]any{}
+
+	if cfg.checksSourceImages() {
+		sources, err := p.resolveSourceImages(ctx, cfg, cfg.PullSourceImage, false)
+		if err != nil {
+			return nil, err
+		}
+		printSourceImages(redactor, sources)
+		outputs["source_images"] = sourceImageOutputs(sources)
+	}
+
+	if cfg.PreflightIAM {
+		results, err := p.prePublishPermissions(ctx, req, cfg, redactor)
+		if err != nil {
+			return nil, err
+		}
+		outputs["permission_checks"] = results
+	}
+
+	message := "Pre-flight checks passed"
+	if cfg.StagingEnabled {
+		staged, err := p.stage(ctx, req, cfg, redactor)
+		if err != nil {
+			return nil, err
+		}
+		outputs["staged_images"] = staged
+		message = fmt.Sprintf("Staged %d image(s) for promotion", len(staged))
+	}
+
+	return &plugin.ExecuteResponse{
+		Success: true,
+		Message: message,
+		Outputs: outputs,
+	}, nil
+}
+
+// prePublishPermissions checks push permissions on every target.
+func (p *GCRPlugin) prePublishPermissions(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, redactor *Redactor) ([]map[string]any, error) {
+	var checks []*PermissionCheck
+	targets := 0
+	for _, target := range cfg.targets() {
+		// Targets this release is not pushed to need no permissions
+		if target.skipReason(&req.Context) != "" {
+			continue
+		}
+		targets++
+
+		if err := resolveSecrets(ctx, target, redactor); err != nil {
+			return nil, err
+		}
+
+		targetChecks, err := p.checkPermissions(ctx, target, NewCredentialManager(target.authConfig(), "", target.Endpoints))
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, targetChecks...)
+	}
+
+	if missing := formatMissingPermissions(checks); missing != "" {
+		return nil, fmt.Errorf("missing permissions:\n%s", missing)
+	}
+
+	results := make([]map[string]any, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, map[string]any{
+			"region":   check.Region,
+			"resource": check.Resource,
+			"identity": check.Identity,
+		})
+	}
+
+	redactor.Printf("Pre-flight IAM check passed for %d repository location(s) across %d target(s)\n", len(checks), targets)
+	return results, nil
+}
+
+// checkPermissions tests push permissions for every target repository and region.
+func (p *GCRPlugin) checkPermissions(ctx context.Context, cfg *Config, credentials *CredentialManager) ([]*PermissionCheck, error) {
+	regions := cfg.regions()
+	repositories := cfg.repositories()
+	if !cfg.ArtifactRegistry {
+		// Legacy GCR permissions are per bucket, not per repository.
+		repositories = repositories[:1]
+	}
+	checks := make([]*PermissionCheck, 0, len(regions)*len(repositories))
+
+	for _, repository := range repositories {
+		for _, region := range regions {
+			config := cfg.gcrConfig(region, "", credentials)
+			config.Repository = repository
+			check, err := NewGCRClient(config).CheckPermissions(ctx, region)
+			if err != nil {
+				return nil, fmt.Errorf("pre-flight check for %s failed: %w", region, err)
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	return checks, nil
+}
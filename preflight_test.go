@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+func TestPrePublishWithoutChecks(t *testing.T) {
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPrePublish,
+		Config: map[string]any{
+			"project":      "my-project",
+			"repository":   "my-repo",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Success {
+		t.Errorf("expected success, got %+v", resp)
+	}
+}
+
+func TestPrePublishIAMCheck(t *testing.T) {
+	key := testServiceAccountKey(t, "my-project")
+
+	tests := []struct {
+		name        string
+		granted     []string
+		wantErr     bool
+		wantMessage string
+	}{
+		{
+			name:    "all permissions granted",
+			granted: artifactRegistryPushPermissions,
+		},
+		{
+			name:        "upload permission missing",
+			granted:     []string{"artifactregistry.repositories.downloadArtifacts"},
+			wantErr:     true,
+			wantMessage: "europe-west1 (projects/my-project/locations/europe-west1/repositories/my-repo): ci@my-project.iam.gserviceaccount.com lacks artifactregistry.repositories.uploadArtifacts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeGoogleAPI(t)
+			grantPermissions(api, "sa-token", tt.granted...)
+
+			p := &GCRPlugin{}
+			resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+				Hook: plugin.HookPrePublish,
+				Config: map[string]any{
+					"project":      "my-project",
+					"repository":   "my-repo",
+					"image":        "my-app",
+					"source_image": "myapp:latest",
+					"auth": map[string]any{
+						"method":   "service_account",
+						"key_json": testServiceAccountKeyJSON(t, key),
+					},
+					"multi_region": map[string]any{
+						"enabled": true,
+						"regions": []string{"us-central1", "europe-west1"},
+					},
+					"preflight": map[string]any{"iam": true},
+					"endpoints": api.EndpointsConfig(),
+				},
+			})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if !strings.Contains(err.Error(), tt.wantMessage) {
+					t.Errorf("expected error to contain '%s', got '%s'", tt.wantMessage, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checks, _ := resp.Outputs["permission_checks"].([]map[string]any)
+			if len(checks) != 2 {
+				t.Errorf("expected a check per region, got %v", resp.Outputs)
+			}
+		})
+	}
+}
+
+func TestValidateRunsIAMCheck(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	grantPermissions(api, "good-token")
+
+	p := &GCRPlugin{}
+	resp, err := p.Validate(context.Background(), map[string]any{
+		"project":      "my-project",
+		"repository":   "my-repo",
+		"image":        "my-app",
+		"source_image": "myapp:latest",
+		"auth": map[string]any{
+			"method":       "access_token",
+			"access_token": "good-token",
+		},
+		"preflight": map[string]any{"iam": true},
+		"endpoints": api.EndpointsConfig(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(resp.Errors) != 1 || resp.Errors[0].Field != "preflight.iam" {
+		t.Fatalf("expected a preflight.iam error, got %v", resp.Errors)
+	}
+	if !strings.Contains(resp.Errors[0].Message, "artifactregistry.repositories.uploadArtifacts") {
+		t.Errorf("expected missing permission in message, got '%s'", resp.Errors[0].Message)
+	}
+}
+
+func TestValidateIAMCheckNamesTarget(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	grantPermissions(api, "good-token", artifactRegistryPushPermissions...)
+
+	p := &GCRPlugin{}
+	resp, err := p.Validate(context.Background(), map[string]any{
+		"project":      "my-project",
+		"repository":   "my-repo",
+		"image":        "my-app",
+		"source_image": "myapp:latest",
+		"auth": map[string]any{
+			"method":       "access_token",
+			"access_token": "good-token",
+		},
+		"preflight": map[string]any{"iam": true},
+		"endpoints": api.EndpointsConfig(),
+		"targets": []any{
+			map[string]any{"name": "prod"},
+			map[string]any{
+				"name": "partner",
+				"auth": map[string]any{"method": "access_token", "access_token": "partner-token"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(resp.Errors) != 1 || resp.Errors[0].Field != "targets[1].preflight.iam" {
+		t.Errorf("expected a targets[1].preflight.iam error, got %v", resp.Errors)
+	}
+}
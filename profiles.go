@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// profileEnv selects a profile when the configuration does not name one.
+const profileEnv = "RELICTA_GCR_PROFILE"
+
+// profileKeys are the top-level keys a profile may not override.
+var profileKeys = []string{"profile", "profiles"}
+
+// profiles returns the raw "profiles" block.
+func profiles(raw map[string]any) map[string]any {
+	profiles, _ := raw["profiles"].(map[string]any)
+	return profiles
+}
+
+// profileNames returns the configured profile names in sorted order.
+func profileNames(raw map[string]any) []string {
+	names := make([]string, 0, len(profiles(raw)))
+	for name := range profiles(raw) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectProfile picks the profile for a release: the one named by "profile"
+// or RELICTA_GCR_PROFILE, otherwise the single profile whose match block the
+// release satisfies. Without a release, only an explicit profile is selected.
+func selectProfile(raw map[string]any, release *plugin.ReleaseContext) (name, reason string, err error) {
+	if name, ok := raw["profile"].(string); ok && name != "" {
+		return name, "selected by profile", checkProfileName(raw, name)
+	}
+	if name := os.Getenv(profileEnv); name != "" {
+		return name, "selected by " + profileEnv, checkProfileName(raw, name)
+	}
+	if release == nil {
+		return "", "", nil
+	}
+
+	var matched []string
+	for _, name := range profileNames(raw) {
+		profile, _ := profiles(raw)[name].(map[string]any)
+		match := parseReleaseFilter(helpers.NewConfigParser(profile).GetMap("match"))
+		if match != nil && match.matchesAll(release) {
+			matched = append(matched, name)
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return "", "", nil
+	case 1:
+		return matched[0], fmt.Sprintf("matched branch '%s', %s, version %s",
+			release.Branch, describeReleaseType(release), release.Version), nil
+	default:
+		return "", "", fmt.Errorf("release matches several profiles ('%s'); set profile to choose one", strings.Join(matched, "', '"))
+	}
+}
+
+// checkProfileName reports an explicitly selected profile that does not exist.
+func checkProfileName(raw map[string]any, name string) error {
+	if _, ok := profiles(raw)[name]; ok {
+		return nil
+	}
+	known := profileNames(raw)
+	if len(known) == 0 {
+		return fmt.Errorf("unknown profile '%s'; no profiles are configured", name)
+	}
+	return fmt.Errorf("unknown profile '%s'; must be one of %s", name, quoteList(known))
+}
+
+// mergeProfile returns the raw configuration with the named profile merged
+// on top. Objects are merged key by key; lists and values are replaced.
+func mergeProfile(raw map[string]any, name string) map[string]any {
+	base := make(map[string]any, len(raw))
+	for key, value := range raw {
+		if !containsString(profileKeys, key) {
+			base[key] = value
+		}
+	}
+
+	profile, ok := profiles(raw)[name].(map[string]any)
+	if !ok {
+		return base
+	}
+	overrides := make(map[string]any, len(profile))
+	for key, value := range profile {
+		if key != "match" && !containsString(profileKeys, key) {
+			overrides[key] = value
+		}
+	}
+	return mergeMaps(base, overrides)
+}
+
+// mergeMaps returns base with override applied, without modifying either.
+func mergeMaps(base, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseObj, baseOK := merged[key].(map[string]any)
+		overrideObj, overrideOK := value.(map[string]any)
+		if baseOK && overrideOK {
+			merged[key] = mergeMaps(baseObj, overrideObj)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// validateProfiles checks every profile's overrides against the top-level
+// schema and that an explicitly selected profile exists.
+func validateProfiles(vb *helpers.ValidationBuilder, raw map[string]any) {
+	for _, name := range profileNames(raw) {
+		profile, ok := profiles(raw)[name].(map[string]any)
+		if !ok {
+			// Reported by the schema
+			continue
+		}
+
+		path := "profiles." + name
+		overrides := make(map[string]any, len(profile))
+		for key, value := range profile {
+			switch {
+			case key == "match":
+			case containsString(profileKeys, key):
+				vb.AddError(path+"."+key, fmt.Sprintf("profiles cannot set '%s'", key))
+			default:
+				overrides[key] = value
+			}
+		}
+		parsedConfigSchema.validateObject(vb, parsedConfigSchema, path, overrides)
+	}
+
+	if _, _, err := selectProfile(raw, nil); err != nil {
+		vb.AddError("profile", err.Error())
+	}
+}
+
+// configVariant is one configuration a release may run with.
+type configVariant struct {
+	prefix string
+	cfg    *Config
+}
+
+// configVariants returns the configurations to validate: the configuration
+// itself when a profile is selected explicitly or none are configured,
+// otherwise the base settings on their own, for releases no profile matches,
+// and merged with each profile.
+func (p *GCRPlugin) configVariants(raw map[string]any, cfg *Config) []configVariant {
+	names := profileNames(raw)
+	if cfg.Profile != "" || len(names) == 0 {
+		return []configVariant{{cfg: cfg}}
+	}
+
+	variants := make([]configVariant, 0, len(names)+1)
+	variants = append(variants, configVariant{cfg: cfg})
+	for _, name := range names {
+		variant := p.parseSettings(mergeProfile(raw, name))
+		variant.Profile = name
+		variants = append(variants, configVariant{prefix: "profiles." + name + ".", cfg: variant})
+	}
+	return variants
+}
+
+// validateVariants runs check against every variant, adding its redacted
+// errors to vb with the variant's field prefix.
+func validateVariants(vb *helpers.ValidationBuilder, variants []configVariant, check func(*helpers.ValidationBuilder, *Config, *Redactor)) {
+	for _, variant := range variants {
+		redactor := newConfigRedactor(variant.cfg)
+		variantVB := helpers.NewValidationBuilder()
+		check(variantVB, variant.cfg, redactor)
+		for _, e := range redactor.ValidateResponse(variantVB.Build()).Errors {
+			vb.AddError(variant.prefix+e.Field, e.Message)
+		}
+	}
+}
+
+// printProfile reports the profile a release runs with.
+func printProfile(redactor *Redactor, cfg *Config) {
+	if cfg.Profile == "" {
+		return
+	}
+	prefix := ""
+	if cfg.DryRun {
+		prefix = "[dry-run] "
+	}
+	redactor.Printf("%sUsing profile %s (%s)\n", prefix, cfg.Profile, cfg.profileReason)
+}
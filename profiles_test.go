@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+func profilesConfig() map[string]any {
+	return map[string]any{
+		"project":      "prod-project",
+		"repository":   "releases",
+		"image":        "my-app",
+		"source_image": "myapp:latest",
+		"auth":         map[string]any{"method": "access_token", "access_token": "good-token"},
+		"profiles": map[string]any{
+			"staging": map[string]any{
+				"match":   map[string]any{"branches": []any{"develop", "feature/*"}},
+				"project": "staging-project",
+				"auth":    map[string]any{"access_token": "sa-token"},
+			},
+			"hotfix": map[string]any{
+				"match":      map[string]any{"branches": []any{"hotfix/*"}},
+				"repository": "hotfixes",
+			},
+		},
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	tests := []struct {
+		name        string
+		profile     string
+		env         string
+		release     *plugin.ReleaseContext
+		wantProfile string
+		wantErr     string
+	}{
+		{
+			name:        "matched by branch",
+			release:     &plugin.ReleaseContext{Branch: "feature/login", Version: "1.2.0"},
+			wantProfile: "staging",
+		},
+		{
+			name:    "no match uses base",
+			release: &plugin.ReleaseContext{Branch: "main", Version: "1.2.0"},
+		},
+		{
+			name:        "explicit profile wins over match",
+			profile:     "hotfix",
+			release:     &plugin.ReleaseContext{Branch: "develop", Version: "1.2.0"},
+			wantProfile: "hotfix",
+		},
+		{
+			name:        "environment selects profile",
+			env:         "staging",
+			release:     &plugin.ReleaseContext{Branch: "main", Version: "1.2.0"},
+			wantProfile: "staging",
+		},
+		{
+			name:        "unknown explicit profile",
+			profile:     "prod",
+			wantProfile: "prod",
+			wantErr:     "unknown profile 'prod'; must be one of 'hotfix' or 'staging'",
+		},
+		{
+			name:        "no release selects nothing",
+			wantProfile: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(profileEnv, tt.env)
+			raw := profilesConfig()
+			if tt.profile != "" {
+				raw["profile"] = tt.profile
+			}
+
+			name, _, err := selectProfile(raw, tt.release)
+			if name != tt.wantProfile {
+				t.Errorf("expected profile '%s', got '%s'", tt.wantProfile, name)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("expected error '%s', got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSelectProfileAmbiguous(t *testing.T) {
+	t.Setenv(profileEnv, "")
+	raw := profilesConfig()
+	profiles(raw)["hotfix"].(map[string]any)["match"] = map[string]any{"branches": []any{"*"}}
+
+	_, _, err := selectProfile(raw, &plugin.ReleaseContext{Branch: "develop"})
+	if err == nil || !strings.Contains(err.Error(), "release matches several profiles ('hotfix', 'staging')") {
+		t.Errorf("expected ambiguous profile error, got %v", err)
+	}
+}
+
+func TestParseReleaseConfigMergesProfile(t *testing.T) {
+	t.Setenv(profileEnv, "")
+	p := &GCRPlugin{}
+	raw := profilesConfig()
+
+	cfg := p.parseReleaseConfig(raw, &plugin.ReleaseContext{Branch: "develop"})
+	if cfg.Profile != "staging" || cfg.Project != "staging-project" {
+		t.Errorf("expected staging project from profile, got profile '%s' project '%s'", cfg.Profile, cfg.Project)
+	}
+	// Nested objects are merged, so the base auth method is kept.
+	if cfg.AuthMethod != "access_token" || cfg.AccessToken != "sa-token" {
+		t.Errorf("expected merged auth, got method '%s' token '%s'", cfg.AuthMethod, cfg.AccessToken)
+	}
+	if cfg.Repository != "releases" {
+		t.Errorf("expected base repository, got '%s'", cfg.Repository)
+	}
+
+	// The raw configuration is not modified by merging.
+	if raw["project"] != "prod-project" || raw["auth"].(map[string]any)["access_token"] != "good-token" {
+		t.Errorf("expected raw configuration to be unchanged, got %v", raw)
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(raw map[string]any)
+		wantFields []string
+	}{
+		{
+			name:   "valid profiles",
+			modify: func(raw map[string]any) {},
+		},
+		{
+			name: "unknown key in profile",
+			modify: func(raw map[string]any) {
+				profiles(raw)["staging"].(map[string]any)["projet"] = "x"
+			},
+			wantFields: []string{"profiles.staging.projet"},
+		},
+		{
+			name: "nested profiles",
+			modify: func(raw map[string]any) {
+				profiles(raw)["staging"].(map[string]any)["profiles"] = map[string]any{}
+			},
+			wantFields: []string{"profiles.staging.profiles"},
+		},
+		{
+			name: "invalid merged settings",
+			modify: func(raw map[string]any) {
+				profiles(raw)["hotfix"].(map[string]any)["repository"] = "Hotfixes!"
+			},
+			wantFields: []string{"profiles.hotfix.repository"},
+		},
+		{
+			name: "base settings incomplete for releases no profile matches",
+			modify: func(raw map[string]any) {
+				delete(raw, "project")
+				profiles(raw)["hotfix"].(map[string]any)["project"] = "hotfix-project"
+			},
+			wantFields: []string{"project"},
+		},
+		{
+			name: "unknown explicit profile",
+			modify: func(raw map[string]any) {
+				raw["profile"] = "prod"
+			},
+			wantFields: []string{"profile"},
+		},
+	}
+
+	p := &GCRPlugin{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(profileEnv, "")
+			raw := profilesConfig()
+			tt.modify(raw)
+
+			resp, err := p.Validate(context.Background(), raw)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var fields []string
+			for _, e := range resp.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestExecuteDryRunShowsProfile(t *testing.T) {
+	t.Setenv(profileEnv, "")
+	p := &GCRPlugin{}
+
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook:    plugin.HookPostPublish,
+		Config:  profilesConfig(),
+		Context: plugin.ReleaseContext{Branch: "hotfix/cve", Version: "1.2.4"},
+		DryRun:  true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.Outputs["profile"] != "hotfix" {
+		t.Errorf("expected profile output 'hotfix', got %v", resp.Outputs["profile"])
+	}
+	expected := []string{"us-central1-docker.pkg.dev/prod-project/hotfixes/my-app:1.2.4"}
+	if !reflect.DeepEqual(resp.Outputs["pushed_images"], expected) {
+		t.Errorf("expected pushed images %v, got %v", expected, resp.Outputs["pushed_images"])
+	}
+}
+
+func TestPrintProfile(t *testing.T) {
+	var out bytes.Buffer
+	redactor := &Redactor{out: &out}
+
+	printProfile(redactor, &Config{})
+	printProfile(redactor, &Config{Profile: "staging", profileReason: "selected by profile", DryRun: true})
+
+	if got := out.String(); got != "[dry-run] Using profile staging (selected by profile)\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
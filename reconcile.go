@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+)
+
+// maxCleanupPolicies is the number of cleanup policies Artifact Registry
+// accepts per repository.
+const maxCleanupPolicies = 10
+
+// CleanupPolicyConfig is a cleanup policy as written in the configuration.
+type CleanupPolicyConfig struct {
+	ID          string
+	Action      string
+	TagState    string
+	TagPrefixes []string
+	OlderThan   string
+	KeepCount   int
+
+	// TagPattern is a regular expression of tags to keep. Artifact Registry
+	// only matches tags by prefix, so the plugin resolves the pattern against
+	// the repository's tags and keeps the matches by their literal names.
+	TagPattern string
+	pattern    *regexp.Regexp
+}
+
+// CleanupPolicy is an Artifact Registry cleanup policy as sent to its REST API.
+type CleanupPolicy struct {
+	ID                 string                           `json:"id"`
+	Action             string                           `json:"action"`
+	Condition          *CleanupPolicyCondition          `json:"condition,omitempty"`
+	MostRecentVersions *CleanupPolicyMostRecentVersions `json:"mostRecentVersions,omitempty"`
+}
+
+// CleanupPolicyCondition selects the versions a policy applies to.
+type CleanupPolicyCondition struct {
+	TagState    string   `json:"tagState,omitempty"`
+	TagPrefixes []string `json:"tagPrefixes,omitempty"`
+	OlderThan   string   `json:"olderThan,omitempty"`
+}
+
+// CleanupPolicyMostRecentVersions keeps the newest versions of each package.
+type CleanupPolicyMostRecentVersions struct {
+	KeepCount int `json:"keepCount,omitempty"`
+}
+
+// parseCleanupPolicies parses the "cleanup_policies" list. A missing list
+// leaves the repository's policies unmanaged; an empty one removes them all.
+func parseCleanupPolicies(raw map[string]any) []CleanupPolicyConfig {
+	list, ok := raw["cleanup_policies"].([]any)
+	if !ok {
+		return nil
+	}
+
+	policies := make([]CleanupPolicyConfig, 0, len(list))
+	for _, item := range list {
+		entry, _ := item.(map[string]any)
+		parser := helpers.NewConfigParser(entry)
+		policy := CleanupPolicyConfig{
+			ID:          parser.GetString("id", "", ""),
+			Action:      strings.ToUpper(parser.GetString("action", "", "")),
+			TagState:    strings.ToUpper(parser.GetString("tag_state", "", "")),
+			TagPrefixes: parser.GetStringSlice("tag_prefixes", nil),
+			OlderThan:   parser.GetString("older_than", "", ""),
+			KeepCount:   parser.GetInt("keep_count", 0),
+			TagPattern:  parser.GetString("tag_pattern", "", ""),
+		}
+		// Invalid patterns match nothing; validation reports them
+		if policy.TagPattern != "" {
+			policy.pattern, _ = regexp.Compile(policy.TagPattern)
+		}
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+// hasTagPatterns reports whether any cleanup policy keeps tags by pattern.
+func (s RepositorySettings) hasTagPatterns() bool {
+	for _, policy := range s.CleanupPolicies {
+		if policy.pattern != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// pin returns the ID of the first cleanup policy whose tag_pattern keeps tag.
+func (s RepositorySettings) pin(tag string) (string, bool) {
+	for _, policy := range s.CleanupPolicies {
+		if policy.pattern != nil && policy.pattern.MatchString(tag) {
+			return policy.ID, true
+		}
+	}
+	return "", false
+}
+
+// pinnedTags returns the tags each tag_pattern policy keeps, by policy ID.
+func (s RepositorySettings) pinnedTags(tags []string) map[string][]string {
+	pinned := make(map[string][]string)
+	for _, policy := range s.CleanupPolicies {
+		if policy.pattern == nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, tag := range tags {
+			if !seen[tag] && policy.pattern.MatchString(tag) {
+				seen[tag] = true
+				pinned[policy.ID] = append(pinned[policy.ID], tag)
+			}
+		}
+		sort.Strings(pinned[policy.ID])
+	}
+	return pinned
+}
+
+// listPinnedTags returns the tags the tag_pattern policies keep in the
+// repository of client: those of the target's images in it and pending, the
+// tags the release is about to push.
+func (p *GCRPlugin) listPinnedTags(ctx context.Context, cfg *Config, client *GCRClient, pending []string) (map[string][]string, error) {
+	settings := cfg.RepositorySettings
+	if !settings.hasTagPatterns() {
+		return nil, nil
+	}
+
+	tags := append([]string(nil), pending...)
+	registry := client.Registry()
+	for _, image := range cfg.images() {
+		if image.Repository != client.config.Repository {
+			continue
+		}
+		list, err := registry.ListTags(ctx, client.RepositoryPath(image.Image))
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", client.GetImagePath(image.Image), err)
+		}
+		tags = append(tags, list.Tags...)
+	}
+	return settings.pinnedTags(tags), nil
+}
+
+// policy converts the configured policy to its API form.
+func (c CleanupPolicyConfig) policy() (CleanupPolicy, error) {
+	policy := CleanupPolicy{ID: c.ID, Action: c.Action}
+	if c.KeepCount > 0 {
+		policy.MostRecentVersions = &CleanupPolicyMostRecentVersions{KeepCount: c.KeepCount}
+		return policy, nil
+	}
+
+	condition := &CleanupPolicyCondition{TagState: c.TagState, TagPrefixes: c.TagPrefixes}
+	if c.OlderThan != "" {
+		age, err := parseAge(c.OlderThan)
+		if err != nil {
+			return policy, err
+		}
+		condition.OlderThan = fmt.Sprintf("%ds", int64(age.Seconds()))
+	}
+	policy.Condition = condition
+	return policy, nil
+}
+
+// parseAge parses a Go duration or a number of days such as "30d".
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid age '%s'; use a number of days such as 30d or a duration such as 72h", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid age '%s'; use a number of days such as 30d or a duration such as 72h", value)
+	}
+	return age, nil
+}
+
+// desired returns the managed settings as a repository, keeping the pinned
+// tags of tag_pattern policies. Invalid cleanup policies, and tag_pattern
+// policies that match no tag, are left out; validation reports the former.
+func (s RepositorySettings) desired(pinned map[string][]string) Repository {
+	repository := Repository{
+		Description: s.Description,
+		Labels:      s.Labels,
+	}
+	if s.ImmutableTags != nil {
+		repository.DockerConfig = &repositoryDockerConfig{ImmutableTags: *s.ImmutableTags}
+	}
+	if s.CleanupPolicies != nil {
+		repository.CleanupPolicies = make(map[string]CleanupPolicy, len(s.CleanupPolicies))
+		for _, config := range s.CleanupPolicies {
+			if config.TagPattern != "" {
+				// A keep policy without tags would keep every tagged version
+				if tags := pinned[config.ID]; len(tags) > 0 {
+					repository.CleanupPolicies[config.ID] = CleanupPolicy{
+						ID:        config.ID,
+						Action:    "KEEP",
+						Condition: &CleanupPolicyCondition{TagState: "TAGGED", TagPrefixes: tags},
+					}
+				}
+				continue
+			}
+			if policy, err := config.policy(); err == nil {
+				repository.CleanupPolicies[policy.ID] = policy
+			}
+		}
+	}
+	return repository
+}
+
+// diffRepository compares a live repository with the managed settings and
+// returns the changes, one line each, and the update mask that applies them.
+func diffRepository(current *Repository, settings RepositorySettings, pinned map[string][]string) ([]string, []string) {
+	desired := settings.desired(pinned)
+	var changes, mask []string
+
+	if settings.Description != "" && current.Description != desired.Description {
+		changes = append(changes, fmt.Sprintf("description: %q -> %q", current.Description, desired.Description))
+		mask = append(mask, "description")
+	}
+
+	if settings.Labels != nil {
+		labelChanges := diffKeys("labels", current.Labels, desired.Labels, func(from, to *string) string {
+			switch {
+			case from == nil:
+				return fmt.Sprintf("added %q", *to)
+			case to == nil:
+				return fmt.Sprintf("removed %q", *from)
+			default:
+				return fmt.Sprintf("%q -> %q", *from, *to)
+			}
+		})
+		if len(labelChanges) > 0 {
+			changes = append(changes, labelChanges...)
+			mask = append(mask, "labels")
+		}
+	}
+
+	if settings.ImmutableTags != nil {
+		immutable := current.DockerConfig != nil && current.DockerConfig.ImmutableTags
+		if immutable != *settings.ImmutableTags {
+			changes = append(changes, fmt.Sprintf("immutable_tags: %v -> %v", immutable, *settings.ImmutableTags))
+			mask = append(mask, "dockerConfig.immutableTags")
+		}
+	}
+
+	if settings.CleanupPolicies != nil {
+		policyChanges := diffKeys("cleanup_policies", current.CleanupPolicies, desired.CleanupPolicies, func(from, to *CleanupPolicy) string {
+			switch {
+			case from == nil:
+				return "added"
+			case to == nil:
+				return "removed"
+			default:
+				return "changed"
+			}
+		})
+		if len(policyChanges) > 0 {
+			changes = append(changes, policyChanges...)
+			mask = append(mask, "cleanupPolicies")
+		}
+	}
+
+	return changes, mask
+}
+
+// diffKeys describes the entries that differ between two maps, in key order.
+func diffKeys[V any](field string, from, to map[string]V, describe func(from, to *V) string) []string {
+	keys := make(map[string]bool, len(from)+len(to))
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var changes []string
+	for _, key := range sorted {
+		var fromValue, toValue *V
+		if value, ok := from[key]; ok {
+			fromValue = &value
+		}
+		if value, ok := to[key]; ok {
+			toValue = &value
+		}
+		if fromValue != nil && toValue != nil && reflect.DeepEqual(*fromValue, *toValue) {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s.%s: %s", field, key, describe(fromValue, toValue)))
+	}
+	return changes
+}
+
+// UpdateRepository updates the fields in mask of the repository of region.
+func (c *GCRClient) UpdateRepository(ctx context.Context, region string, repository Repository, mask []string) error {
+	token, err := c.credentials.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	query := url.Values{"updateMask": {strings.Join(mask, ",")}}
+	endpoint := fmt.Sprintf("%s/v1/%s?%s", c.artifactRegistryEndpoint(), c.repositoryName(region), query.Encode())
+	return callAPI(ctx, c.credentials.httpClient, http.MethodPatch, endpoint, token, repository, nil)
+}
+
+// reconcileRepository brings an existing repository in line with the managed
+// settings and returns the action taken and the changes it made.
+func (p *GCRPlugin) reconcileRepository(ctx context.Context, client *GCRClient, region string, current *Repository, settings RepositorySettings, pinned map[string][]string, dryRun bool, redactor *Redactor) (string, []string, error) {
+	name := client.repositoryName(region)
+	if settings.KMSKeyName != "" && current.KMSKeyName != settings.KMSKeyName {
+		redactor.Warnf("repository %s is not encrypted with kms_key_name; the key of a repository cannot be changed after it is created", name)
+	}
+
+	changes, mask := diffRepository(current, settings, pinned)
+	if len(changes) == 0 {
+		return "exists", nil, nil
+	}
+
+	if dryRun {
+		redactor.Printf("[dry-run] Would update repository %s:\n", name)
+		for _, change := range changes {
+			redactor.Printf("  %s\n", change)
+		}
+		return "would update", changes, nil
+	}
+
+	if err := client.UpdateRepository(ctx, region, settings.desired(pinned), mask); err != nil {
+		return "", nil, fmt.Errorf("failed to update repository %s: %w", name, err)
+	}
+	redactor.Printf("Updated repository: %s\n", name)
+	for _, change := range changes {
+		redactor.Printf("  %s\n", change)
+	}
+	return "updated", changes, nil
+}
+
+// validateCleanupPolicies checks the configured cleanup policies.
+func (p *GCRPlugin) validateCleanupPolicies(vb *helpers.ValidationBuilder, policies []CleanupPolicyConfig) {
+	if len(policies) > maxCleanupPolicies {
+		vb.AddError("ensure_repository.cleanup_policies",
+			fmt.Sprintf("Artifact Registry allows at most %d cleanup policies, got %d", maxCleanupPolicies, len(policies)))
+	}
+
+	seen := make(map[string]int)
+	for i, policy := range policies {
+		field := fmt.Sprintf("ensure_repository.cleanup_policies[%d]", i)
+
+		if policy.ID == "" {
+			vb.AddError(field+".id", "policy id is required")
+		} else if first, ok := seen[policy.ID]; ok {
+			vb.AddError(field+".id", fmt.Sprintf("policy id '%s' is already used by cleanup_policies[%d]", policy.ID, first))
+		} else {
+			seen[policy.ID] = i
+		}
+
+		if policy.Action != "KEEP" && policy.Action != "DELETE" {
+			vb.AddError(field+".action", "action must be keep or delete")
+		}
+
+		hasCondition := policy.TagState != "" || len(policy.TagPrefixes) > 0 || policy.OlderThan != "" || policy.TagPattern != ""
+		switch {
+		case policy.KeepCount < 0:
+			vb.AddError(field+".keep_count", "keep_count must be positive")
+		case policy.KeepCount > 0 && policy.Action != "KEEP":
+			vb.AddError(field+".keep_count", "keep_count is only valid with action keep")
+		case policy.KeepCount > 0 && hasCondition:
+			vb.AddError(field+".keep_count", "keep_count cannot be combined with tag_state, tag_prefixes, tag_pattern or older_than")
+		case policy.KeepCount == 0 && !hasCondition:
+			vb.AddError(field, "policy needs keep_count or a condition (tag_state, tag_prefixes, tag_pattern, older_than)")
+		}
+
+		switch policy.TagState {
+		case "", "TAGGED", "UNTAGGED", "ANY":
+		default:
+			vb.AddError(field+".tag_state", "tag_state must be tagged, untagged or any")
+		}
+		if len(policy.TagPrefixes) > 0 && policy.TagState != "TAGGED" {
+			vb.AddError(field+".tag_prefixes", "tag_prefixes require tag_state tagged")
+		}
+		// Artifact Registry matches prefixes literally; patterns go in tag_pattern
+		for _, prefix := range policy.TagPrefixes {
+			if !tagPattern.MatchString(prefix) {
+				vb.AddError(field+".tag_prefixes", fmt.Sprintf(
+					"'%s' is not a tag prefix; use tag_pattern for regular expressions", prefix))
+			}
+		}
+
+		if policy.TagPattern != "" {
+			if _, err := regexp.Compile(policy.TagPattern); err != nil {
+				vb.AddError(field+".tag_pattern", fmt.Sprintf("invalid regular expression: %v", err))
+			}
+			switch {
+			case policy.Action != "KEEP":
+				vb.AddError(field+".tag_pattern", "tag_pattern is only valid with action keep")
+			case len(policy.TagPrefixes) > 0 || policy.OlderThan != "":
+				vb.AddError(field+".tag_pattern", "tag_pattern cannot be combined with tag_prefixes or older_than")
+			case policy.TagState != "" && policy.TagState != "TAGGED":
+				vb.AddError(field+".tag_pattern", "tag_pattern requires tag_state tagged")
+			}
+		}
+
+		if policy.OlderThan != "" {
+			if _, err := parseAge(policy.OlderThan); err != nil {
+				vb.AddError(field+".older_than", err.Error())
+			}
+		}
+	}
+}
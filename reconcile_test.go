@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30d", want: 30 * 24 * time.Hour},
+		{value: "72h", want: 72 * time.Hour},
+		{value: "90m", want: 90 * time.Minute},
+		{value: "0d", wantErr: true},
+		{value: "-1h", wantErr: true},
+		{value: "monthly", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseAge(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDiffRepository(t *testing.T) {
+	current := &Repository{
+		Description:  "Old",
+		Labels:       map[string]string{"team": "web", "env": "prod"},
+		DockerConfig: &repositoryDockerConfig{ImmutableTags: true},
+		CleanupPolicies: map[string]CleanupPolicy{
+			"keep-recent":     {ID: "keep-recent", Action: "KEEP", MostRecentVersions: &CleanupPolicyMostRecentVersions{KeepCount: 10}},
+			"delete-untagged": {ID: "delete-untagged", Action: "DELETE", Condition: &CleanupPolicyCondition{TagState: "UNTAGGED", OlderThan: "604800s"}},
+			"legacy":          {ID: "legacy", Action: "DELETE", Condition: &CleanupPolicyCondition{TagState: "ANY"}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		settings    map[string]any
+		pinned      map[string][]string
+		wantChanges []string
+		wantMask    []string
+	}{
+		{name: "nothing managed", settings: map[string]any{}},
+		{
+			name: "in sync",
+			settings: map[string]any{
+				"description":    "Old",
+				"labels":         map[string]any{"team": "web", "env": "prod"},
+				"immutable_tags": true,
+				"cleanup_policies": []any{
+					map[string]any{"id": "keep-recent", "action": "keep", "keep_count": 10},
+					map[string]any{"id": "delete-untagged", "action": "delete", "tag_state": "untagged", "older_than": "7d"},
+					map[string]any{"id": "legacy", "action": "delete", "tag_state": "any"},
+				},
+			},
+		},
+		{
+			name:        "description",
+			settings:    map[string]any{"description": "New"},
+			wantChanges: []string{`description: "Old" -> "New"`},
+			wantMask:    []string{"description"},
+		},
+		{
+			name:     "labels",
+			settings: map[string]any{"labels": map[string]any{"team": "platform", "tier": "gold"}},
+			wantChanges: []string{
+				`labels.env: removed "prod"`,
+				`labels.team: "web" -> "platform"`,
+				`labels.tier: added "gold"`,
+			},
+			wantMask: []string{"labels"},
+		},
+		{
+			name:        "immutable tags",
+			settings:    map[string]any{"immutable_tags": false},
+			wantChanges: []string{"immutable_tags: true -> false"},
+			wantMask:    []string{"dockerConfig.immutableTags"},
+		},
+		{
+			name: "cleanup policies",
+			settings: map[string]any{"cleanup_policies": []any{
+				map[string]any{"id": "keep-recent", "action": "keep", "keep_count": 5},
+				map[string]any{"id": "delete-untagged", "action": "delete", "tag_state": "untagged", "older_than": "7d"},
+				map[string]any{"id": "keep-releases", "action": "keep", "tag_state": "tagged", "tag_prefixes": []any{"v"}},
+			}},
+			wantChanges: []string{
+				"cleanup_policies.keep-recent: changed",
+				"cleanup_policies.keep-releases: added",
+				"cleanup_policies.legacy: removed",
+			},
+			wantMask: []string{"cleanupPolicies"},
+		},
+		{
+			name: "tag pattern without matches",
+			settings: map[string]any{"cleanup_policies": []any{
+				map[string]any{"id": "keep-recent", "action": "keep", "keep_count": 10},
+				map[string]any{"id": "delete-untagged", "action": "delete", "tag_state": "untagged", "older_than": "7d"},
+				map[string]any{"id": "legacy", "action": "delete", "tag_state": "any"},
+				map[string]any{"id": "keep-majors", "action": "keep", "tag_pattern": `^v[0-9]+$`},
+			}},
+		},
+		{
+			name: "tag pattern pins matches",
+			settings: map[string]any{"cleanup_policies": []any{
+				map[string]any{"id": "keep-recent", "action": "keep", "keep_count": 10},
+				map[string]any{"id": "delete-untagged", "action": "delete", "tag_state": "untagged", "older_than": "7d"},
+				map[string]any{"id": "legacy", "action": "delete", "tag_state": "any"},
+				map[string]any{"id": "keep-majors", "action": "keep", "tag_pattern": `^v[0-9]+$`},
+			}},
+			pinned:      map[string][]string{"keep-majors": {"v1", "v2"}},
+			wantChanges: []string{"cleanup_policies.keep-majors: added"},
+			wantMask:    []string{"cleanupPolicies"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, mask := diffRepository(current, parseRepositorySettings(tt.settings), tt.pinned)
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("expected changes %v, got %v", tt.wantChanges, changes)
+			}
+			if !reflect.DeepEqual(mask, tt.wantMask) {
+				t.Errorf("expected mask %v, got %v", tt.wantMask, mask)
+			}
+		})
+	}
+}
+
+func TestEnsureRepositoriesReconciles(t *testing.T) {
+	const name = "projects/my-project/locations/us-central1/repositories/my-repo"
+
+	tests := []struct {
+		name        string
+		dryRun      bool
+		wantAction  string
+		wantUpdates []string
+	}{
+		{name: "apply", wantAction: "updated", wantUpdates: []string{"labels,dockerConfig.immutableTags,cleanupPolicies"}},
+		{name: "dry run", dryRun: true, wantAction: "would update"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeGoogleAPI(t)
+			repositories := newFakeRepositories(api, name)
+
+			p := &GCRPlugin{}
+			cfg := p.parseConfig(map[string]any{
+				"project":    "my-project",
+				"repository": "my-repo",
+				"image":      "my-app",
+				"endpoints":  api.EndpointsConfig(),
+				"dry_run":    tt.dryRun,
+				"ensure_repository": map[string]any{
+					"reconcile":      true,
+					"labels":         map[string]any{"team": "platform"},
+					"immutable_tags": true,
+					"cleanup_policies": []any{
+						map[string]any{"id": "delete-untagged", "action": "delete", "tag_state": "untagged", "older_than": "30d"},
+					},
+				},
+			})
+			credentials := NewCredentialManager(&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", cfg.Endpoints)
+
+			var out strings.Builder
+			results, err := p.ensureRepositories(context.Background(), cfg, cfg.repositories(), nil, credentials, &Redactor{out: &out})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			wantChanges := []string{
+				`labels.team: added "platform"`,
+				"immutable_tags: false -> true",
+				"cleanup_policies.delete-untagged: added",
+			}
+			if len(results) != 1 || results[0]["action"] != tt.wantAction || !reflect.DeepEqual(results[0]["changes"], wantChanges) {
+				t.Fatalf("expected %s with %v, got %v", tt.wantAction, wantChanges, results)
+			}
+			if !strings.Contains(out.String(), `labels.team: added "platform"`) {
+				t.Errorf("expected the diff to be printed, got '%s'", out.String())
+			}
+			if !reflect.DeepEqual(repositories.updates, tt.wantUpdates) {
+				t.Fatalf("expected updates %v, got %v", tt.wantUpdates, repositories.updates)
+			}
+
+			if !tt.dryRun {
+				updated := repositories.existing[name]
+				policy := updated.CleanupPolicies["delete-untagged"]
+				if policy.Condition == nil || policy.Condition.OlderThan != "2592000s" || policy.Condition.TagState != "UNTAGGED" {
+					t.Errorf("expected the cleanup policy to be applied, got %+v", updated.CleanupPolicies)
+				}
+			}
+		})
+	}
+}
+
+func TestRepositorySettingsPinnedTags(t *testing.T) {
+	settings := parseRepositorySettings(map[string]any{"cleanup_policies": []any{
+		map[string]any{"id": "keep-recent", "action": "keep", "keep_count": 10},
+		map[string]any{"id": "keep-majors", "action": "keep", "tag_pattern": `^v[0-9]+$`},
+		map[string]any{"id": "keep-lts", "action": "keep", "tag_pattern": `-lts$`},
+	}})
+
+	pinned := settings.pinnedTags([]string{"v2", "v1.2.3", "v1", "2.0.0-lts", "latest", "v2"})
+	want := map[string][]string{"keep-majors": {"v1", "v2"}, "keep-lts": {"2.0.0-lts"}}
+	if !reflect.DeepEqual(pinned, want) {
+		t.Errorf("expected %v, got %v", want, pinned)
+	}
+
+	tests := []struct {
+		tag    string
+		wantID string
+	}{
+		{tag: "v3", wantID: "keep-majors"},
+		{tag: "1.0.0-lts", wantID: "keep-lts"},
+		{tag: "v3.0.0"},
+	}
+	for _, tt := range tests {
+		if id, _ := settings.pin(tt.tag); id != tt.wantID {
+			t.Errorf("expected %s to be pinned by '%s', got '%s'", tt.tag, tt.wantID, id)
+		}
+	}
+}
+
+func TestEnsureRepositoriesPinsTagPattern(t *testing.T) {
+	const name = "projects/my-project/locations/us-central1/repositories/my-repo"
+
+	api := newFakeGoogleAPI(t)
+	repositories := newFakeRepositories(api, name)
+	registry := newFakeRegistry(t)
+	registry.SeedImage("my-project/my-repo/my-app", "v1", "v1")
+	registry.SeedImage("my-project/my-repo/my-app", "v1.0.0", "v1")
+	registry.SeedImage("my-project/my-repo/my-app", "latest", "v1")
+
+	endpoints := api.EndpointsConfig()
+	endpoints["registry"] = registry.URL
+
+	p := &GCRPlugin{}
+	cfg := p.parseConfig(map[string]any{
+		"project":    "my-project",
+		"repository": "my-repo",
+		"image":      "my-app",
+		"endpoints":  endpoints,
+		"ensure_repository": map[string]any{
+			"reconcile": true,
+			"cleanup_policies": []any{
+				map[string]any{"id": "keep-majors", "action": "keep", "tag_pattern": `^v[0-9]+$`},
+			},
+		},
+	})
+	credentials := NewCredentialManager(&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", cfg.Endpoints)
+
+	// v2 is about to be pushed by the release
+	_, err := p.ensureRepositories(context.Background(), cfg, cfg.repositories(), []string{"v2", "v2.0.0"}, credentials, &Redactor{out: &strings.Builder{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	policy := repositories.existing[name].CleanupPolicies["keep-majors"]
+	want := &CleanupPolicyCondition{TagState: "TAGGED", TagPrefixes: []string{"v1", "v2"}}
+	if policy.Action != "KEEP" || !reflect.DeepEqual(policy.Condition, want) {
+		t.Errorf("expected a keep policy for %v, got %+v", want.TagPrefixes, policy)
+	}
+}
+
+func TestEnsureRepositoriesReconcileRequiresRepository(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	newFakeRepositories(api)
+
+	p := &GCRPlugin{}
+	cfg := p.parseConfig(map[string]any{
+		"project":           "my-project",
+		"repository":        "my-repo",
+		"image":             "my-app",
+		"endpoints":         api.EndpointsConfig(),
+		"ensure_repository": map[string]any{"reconcile": true},
+	})
+	credentials := NewCredentialManager(&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", cfg.Endpoints)
+
+	_, err := p.ensureRepositories(context.Background(), cfg, cfg.repositories(), nil, credentials, &Redactor{out: &strings.Builder{}})
+	if err == nil || !strings.Contains(err.Error(), "set ensure_repository.enabled to create it") {
+		t.Errorf("expected missing repository error, got %v", err)
+	}
+}
+
+func TestValidateCleanupPolicies(t *testing.T) {
+	tests := []struct {
+		name       string
+		policies   []any
+		wantFields []string
+	}{
+		{
+			name: "valid",
+			policies: []any{
+				map[string]any{"id": "keep-recent", "action": "keep", "keep_count": 10},
+				map[string]any{"id": "delete-untagged", "action": "delete", "tag_state": "untagged", "older_than": "30d"},
+				map[string]any{"id": "keep-releases", "action": "keep", "tag_state": "tagged", "tag_prefixes": []any{"v"}},
+			},
+		},
+		{
+			name: "duplicate id",
+			policies: []any{
+				map[string]any{"id": "a", "action": "keep", "keep_count": 1},
+				map[string]any{"id": "a", "action": "keep", "keep_count": 2},
+			},
+			wantFields: []string{"ensure_repository.cleanup_policies[1].id"},
+		},
+		{
+			name:       "unknown action",
+			policies:   []any{map[string]any{"id": "a", "action": "archive", "tag_state": "any"}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0].action"},
+		},
+		{
+			name:       "keep count on delete",
+			policies:   []any{map[string]any{"id": "a", "action": "delete", "keep_count": 3}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0].keep_count"},
+		},
+		{
+			name:       "keep count with condition",
+			policies:   []any{map[string]any{"id": "a", "action": "keep", "keep_count": 3, "tag_state": "tagged"}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0].keep_count"},
+		},
+		{
+			name:       "no condition",
+			policies:   []any{map[string]any{"id": "a", "action": "delete"}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0]"},
+		},
+		{
+			name:       "prefixes need tagged",
+			policies:   []any{map[string]any{"id": "a", "action": "keep", "tag_state": "any", "tag_prefixes": []any{"v"}}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0].tag_prefixes"},
+		},
+		{
+			name:       "regular expression prefix",
+			policies:   []any{map[string]any{"id": "a", "action": "keep", "tag_state": "tagged", "tag_prefixes": []any{"v", "^v[0-9]+$"}}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0].tag_prefixes"},
+		},
+		{
+			name:     "tag pattern",
+			policies: []any{map[string]any{"id": "a", "action": "keep", "tag_pattern": `^v[0-9]+(\.[0-9]+)?$`}},
+		},
+		{
+			name:       "invalid tag pattern",
+			policies:   []any{map[string]any{"id": "a", "action": "keep", "tag_pattern": `^v[0-9+$`}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0].tag_pattern"},
+		},
+		{
+			name:       "tag pattern on delete",
+			policies:   []any{map[string]any{"id": "a", "action": "delete", "tag_pattern": `^tmp-`}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0].tag_pattern"},
+		},
+		{
+			name:       "tag pattern with prefixes",
+			policies:   []any{map[string]any{"id": "a", "action": "keep", "tag_state": "tagged", "tag_prefixes": []any{"v"}, "tag_pattern": `^v`}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0].tag_pattern"},
+		},
+		{
+			name:       "invalid age",
+			policies:   []any{map[string]any{"id": "a", "action": "delete", "tag_state": "untagged", "older_than": "a month"}},
+			wantFields: []string{"ensure_repository.cleanup_policies[0].older_than"},
+		},
+	}
+
+	p := &GCRPlugin{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vb := helpers.NewValidationBuilder()
+			p.validateCleanupPolicies(vb, parseCleanupPolicies(map[string]any{"cleanup_policies": tt.policies}))
+
+			var fields []string
+			for _, e := range vb.Build().Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, vb.Build().Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// redacted replaces every secret the Redactor finds.
+const redacted = "[REDACTED]"
+
+// minSecretLength avoids redacting trivially short values that would mangle output.
+const minSecretLength = 8
+
+// redactPattern rewrites matches of a pattern that looks like secret material.
+type redactPattern struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// redactPatterns catch secrets regardless of whether they were configured.
+var redactPatterns = []redactPattern{
+	{
+		// PEM private keys, raw or JSON-escaped, including truncated blocks.
+		re:          regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----(?:[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----|[A-Za-z0-9+/=\s\\]*)`),
+		replacement: redacted,
+	},
+	{
+		re:          regexp.MustCompile(`("private_key"\s*:\s*)"(?:[^"\\]|\\.)*"`),
+		replacement: `${1}"` + redacted + `"`,
+	},
+	{
+		re:          regexp.MustCompile(`(?i)(authorization\s*:\s*(?:bearer|basic)\s+)[^\s"',]+`),
+		replacement: "${1}" + redacted,
+	},
+	{
+		re:          regexp.MustCompile(`(?i)((?:access_token|refresh_token|id_token)["']?\s*[:=]\s*["']?)[^\s"'&,}]+`),
+		replacement: "${1}" + redacted,
+	},
+	{
+		// Google OAuth2 access tokens.
+		re:          regexp.MustCompile(`ya29\.[0-9A-Za-z_\-.]+`),
+		replacement: redacted,
+	},
+}
+
+// Redactor scrubs secrets from errors, log lines and responses.
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+	out     io.Writer
+}
+
+// NewRedactor creates a redactor that also removes the given literal secrets.
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{out: os.Stdout}
+	r.Add(secrets...)
+	return r
+}
+
+// newConfigRedactor creates a redactor for the secrets in a plugin configuration.
+func newConfigRedactor(cfg *Config) *Redactor {
+	r := NewRedactor(cfg.KeyJSON, cfg.AccessToken)
+	r.Add(cfg.targetSecrets()...)
+	return r
+}
+
+// Add registers literal secrets, along with their JSON-escaped forms.
+func (r *Redactor) Add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, secret := range secrets {
+		secret = strings.TrimSpace(secret)
+		if len(secret) < minSecretLength {
+			continue
+		}
+
+		r.secrets = append(r.secrets, secret)
+		if escaped, err := json.Marshal(secret); err == nil {
+			r.secrets = append(r.secrets, strings.Trim(string(escaped), `"`))
+		}
+
+		// Also catch the private key alone if the secret is a key file.
+		var key ServiceAccountKey
+		if json.Unmarshal([]byte(secret), &key) == nil && len(key.PrivateKey) >= minSecretLength {
+			r.secrets = append(r.secrets, key.PrivateKey)
+		}
+	}
+}
+
+// String returns s with all known secrets removed.
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	r.mu.RUnlock()
+
+	for _, p := range redactPatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+
+	return s
+}
+
+// Error returns err with its message redacted.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := r.String(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// Value redacts every string nested in maps and slices.
+func (r *Redactor) Value(v any) any {
+	switch val := v.(type) {
+	case string:
+		return r.String(val)
+	case error:
+		return r.String(val.Error())
+	case []string:
+		out := make([]string, len(val))
+		for i, s := range val {
+			out[i] = r.String(s)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = r.Value(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = r.Value(item)
+		}
+		return out
+	case []map[string]any:
+		out := make([]map[string]any, len(val))
+		for i, item := range val {
+			out[i], _ = r.Value(item).(map[string]any)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// Response redacts every user-visible field of an execute response.
+func (r *Redactor) Response(resp *plugin.ExecuteResponse) *plugin.ExecuteResponse {
+	if resp == nil {
+		return nil
+	}
+
+	out := *resp
+	out.Message = r.String(resp.Message)
+	out.Error = r.String(resp.Error)
+	if resp.Outputs != nil {
+		out.Outputs, _ = r.Value(resp.Outputs).(map[string]any)
+	}
+	if resp.Artifacts != nil {
+		out.Artifacts = make([]plugin.Artifact, len(resp.Artifacts))
+		for i, a := range resp.Artifacts {
+			a.Name = r.String(a.Name)
+			a.Path = r.String(a.Path)
+			out.Artifacts[i] = a
+		}
+	}
+
+	return &out
+}
+
+// ValidateResponse redacts the messages of a validate response.
+func (r *Redactor) ValidateResponse(resp *plugin.ValidateResponse) *plugin.ValidateResponse {
+	for i := range resp.Errors {
+		resp.Errors[i].Message = r.String(resp.Errors[i].Message)
+	}
+	return resp
+}
+
+// Printf writes a redacted line to the plugin output.
+func (r *Redactor) Printf(format string, args ...any) {
+	fmt.Fprint(r.out, r.String(fmt.Sprintf(format, args...)))
+}
+
+// Warnf writes a redacted, non-fatal warning.
+func (r *Redactor) Warnf(format string, args ...any) {
+	r.Printf("Warning: "+format+"\n", args...)
+}
+
+// redactedError carries a scrubbed message while keeping the original error for errors.Is.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
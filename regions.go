@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+)
+
+// artifactRegistryLocations are the locations that host Docker repositories,
+// including the multi-regions us, europe and asia.
+var artifactRegistryLocations = []string{
+	"us", "europe", "asia",
+	"africa-south1",
+	"asia-east1", "asia-east2", "asia-northeast1", "asia-northeast2", "asia-northeast3",
+	"asia-south1", "asia-south2", "asia-southeast1", "asia-southeast2",
+	"australia-southeast1", "australia-southeast2",
+	"europe-central2", "europe-north1", "europe-north2", "europe-southwest1",
+	"europe-west1", "europe-west2", "europe-west3", "europe-west4", "europe-west6",
+	"europe-west8", "europe-west9", "europe-west10", "europe-west12",
+	"me-central1", "me-central2", "me-west1",
+	"northamerica-northeast1", "northamerica-northeast2", "northamerica-south1",
+	"southamerica-east1", "southamerica-west1",
+	"us-central1", "us-east1", "us-east4", "us-east5", "us-south1",
+	"us-west1", "us-west2", "us-west3", "us-west4",
+}
+
+// gcrRegions are the legacy GCR regions understood by getRegistryHost.
+var gcrRegions = []string{"us", "eu", "europe", "asia"}
+
+// defaultRegion is used when no region is configured.
+func defaultRegion(artifactRegistry bool) string {
+	if artifactRegistry {
+		return "us-central1"
+	}
+	return "us"
+}
+
+// dedupeRegions removes repeated regions, keeping the first occurrence.
+func dedupeRegions(regions []string) []string {
+	seen := make(map[string]bool, len(regions))
+	unique := make([]string, 0, len(regions))
+	for _, region := range regions {
+		if !seen[region] {
+			seen[region] = true
+			unique = append(unique, region)
+		}
+	}
+	return unique
+}
+
+// checkRegion returns an error if region is not a known location for the
+// registry type, suggesting the closest known one.
+func checkRegion(region string, artifactRegistry bool) error {
+	known, kind := artifactRegistryLocations, "Artifact Registry location"
+	if !artifactRegistry {
+		known, kind = gcrRegions, "GCR region"
+	}
+
+	if region == "" {
+		return fmt.Errorf("%s must not be empty", kind)
+	}
+	if containsString(known, region) {
+		return nil
+	}
+
+	best, bestDistance := "", math.MaxInt
+	for _, candidate := range known {
+		distance := levenshtein(strings.ToLower(region), candidate)
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if bestDistance <= max(2, len(region)/3) {
+		return fmt.Errorf("unknown %s '%s'; did you mean '%s'?", kind, region, best)
+	}
+
+	sorted := append([]string(nil), known...)
+	sort.Strings(sorted)
+	if !artifactRegistry {
+		return fmt.Errorf("unknown %s '%s'; must be one of %s", kind, region, quoteList(sorted))
+	}
+	return fmt.Errorf("unknown %s '%s'", kind, region)
+}
+
+// validateRegions checks the regions of a target. Field names are prefixed
+// with prefix.
+func (p *GCRPlugin) validateRegions(vb *helpers.ValidationBuilder, cfg *Config, prefix string, redactor *Redactor) {
+	if !cfg.MultiRegionEnabled {
+		if err := checkRegion(cfg.Region, cfg.ArtifactRegistry); err != nil {
+			vb.AddError(prefix+"region", err.Error())
+		}
+		return
+	}
+
+	field := "multi_region.regions"
+	if prefix != "" {
+		field = prefix + "regions"
+	}
+
+	if len(cfg.MultiRegionRegions) == 0 {
+		vb.AddError(field, "at least one region is required when multi_region is enabled")
+		return
+	}
+
+	for i, region := range cfg.MultiRegionRegions {
+		if err := checkRegion(region, cfg.ArtifactRegistry); err != nil {
+			vb.AddError(fmt.Sprintf("%s[%d]", field, i), err.Error())
+		}
+	}
+
+	if unique := dedupeRegions(cfg.MultiRegionRegions); len(unique) != len(cfg.MultiRegionRegions) {
+		redactor.Warnf("%s lists repeated regions; pushing to %s once each", field, strings.Join(unique, ", "))
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckRegion(t *testing.T) {
+	tests := []struct {
+		region           string
+		artifactRegistry bool
+		wantErr          string
+	}{
+		{region: "us-central1", artifactRegistry: true},
+		{region: "europe", artifactRegistry: true},
+		{region: "asia", artifactRegistry: true},
+		{region: "us-centrl1", artifactRegistry: true, wantErr: "did you mean 'us-central1'?"},
+		{region: "US-EAST1", artifactRegistry: true, wantErr: "did you mean 'us-east1'?"},
+		{region: "mars-north1", artifactRegistry: true, wantErr: "unknown Artifact Registry location 'mars-north1'"},
+		{region: "", artifactRegistry: true, wantErr: "must not be empty"},
+		{region: "us", artifactRegistry: false},
+		{region: "eu", artifactRegistry: false},
+		{region: "europe", artifactRegistry: false},
+		{region: "asai", artifactRegistry: false, wantErr: "did you mean 'asia'?"},
+		{region: "us-central1", artifactRegistry: false, wantErr: "must be one of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			err := checkRegion(tt.region, tt.artifactRegistry)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing '%s', got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDefaultRegion(t *testing.T) {
+	p := &GCRPlugin{}
+
+	cfg := p.parseConfig(map[string]any{})
+	if cfg.Region != "us-central1" {
+		t.Errorf("expected Artifact Registry default 'us-central1', got '%s'", cfg.Region)
+	}
+
+	cfg = p.parseConfig(map[string]any{"artifact_registry": false})
+	if cfg.Region != "us" {
+		t.Errorf("expected GCR default 'us', got '%s'", cfg.Region)
+	}
+
+	cfg = p.parseConfig(map[string]any{
+		"targets": []any{map[string]any{"name": "legacy", "artifact_registry": false}},
+	})
+	if region := cfg.targets()[0].Region; region != "us" {
+		t.Errorf("expected legacy target default 'us', got '%s'", region)
+	}
+}
+
+func TestConfigRegionsDeduplicated(t *testing.T) {
+	cfg := &Config{
+		MultiRegionEnabled: true,
+		MultiRegionRegions: []string{"us-central1", "europe-west1", "us-central1"},
+	}
+
+	if regions := cfg.regions(); !reflect.DeepEqual(regions, []string{"us-central1", "europe-west1"}) {
+		t.Errorf("expected deduplicated regions, got %v", regions)
+	}
+}
+
+func TestValidateRegions(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     map[string]any
+		wantFields []string
+	}{
+		{
+			name:   "known region",
+			config: map[string]any{"region": "europe-west4"},
+		},
+		{
+			name:       "region typo",
+			config:     map[string]any{"region": "europe-west44"},
+			wantFields: []string{"region"},
+		},
+		{
+			name: "empty multi-region list",
+			config: map[string]any{
+				"multi_region": map[string]any{"enabled": true},
+			},
+			wantFields: []string{"multi_region.regions"},
+		},
+		{
+			name: "repeated regions are accepted",
+			config: map[string]any{
+				"multi_region": map[string]any{"enabled": true, "regions": []any{"us", "us"}},
+			},
+		},
+		{
+			name: "unknown region in list",
+			config: map[string]any{
+				"multi_region": map[string]any{"enabled": true, "regions": []any{"us", "moon"}},
+			},
+			wantFields: []string{"multi_region.regions[1]"},
+		},
+		{
+			name: "legacy GCR region",
+			config: map[string]any{
+				"artifact_registry": false,
+				"region":            "us-central1",
+			},
+			wantFields: []string{"region"},
+		},
+		{
+			name: "target regions",
+			config: map[string]any{
+				"targets": []any{map[string]any{"name": "prod", "regions": []any{"us-east1", "us-est4"}}},
+			},
+			wantFields: []string{"targets[0].regions[1]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config["project"] = "my-project"
+			tt.config["repository"] = "my-repo"
+			tt.config["image"] = "my-app"
+			tt.config["source_image"] = "myapp:latest"
+
+			p := &GCRPlugin{}
+			resp, err := p.Validate(context.Background(), tt.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var fields []string
+			for _, e := range resp.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, resp.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// manifestMediaTypes are the manifest formats GCR and Artifact Registry serve,
+// image indexes first.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Manifest is a raw image manifest or index as stored in a registry.
+type Manifest struct {
+	MediaType string
+	Digest    string
+	Data      []byte
+}
+
+// manifestContent is the part of a manifest that references other content.
+type manifestContent struct {
+	Config    *manifestDescriptor  `json:"config"`
+	Layers    []manifestDescriptor `json:"layers"`
+	Manifests []manifestDescriptor `json:"manifests"`
+}
+
+// manifestDescriptor references a blob or child manifest by digest.
+type manifestDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+// RegistryClient calls the Docker Registry HTTP API of one registry host,
+// authenticating with an OAuth2 access token from the credential manager.
+type RegistryClient struct {
+	baseURL     string
+	credentials *CredentialManager
+	httpClient  *http.Client
+}
+
+// NewRegistryClient creates a registry client for host. endpoints.Registry,
+// when set, replaces https://<host> as the API base URL.
+func NewRegistryClient(host string, endpoints Endpoints, credentials *CredentialManager) *RegistryClient {
+	baseURL := "https://" + host
+	if endpoints.Registry != "" {
+		baseURL = strings.TrimSuffix(endpoints.Registry, "/")
+	}
+	return &RegistryClient{
+		baseURL:     baseURL,
+		credentials: credentials,
+		httpClient:  http.DefaultClient,
+	}
+}
+
+// GetManifest fetches the manifest of repository at reference, a tag or digest.
+func (r *RegistryClient) GetManifest(ctx context.Context, repository, reference string) (*Manifest, error) {
+	resp, err := r.do(ctx, http.MethodGet, r.manifestURL(repository, reference), nil, map[string]string{
+		"Accept": strings.Join(manifestMediaTypes, ", "),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return &Manifest{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    manifestDigest(resp.Header, data),
+		Data:      data,
+	}, nil
+}
+
+// ManifestDigest returns the digest a tag or digest reference resolves to.
+func (r *RegistryClient) ManifestDigest(ctx context.Context, repository, reference string) (string, error) {
+	manifest, err := r.GetManifest(ctx, repository, reference)
+	if err != nil {
+		return "", err
+	}
+	return manifest.Digest, nil
+}
+
+// PutManifest stores manifest in repository under reference.
+func (r *RegistryClient) PutManifest(ctx context.Context, repository, reference string, manifest *Manifest) error {
+	resp, err := r.do(ctx, http.MethodPut, r.manifestURL(repository, reference), manifest.Data, map[string]string{
+		"Content-Type": manifest.MediaType,
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// DeleteManifest deletes a tag or manifest reference from repository.
+func (r *RegistryClient) DeleteManifest(ctx context.Context, repository, reference string) error {
+	resp, err := r.do(ctx, http.MethodDelete, r.manifestURL(repository, reference), nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// TagList is the tag listing of a repository. Manifests is the Google
+// extension that GCR and Artifact Registry add, keyed by digest.
+type TagList struct {
+	Name      string                  `json:"name"`
+	Tags      []string                `json:"tags"`
+	Manifests map[string]ManifestInfo `json:"manifest"`
+}
+
+// ManifestInfo describes one manifest in a Google tag listing.
+type ManifestInfo struct {
+	MediaType      string   `json:"mediaType"`
+	Tags           []string `json:"tag"`
+	ImageSizeBytes string   `json:"imageSizeBytes"`
+	TimeCreatedMs  string   `json:"timeCreatedMs"`
+	TimeUploadedMs string   `json:"timeUploadedMs"`
+}
+
+// ListTags lists the tags of repository, following pagination links.
+func (r *RegistryClient) ListTags(ctx context.Context, repository string) (*TagList, error) {
+	list := &TagList{Name: repository, Manifests: map[string]ManifestInfo{}}
+	next := fmt.Sprintf("%s/v2/%s/tags/list", r.baseURL, repository)
+	for next != "" {
+		resp, err := r.do(ctx, http.MethodGet, next, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page TagList
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tag list: %w", err)
+		}
+		list.Tags = append(list.Tags, page.Tags...)
+		for digest, info := range page.Manifests {
+			list.Manifests[digest] = info
+		}
+
+		next, err = r.nextPage(resp.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// nextPage returns the absolute URL of a rel="next" Link header, if any.
+func (r *RegistryClient) nextPage(link string) (string, error) {
+	target, params, ok := strings.Cut(link, ";")
+	if !ok || !strings.Contains(params, `rel="next"`) {
+		return "", nil
+	}
+	return r.resolveLocation(strings.Trim(strings.TrimSpace(target), "<>"))
+}
+
+// TagDigests returns the digest of every tag in a listing, reading the
+// manifests of tags the listing does not describe.
+func (r *RegistryClient) TagDigests(ctx context.Context, list *TagList) (map[string]string, error) {
+	digests := make(map[string]string, len(list.Tags))
+	for digest, info := range list.Manifests {
+		for _, tag := range info.Tags {
+			digests[tag] = digest
+		}
+	}
+	for _, tag := range list.Tags {
+		if _, ok := digests[tag]; ok {
+			continue
+		}
+		digest, err := r.ManifestDigest(ctx, list.Name, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read digest of %s:%s: %w", list.Name, tag, err)
+		}
+		digests[tag] = digest
+	}
+	return digests, nil
+}
+
+// CopyManifest tags the manifest digest of from as tag in to. Blobs and the
+// child manifests of an index are copied first when the repositories differ,
+// so the tagged digest is exactly the source digest.
+func (r *RegistryClient) CopyManifest(ctx context.Context, from, digest, to, tag string) error {
+	manifest, err := r.GetManifest(ctx, from, digest)
+	if err != nil {
+		return fmt.Errorf("failed to read %s@%s: %w", from, digest, err)
+	}
+
+	if from != to {
+		if err := r.copyContent(ctx, from, to, manifest); err != nil {
+			return err
+		}
+	}
+
+	if err := r.PutManifest(ctx, to, tag, manifest); err != nil {
+		return fmt.Errorf("failed to tag %s:%s: %w", to, tag, err)
+	}
+	return nil
+}
+
+// CopyManifestTo copies the manifest digest of from, with every child
+// manifest and blob it references, to the repository to of another registry
+// and stores it there under reference. The copy has the same digest.
+func (r *RegistryClient) CopyManifestTo(ctx context.Context, from, digest string, dst *RegistryClient, to, reference string) error {
+	manifest, err := r.GetManifest(ctx, from, digest)
+	if err != nil {
+		return fmt.Errorf("failed to read %s@%s: %w", from, digest, err)
+	}
+
+	var content manifestContent
+	if err := json.Unmarshal(manifest.Data, &content); err != nil {
+		return fmt.Errorf("failed to parse manifest %s: %w", digest, err)
+	}
+	for _, child := range content.Manifests {
+		if err := r.CopyManifestTo(ctx, from, child.Digest, dst, to, child.Digest); err != nil {
+			return err
+		}
+	}
+
+	blobs := content.Layers
+	if content.Config != nil {
+		blobs = append([]manifestDescriptor{*content.Config}, blobs...)
+	}
+	for _, blob := range blobs {
+		exists, err := dst.HasBlob(ctx, to, blob.Digest)
+		if err != nil {
+			return fmt.Errorf("failed to check blob %s: %w", blob.Digest, err)
+		}
+		if exists {
+			continue
+		}
+		if err := dst.uploadBlob(ctx, to, r, from, blob.Digest); err != nil {
+			return fmt.Errorf("failed to upload blob %s: %w", blob.Digest, err)
+		}
+	}
+
+	if err := dst.PutManifest(ctx, to, reference, manifest); err != nil {
+		return fmt.Errorf("failed to store %s:%s: %w", to, reference, err)
+	}
+	return nil
+}
+
+// copyContent copies everything manifest references from one repository to
+// another.
+func (r *RegistryClient) copyContent(ctx context.Context, from, to string, manifest *Manifest) error {
+	var content manifestContent
+	if err := json.Unmarshal(manifest.Data, &content); err != nil {
+		return fmt.Errorf("failed to parse manifest %s: %w", manifest.Digest, err)
+	}
+
+	for _, child := range content.Manifests {
+		childManifest, err := r.GetManifest(ctx, from, child.Digest)
+		if err != nil {
+			return fmt.Errorf("failed to read %s@%s: %w", from, child.Digest, err)
+		}
+		if err := r.copyContent(ctx, from, to, childManifest); err != nil {
+			return err
+		}
+		if err := r.PutManifest(ctx, to, child.Digest, childManifest); err != nil {
+			return fmt.Errorf("failed to copy %s@%s: %w", to, child.Digest, err)
+		}
+	}
+
+	blobs := content.Layers
+	if content.Config != nil {
+		blobs = append([]manifestDescriptor{*content.Config}, blobs...)
+	}
+	for _, blob := range blobs {
+		if err := r.copyBlob(ctx, from, to, blob.Digest); err != nil {
+			return fmt.Errorf("failed to copy blob %s: %w", blob.Digest, err)
+		}
+	}
+	return nil
+}
+
+// copyBlob mounts a blob from one repository into another, uploading it when
+// the registry declines the mount.
+func (r *RegistryClient) copyBlob(ctx context.Context, from, to, digest string) error {
+	query := url.Values{"mount": {digest}, "from": {from}}
+	resp, err := r.do(ctx, http.MethodPost, fmt.Sprintf("%s/v2/%s/blobs/uploads/?%s", r.baseURL, to, query.Encode()), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated {
+		return nil
+	}
+
+	// The mount was not possible, so the registry opened an upload instead.
+	return r.uploadFrom(ctx, resp.Header.Get("Location"), r, from, digest)
+}
+
+// uploadFrom completes the upload session opened at location with the blob
+// digest of repository from on src, streaming it without buffering the blob.
+func (r *RegistryClient) uploadFrom(ctx context.Context, location string, src *RegistryClient, from, digest string) error {
+	blob, err := src.send(ctx, http.MethodGet, fmt.Sprintf("%s/v2/%s/blobs/%s", src.baseURL, from, digest), nil, 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %w", err)
+	}
+	defer blob.Body.Close()
+	return r.finishUpload(ctx, location, digest, blob.Body, blob.ContentLength)
+}
+
+// HasBlob reports whether repository stores the blob digest.
+func (r *RegistryClient) HasBlob(ctx context.Context, repository, digest string) (bool, error) {
+	resp, err := r.do(ctx, http.MethodHead, fmt.Sprintf("%s/v2/%s/blobs/%s", r.baseURL, repository, digest), nil, nil)
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, resp.Body.Close()
+}
+
+// uploadBlob streams the blob digest of repository from on src into
+// repository.
+func (r *RegistryClient) uploadBlob(ctx context.Context, repository string, src *RegistryClient, from, digest string) error {
+	resp, err := r.do(ctx, http.MethodPost, fmt.Sprintf("%s/v2/%s/blobs/uploads/", r.baseURL, repository), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return r.uploadFrom(ctx, resp.Header.Get("Location"), src, from, digest)
+}
+
+// finishUpload completes an upload session opened at location with size
+// bytes read from body, in one PUT. A negative size streams the body with
+// chunked transfer encoding.
+func (r *RegistryClient) finishUpload(ctx context.Context, location, digest string, body io.Reader, size int64) error {
+	location, err := r.resolveLocation(location)
+	if err != nil {
+		return err
+	}
+	upload, err := url.Parse(location)
+	if err != nil {
+		return fmt.Errorf("invalid upload location %s: %w", location, err)
+	}
+	uploadQuery := upload.Query()
+	uploadQuery.Set("digest", digest)
+	upload.RawQuery = uploadQuery.Encode()
+
+	resp, err := r.send(ctx, http.MethodPut, upload.String(), body, size, map[string]string{
+		"Content-Type": "application/octet-stream",
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// resolveLocation makes an upload Location header absolute.
+func (r *RegistryClient) resolveLocation(location string) (string, error) {
+	if location == "" {
+		return "", errors.New("registry did not return an upload location")
+	}
+	base, err := url.Parse(r.baseURL + "/")
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid upload location %s: %w", location, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// manifestURL returns the API URL of a manifest reference.
+func (r *RegistryClient) manifestURL(repository, reference string) string {
+	return fmt.Sprintf("%s/v2/%s/manifests/%s", r.baseURL, repository, reference)
+}
+
+// do sends an authenticated registry request. Non-2xx responses are returned
+// as an *APIError.
+func (r *RegistryClient) do(ctx context.Context, method, rawURL string, body []byte, headers map[string]string) (*http.Response, error) {
+	if body == nil {
+		return r.send(ctx, method, rawURL, nil, 0, headers)
+	}
+	return r.send(ctx, method, rawURL, bytes.NewReader(body), int64(len(body)), headers)
+}
+
+// send is do with a streamed body of size bytes; a negative size is unknown.
+func (r *RegistryClient) send(ctx context.Context, method, rawURL string, body io.Reader, size int64, headers map[string]string) (*http.Response, error) {
+	token, err := r.credentials.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.SetBasicAuth(accessTokenUsername, token)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, rawURL, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
+	}
+	return resp, nil
+}
+
+// manifestDigest returns the digest the registry reported for a manifest,
+// computing it from the content when the header is missing.
+func manifestDigest(header http.Header, data []byte) string {
+	if digest := header.Get("Docker-Content-Digest"); digest != "" {
+		return digest
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Registry returns a registry API client for the client's registry host.
+func (c *GCRClient) Registry() *RegistryClient {
+	return NewRegistryClient(c.GetRegistryHost(), c.config.Endpoints, c.credentials)
+}
+
+// RepositoryPath returns the registry repository path of an image, the image
+// path without its host.
+func (c *GCRClient) RepositoryPath(image string) string {
+	_, path, _ := strings.Cut(c.GetImagePath(image), "/")
+	return path
+}
+
+// DeleteTag removes a tag from an image, leaving the manifest it pointed to.
+// Artifact Registry tags are deleted through its REST API; legacy GCR untags
+// through the registry API.
+func (c *GCRClient) DeleteTag(ctx context.Context, image, tag string) error {
+	if !c.config.ArtifactRegistry {
+		return c.Registry().DeleteManifest(ctx, c.RepositoryPath(image), tag)
+	}
+
+	token, err := c.credentials.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain access token: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/packages/%s/tags/%s",
+		strings.TrimSuffix(c.config.Endpoints.ArtifactRegistry, "/"),
+		c.repositoryName(c.config.Region), url.PathEscape(image), url.PathEscape(tag))
+	return callAPI(ctx, c.credentials.httpClient, http.MethodDelete, endpoint, token, nil, nil)
+}
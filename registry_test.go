@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRegistry is an in-memory Docker registry serving the manifest and blob
+// endpoints the plugin uses. It accepts "good-token" and "sa-token" as
+// oauth2accesstoken passwords.
+type fakeRegistry struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	tags      map[string]map[string]string    // repository → tag → digest
+	manifests map[string]map[string]*Manifest // repository → digest → manifest
+	blobs     map[string]map[string][]byte    // repository → digest → content
+	uploaded  map[string]map[string]time.Time // repository → digest → upload time
+	mounts    int
+	uploads   int
+
+	// NoMount makes the registry decline cross-repository blob mounts.
+	NoMount bool
+
+	// PageSize paginates tag listings when set.
+	PageSize int
+}
+
+// newFakeRegistry starts an empty fake registry.
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	t.Helper()
+
+	r := &fakeRegistry{
+		tags:      map[string]map[string]string{},
+		manifests: map[string]map[string]*Manifest{},
+		blobs:     map[string]map[string][]byte{},
+		uploaded:  map[string]map[string]time.Time{},
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// sha256Digest returns the content digest of data.
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// SeedImage stores a single-platform image in repository under tag and
+// returns its digest. Layers are distinguished by their content.
+func (r *fakeRegistry) SeedImage(repository, tag string, layers ...string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	content := manifestContent{Config: &manifestDescriptor{Digest: r.putBlob(repository, config)}}
+	for _, layer := range layers {
+		content.Layers = append(content.Layers, manifestDescriptor{Digest: r.putBlob(repository, []byte(layer))})
+	}
+
+	return r.putManifest(repository, tag, "application/vnd.docker.distribution.manifest.v2+json", content)
+}
+
+// SeedIndex stores a multi-platform index of single-layer images and returns
+// its digest.
+func (r *fakeRegistry) SeedIndex(repository, tag string, layers ...string) string {
+	var children []manifestDescriptor
+	for _, layer := range layers {
+		digest := r.SeedImage(repository, "", layer)
+		children = append(children, manifestDescriptor{Digest: digest})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.putManifest(repository, tag, "application/vnd.oci.image.index.v1+json", manifestContent{Manifests: children})
+}
+
+// Digest returns the digest tag points to in repository, or "" if untagged.
+func (r *fakeRegistry) Digest(repository, tag string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tags[repository][tag]
+}
+
+// HasManifest reports whether repository stores the manifest digest.
+func (r *fakeRegistry) HasManifest(repository, digest string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.manifests[repository][digest]
+	return ok
+}
+
+func (r *fakeRegistry) putBlob(repository string, data []byte) string {
+	digest := sha256Digest(data)
+	if r.blobs[repository] == nil {
+		r.blobs[repository] = map[string][]byte{}
+	}
+	r.blobs[repository][digest] = data
+	return digest
+}
+
+// SeedReferrer stores an untagged artifact manifest whose subject is the
+// manifest digest, such as a signature, and returns its digest.
+func (r *fakeRegistry) SeedReferrer(repository, subject, content string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, _ := json.Marshal(map[string]any{
+		"layers":  []manifestDescriptor{{Digest: r.putBlob(repository, []byte(content))}},
+		"subject": manifestDescriptor{Digest: subject},
+	})
+	return r.putRawManifest(repository, "", "application/vnd.oci.image.manifest.v1+json", data)
+}
+
+// Backdate moves the upload time of every manifest in repository age into
+// the past.
+func (r *fakeRegistry) Backdate(repository string, age time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for digest, uploaded := range r.uploaded[repository] {
+		r.uploaded[repository][digest] = uploaded.Add(-age)
+	}
+}
+
+func (r *fakeRegistry) putManifest(repository, tag, mediaType string, content manifestContent) string {
+	data, _ := json.Marshal(content)
+	return r.putRawManifest(repository, tag, mediaType, data)
+}
+
+func (r *fakeRegistry) putRawManifest(repository, tag, mediaType string, data []byte) string {
+	digest := sha256Digest(data)
+	if r.manifests[repository] == nil {
+		r.manifests[repository] = map[string]*Manifest{}
+		r.uploaded[repository] = map[string]time.Time{}
+	}
+	r.manifests[repository][digest] = &Manifest{MediaType: mediaType, Digest: digest, Data: data}
+	if _, ok := r.uploaded[repository][digest]; !ok {
+		r.uploaded[repository][digest] = time.Now()
+	}
+	if tag != "" {
+		if r.tags[repository] == nil {
+			r.tags[repository] = map[string]string{}
+		}
+		r.tags[repository][tag] = digest
+	}
+	return digest
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	user, password, ok := req.BasicAuth()
+	if !ok || user != accessTokenUsername || (password != "good-token" && password != "sa-token") {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.HasSuffix(path, "/tags/list"):
+		r.serveTags(w, req, strings.TrimSuffix(path, "/tags/list"))
+	case strings.Contains(path, "/manifests/"):
+		repository, reference, _ := strings.Cut(path, "/manifests/")
+		r.serveManifest(w, req, repository, reference)
+	case strings.Contains(path, "/blobs/uploads/"):
+		repository, id, _ := strings.Cut(path, "/blobs/uploads/")
+		r.serveUpload(w, req, repository, id)
+	case strings.Contains(path, "/blobs/"):
+		repository, digest, _ := strings.Cut(path, "/blobs/")
+		data, ok := r.blobs[repository][digest]
+		if !ok {
+			registryError(w, http.StatusNotFound, "BLOB_UNKNOWN")
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *fakeRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repository, reference string) {
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		digest = r.tags[repository][reference]
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		manifest, ok := r.manifests[repository][digest]
+		if !ok {
+			registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN")
+			return
+		}
+		w.Header().Set("Content-Type", manifest.MediaType)
+		w.Header().Set("Docker-Content-Digest", manifest.Digest)
+		_, _ = w.Write(manifest.Data)
+	case http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		var content manifestContent
+		_ = json.Unmarshal(data, &content)
+		for _, child := range content.Manifests {
+			if _, ok := r.manifests[repository][child.Digest]; !ok {
+				registryError(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN")
+				return
+			}
+		}
+		blobs := content.Layers
+		if content.Config != nil {
+			blobs = append(blobs, *content.Config)
+		}
+		for _, blob := range blobs {
+			if _, ok := r.blobs[repository][blob.Digest]; !ok {
+				registryError(w, http.StatusBadRequest, "BLOB_UNKNOWN")
+				return
+			}
+		}
+
+		tag := ""
+		if !strings.HasPrefix(reference, "sha256:") {
+			tag = reference
+		}
+		r.putRawManifest(repository, tag, req.Header.Get("Content-Type"), data)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if strings.HasPrefix(reference, "sha256:") {
+			delete(r.manifests[repository], reference)
+		} else if _, ok := r.tags[repository][reference]; ok {
+			delete(r.tags[repository], reference)
+		} else {
+			registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// serveTags lists tags in name order, PageSize at a time, with the Google
+// manifest extension describing the manifests of the page. Untagged
+// manifests are described on the last page.
+func (r *fakeRegistry) serveTags(w http.ResponseWriter, req *http.Request, repository string) {
+	tags := make([]string, 0, len(r.tags[repository]))
+	for tag := range r.tags[repository] {
+		if tag > req.URL.Query().Get("last") {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	lastPage := true
+	if r.PageSize > 0 && len(tags) > r.PageSize {
+		tags = tags[:r.PageSize]
+		lastPage = false
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=%d&last=%s>; rel="next"`, repository, r.PageSize, tags[len(tags)-1]))
+	}
+
+	manifests := map[string]ManifestInfo{}
+	for _, tag := range tags {
+		digest := r.tags[repository][tag]
+		info := r.manifestInfo(repository, digest)
+		info.Tags = append(manifests[digest].Tags, tag)
+		manifests[digest] = info
+	}
+	if lastPage {
+		tagged := map[string]bool{}
+		for _, digest := range r.tags[repository] {
+			tagged[digest] = true
+		}
+		for digest := range r.manifests[repository] {
+			if !tagged[digest] {
+				manifests[digest] = r.manifestInfo(repository, digest)
+			}
+		}
+	}
+	_ = json.NewEncoder(w).Encode(TagList{Name: repository, Tags: tags, Manifests: manifests})
+}
+
+// manifestInfo describes a manifest the way the Google listing does, sized
+// by the manifest and the blobs it references.
+func (r *fakeRegistry) manifestInfo(repository, digest string) ManifestInfo {
+	manifest := r.manifests[repository][digest]
+	size := len(manifest.Data)
+	var content manifestContent
+	_ = json.Unmarshal(manifest.Data, &content)
+	for _, layer := range content.Layers {
+		size += len(r.blobs[repository][layer.Digest])
+	}
+	return ManifestInfo{
+		MediaType:      manifest.MediaType,
+		ImageSizeBytes: strconv.Itoa(size),
+		TimeUploadedMs: strconv.FormatInt(r.uploaded[repository][digest].UnixMilli(), 10),
+	}
+}
+
+func (r *fakeRegistry) serveUpload(w http.ResponseWriter, req *http.Request, repository, id string) {
+	switch req.Method {
+	case http.MethodPost:
+		mount, from := req.URL.Query().Get("mount"), req.URL.Query().Get("from")
+		if data, ok := r.blobs[from][mount]; ok && !r.NoMount {
+			r.putBlob(repository, data)
+			r.mounts++
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/upload-%d", repository, r.uploads))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		// Monolithic uploads must declare their size up front
+		if req.ContentLength != int64(len(data)) {
+			registryError(w, http.StatusBadRequest, "SIZE_INVALID")
+			return
+		}
+		if sha256Digest(data) != req.URL.Query().Get("digest") {
+			registryError(w, http.StatusBadRequest, "DIGEST_INVALID")
+			return
+		}
+		r.putBlob(repository, data)
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func registryError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"errors": []map[string]string{{"code": code}}})
+}
+
+// testRegistryClient returns a registry client for the fake registry that
+// authenticates with "good-token".
+func testRegistryClient(t *testing.T, registry *fakeRegistry) *RegistryClient {
+	t.Helper()
+	api := newFakeGoogleAPI(t)
+	endpoints := api.Endpoints()
+	endpoints.Registry = registry.URL
+	credentials := NewCredentialManager(&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", endpoints)
+	return NewRegistryClient("us-docker.pkg.dev", endpoints, credentials)
+}
+
+func TestRegistryCopyManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   bool
+		noMount bool
+		to      string
+	}{
+		{name: "same repository", to: "proj/staging/app"},
+		{name: "mounted across repositories", to: "proj/prod/app"},
+		{name: "uploaded when mount is declined", noMount: true, to: "proj/prod/app"},
+		{name: "multi-platform index", index: true, to: "proj/prod/app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newFakeRegistry(t)
+			registry.NoMount = tt.noMount
+			client := testRegistryClient(t, registry)
+
+			var digest string
+			if tt.index {
+				digest = registry.SeedIndex("proj/staging/app", "staged", "amd64 layer", "arm64 layer")
+			} else {
+				digest = registry.SeedImage("proj/staging/app", "staged", "layer one", "layer two")
+			}
+
+			if err := client.CopyManifest(context.Background(), "proj/staging/app", digest, tt.to, "1.0.0"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := registry.Digest(tt.to, "1.0.0"); got != digest {
+				t.Errorf("expected %s:1.0.0 to be %s, got '%s'", tt.to, digest, got)
+			}
+			if tt.noMount && registry.uploads == 0 {
+				t.Error("expected blobs to be uploaded when mounts are declined")
+			}
+		})
+	}
+}
+
+func TestRegistryManifestDigest(t *testing.T) {
+	registry := newFakeRegistry(t)
+	client := testRegistryClient(t, registry)
+	digest := registry.SeedImage("proj/repo/app", "1.0.0", "layer")
+
+	got, err := client.ManifestDigest(context.Background(), "proj/repo/app", "1.0.0")
+	if err != nil || got != digest {
+		t.Errorf("expected digest %s, got '%s' (%v)", digest, got, err)
+	}
+
+	_, err = client.ManifestDigest(context.Background(), "proj/repo/app", "2.0.0")
+	if !isNotFound(err) {
+		t.Errorf("expected not found error for a missing tag, got %v", err)
+	}
+
+	if err := client.DeleteManifest(context.Background(), "proj/repo/app", "1.0.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.Digest("proj/repo/app", "1.0.0") != "" || !registry.HasManifest("proj/repo/app", digest) {
+		t.Error("expected the tag to be removed and the manifest kept")
+	}
+}
+
+func TestRegistryListTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		pageSize int
+	}{
+		{name: "single page"},
+		{name: "paginated", pageSize: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newFakeRegistry(t)
+			registry.PageSize = tt.pageSize
+			client := testRegistryClient(t, registry)
+
+			old := registry.SeedImage("proj/repo/app", "1.0.0", "old")
+			current := registry.SeedImage("proj/repo/app", "1.1.0", "new")
+			registry.SeedImage("proj/repo/app", "latest", "new")
+			registry.SeedImage("proj/repo/app", "stable", "old")
+			registry.SeedImage("proj/repo/app", "sha-abc", "new")
+
+			list, err := client.ListTags(context.Background(), "proj/repo/app")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := []string{"1.0.0", "1.1.0", "latest", "sha-abc", "stable"}
+			if !reflect.DeepEqual(list.Tags, want) {
+				t.Errorf("expected tags %v, got %v", want, list.Tags)
+			}
+
+			// Tags the listing does not describe are looked up one by one
+			delete(list.Manifests, old)
+			digests, err := client.TagDigests(context.Background(), list)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			wantDigests := map[string]string{
+				"1.0.0": old, "stable": old,
+				"1.1.0": current, "latest": current, "sha-abc": current,
+			}
+			if !reflect.DeepEqual(digests, wantDigests) {
+				t.Errorf("expected digests %v, got %v", wantDigests, digests)
+			}
+		})
+	}
+}
+
+func TestGCRClientDeleteTag(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+	endpoints := api.Endpoints()
+	endpoints.Registry = registry.URL
+	credentials := NewCredentialManager(&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", endpoints)
+
+	var deleted string
+	api.Mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		if !requireBearer(w, r, "good-token") || r.Method != http.MethodDelete {
+			return
+		}
+		deleted = r.URL.EscapedPath()
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	artifactRegistry := NewGCRClient(&GCRConfig{
+		Project: "proj", Region: "us", Repository: "repo", ArtifactRegistry: true,
+		Endpoints: endpoints, Credentials: credentials,
+	})
+	if err := artifactRegistry.DeleteTag(context.Background(), "team/app", "1.0.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "/v1/projects/proj/locations/us/repositories/repo/packages/team%2Fapp/tags/1.0.0"; deleted != expected {
+		t.Errorf("expected DELETE %s, got '%s'", expected, deleted)
+	}
+
+	registry.SeedImage("proj/app", "1.0.0", "layer")
+	legacy := NewGCRClient(&GCRConfig{
+		Project: "proj", Region: "us", Endpoints: endpoints, Credentials: credentials,
+	})
+	if err := legacy.DeleteTag(context.Background(), "app", "1.0.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.Digest("proj/app", "1.0.0") != "" {
+		t.Error("expected the legacy GCR tag to be removed through the registry API")
+	}
+}
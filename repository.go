@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+)
+
+const (
+	// operationPollInterval is how often a long-running operation is polled.
+	operationPollInterval = 2 * time.Second
+
+	// operationTimeout bounds how long repository creation is waited for.
+	operationTimeout = 5 * time.Minute
+)
+
+var (
+	// labelKeyPattern and labelValuePattern are the Google Cloud label rules.
+	labelKeyPattern   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	labelValuePattern = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+
+	// kmsKeyPattern is the resource name of a Cloud KMS key.
+	kmsKeyPattern = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+)
+
+// RepositorySettings are the settings an Artifact Registry repository is
+// created with. Labels, ImmutableTags and CleanupPolicies are left alone by
+// reconciliation when nil.
+type RepositorySettings struct {
+	Format        string
+	Description   string
+	Labels        map[string]string
+	KMSKeyName    string
+	ImmutableTags *bool
+
+	// CleanupPolicies are the server-side cleanup policies of the repository.
+	CleanupPolicies []CleanupPolicyConfig
+
+	// Reconcile updates existing repositories to match these settings.
+	Reconcile bool
+}
+
+// Repository is an Artifact Registry repository as returned by its REST API.
+type Repository struct {
+	Name         string                  `json:"name,omitempty"`
+	Format       string                  `json:"format,omitempty"`
+	Description  string                  `json:"description,omitempty"`
+	Labels       map[string]string       `json:"labels,omitempty"`
+	KMSKeyName   string                  `json:"kmsKeyName,omitempty"`
+	DockerConfig *repositoryDockerConfig `json:"dockerConfig,omitempty"`
+
+	CleanupPolicies map[string]CleanupPolicy `json:"cleanupPolicies,omitempty"`
+}
+
+// repositoryDockerConfig holds the Docker-specific repository settings.
+type repositoryDockerConfig struct {
+	ImmutableTags bool `json:"immutableTags"`
+}
+
+// operation is a long-running Artifact Registry operation.
+type operation struct {
+	Name  string `json:"name"`
+	Done  bool   `json:"done"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// parseRepositorySettings parses the "ensure_repository" block.
+func parseRepositorySettings(raw map[string]any) RepositorySettings {
+	parser := helpers.NewConfigParser(raw)
+
+	var labels map[string]string
+	if rawLabels := parser.GetMap("labels"); len(rawLabels) > 0 {
+		labels = make(map[string]string, len(rawLabels))
+		for key, value := range rawLabels {
+			labels[key] = fmt.Sprint(value)
+		}
+	}
+
+	var immutableTags *bool
+	if parser.Has("immutable_tags") {
+		value := parser.GetBool("immutable_tags", false)
+		immutableTags = &value
+	}
+
+	return RepositorySettings{
+		Format:          strings.ToUpper(parser.GetString("format", "", "DOCKER")),
+		Description:     parser.GetString("description", "", ""),
+		Labels:          labels,
+		KMSKeyName:      parser.GetString("kms_key_name", "", ""),
+		ImmutableTags:   immutableTags,
+		CleanupPolicies: parseCleanupPolicies(raw),
+		Reconcile:       parser.GetBool("reconcile", false),
+	}
+}
+
+// GetRepository fetches the Artifact Registry repository of region.
+func (c *GCRClient) GetRepository(ctx context.Context, region string) (*Repository, error) {
+	token, err := c.credentials.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	var repository Repository
+	endpoint := fmt.Sprintf("%s/v1/%s", c.artifactRegistryEndpoint(), c.repositoryName(region))
+	if err := callAPI(ctx, c.credentials.httpClient, http.MethodGet, endpoint, token, nil, &repository); err != nil {
+		return nil, err
+	}
+	return &repository, nil
+}
+
+// CreateRepository creates the Artifact Registry repository of region and
+// waits for the operation to finish.
+func (c *GCRClient) CreateRepository(ctx context.Context, region string, settings RepositorySettings, pinned map[string][]string) error {
+	token, err := c.credentials.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	repository := settings.desired(pinned)
+	repository.Format = settings.Format
+	repository.KMSKeyName = settings.KMSKeyName
+
+	query := url.Values{"repositoryId": {c.config.Repository}}
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/locations/%s/repositories?%s",
+		c.artifactRegistryEndpoint(), c.config.Project, region, query.Encode())
+
+	var op operation
+	if err := callAPI(ctx, c.credentials.httpClient, http.MethodPost, endpoint, token, repository, &op); err != nil {
+		return err
+	}
+	return c.waitOperation(ctx, &op)
+}
+
+// waitOperation polls a long-running operation until it is done.
+func (c *GCRClient) waitOperation(ctx context.Context, op *operation) error {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	for !op.Done {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("operation %s did not finish: %w", op.Name, ctx.Err())
+		case <-time.After(operationPollInterval):
+		}
+
+		token, err := c.credentials.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to obtain access token: %w", err)
+		}
+		endpoint := fmt.Sprintf("%s/v1/%s", c.artifactRegistryEndpoint(), op.Name)
+		if err := callAPI(ctx, c.credentials.httpClient, http.MethodGet, endpoint, token, nil, op); err != nil {
+			return fmt.Errorf("failed to poll operation %s: %w", op.Name, err)
+		}
+	}
+
+	if op.Error != nil {
+		return fmt.Errorf("operation %s failed: %s", op.Name, op.Error.Message)
+	}
+	return nil
+}
+
+// artifactRegistryEndpoint returns the Artifact Registry API base URL.
+func (c *GCRClient) artifactRegistryEndpoint() string {
+	return strings.TrimSuffix(c.credentials.endpoints.ArtifactRegistry, "/")
+}
+
+// ensureRepositories creates the Artifact Registry repositories of a target
+// that do not exist yet, in every region, and reconciles the settings of those
+// that do when asked to. Pending are the tags the release is about to push,
+// which tag_pattern cleanup policies keep along with the existing ones.
+// Legacy GCR creates its storage on the first push, so there is nothing to
+// ensure.
+func (p *GCRPlugin) ensureRepositories(ctx context.Context, cfg *Config, repositories, pending []string, credentials *CredentialManager, redactor *Redactor) ([]map[string]any, error) {
+	results := []map[string]any{}
+	settings := cfg.RepositorySettings
+	if (!cfg.EnsureRepository && !settings.Reconcile) || !cfg.ArtifactRegistry {
+		return results, nil
+	}
+
+	for _, repository := range repositories {
+		for _, region := range cfg.regions() {
+			config := cfg.gcrConfig(region, "", credentials)
+			config.Repository = repository
+			client := NewGCRClient(config)
+			name := client.repositoryName(region)
+
+			action := "exists"
+			var changes []string
+			current, err := client.GetRepository(ctx, region)
+			switch {
+			case err == nil && settings.Reconcile:
+				pinned, err := p.listPinnedTags(ctx, cfg, client, pending)
+				if err != nil {
+					return nil, err
+				}
+				action, changes, err = p.reconcileRepository(ctx, client, region, current, settings, pinned, cfg.DryRun, redactor)
+				if err != nil {
+					return nil, err
+				}
+			case err == nil:
+			case !isNotFound(err):
+				return nil, fmt.Errorf("failed to look up repository %s: %w", name, err)
+			case !cfg.EnsureRepository:
+				return nil, fmt.Errorf("repository %s does not exist; set ensure_repository.enabled to create it", name)
+			case cfg.DryRun:
+				action = "would create"
+				redactor.Printf("[dry-run] Would create repository %s\n", name)
+			default:
+				err := client.CreateRepository(ctx, region, settings, settings.pinnedTags(pending))
+				if err != nil && !isConflict(err) {
+					return nil, fmt.Errorf("failed to create repository %s: %w", name, err)
+				}
+				// A concurrent release may have created it in the meantime.
+				if err == nil {
+					action = "created"
+					redactor.Printf("Created repository: %s\n", name)
+				}
+			}
+
+			result := map[string]any{
+				"repository": repository,
+				"region":     region,
+				"name":       name,
+				"action":     action,
+			}
+			if len(changes) > 0 {
+				result["changes"] = changes
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// validateRepositorySettings checks the settings repositories are created with.
+func (p *GCRPlugin) validateRepositorySettings(vb *helpers.ValidationBuilder, cfg *Config) {
+	settings := cfg.RepositorySettings
+	if !cfg.EnsureRepository && !settings.Reconcile {
+		return
+	}
+
+	if settings.Format != "DOCKER" {
+		vb.AddError("ensure_repository.format", fmt.Sprintf("repository format '%s' cannot hold container images; use DOCKER", settings.Format))
+	}
+
+	if settings.KMSKeyName != "" && !kmsKeyPattern.MatchString(settings.KMSKeyName) {
+		vb.AddError("ensure_repository.kms_key_name",
+			"KMS key must be projects/PROJECT/locations/LOCATION/keyRings/RING/cryptoKeys/KEY")
+	}
+
+	keys := make([]string, 0, len(settings.Labels))
+	for key := range settings.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field := "ensure_repository.labels." + key
+		if !labelKeyPattern.MatchString(key) {
+			vb.AddError(field, "label keys must start with a lowercase letter and contain only lowercase letters, digits, '_' and '-' (max 63)")
+		} else if !labelValuePattern.MatchString(settings.Labels[key]) {
+			vb.AddError(field, "label values may contain only lowercase letters, digits, '_' and '-' (max 63)")
+		}
+	}
+
+	p.validateCleanupPolicies(vb, settings.CleanupPolicies)
+}
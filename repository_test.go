@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// fakeRepositories serves the Artifact Registry repository API with the
+// given repositories existing. Created repositories are recorded by name and
+// update masks in order.
+type fakeRepositories struct {
+	existing map[string]Repository
+	created  map[string]Repository
+	updates  []string
+	status   int
+	opError  string
+}
+
+func newFakeRepositories(api *fakeGoogleAPI, existing ...string) *fakeRepositories {
+	f := &fakeRepositories{existing: make(map[string]Repository), created: make(map[string]Repository)}
+	for _, name := range existing {
+		f.existing[name] = Repository{Name: name, Format: "DOCKER"}
+	}
+
+	api.Mux.HandleFunc("/v1/projects/", func(w http.ResponseWriter, r *http.Request) {
+		if !requireBearer(w, r, "good-token") {
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+		switch r.Method {
+		case http.MethodGet:
+			repository, ok := f.existing[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error": {"message": "repository not found"}}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(repository)
+		case http.MethodPatch:
+			var repository Repository
+			_ = json.NewDecoder(r.Body).Decode(&repository)
+			repository.Name = name
+			f.existing[name] = repository
+			f.updates = append(f.updates, r.URL.Query().Get("updateMask"))
+			_ = json.NewEncoder(w).Encode(repository)
+		case http.MethodPost:
+			if f.status != 0 {
+				w.WriteHeader(f.status)
+				return
+			}
+			var repository Repository
+			_ = json.NewDecoder(r.Body).Decode(&repository)
+			created := name + "/" + r.URL.Query().Get("repositoryId")
+			f.created[created] = repository
+			f.existing[created] = repository
+
+			op := map[string]any{"name": "projects/my-project/locations/us-central1/operations/1", "done": true}
+			if f.opError != "" {
+				op["error"] = map[string]any{"message": f.opError}
+			}
+			_ = json.NewEncoder(w).Encode(op)
+		}
+	})
+	return f
+}
+
+func TestEnsureRepositories(t *testing.T) {
+	const name = "projects/my-project/locations/us-central1/repositories/my-repo"
+
+	tests := []struct {
+		name        string
+		existing    []string
+		legacy      bool
+		dryRun      bool
+		status      int
+		opError     string
+		wantActions []string
+		wantCreated bool
+		wantErr     string
+	}{
+		{name: "existing repository", existing: []string{name}, wantActions: []string{"exists"}},
+		{name: "missing repository", wantActions: []string{"created"}, wantCreated: true},
+		{name: "dry run", dryRun: true, wantActions: []string{"would create"}},
+		{name: "created concurrently", status: http.StatusConflict, wantActions: []string{"exists"}},
+		{name: "creation denied", status: http.StatusForbidden, wantErr: "failed to create repository " + name},
+		{name: "operation failed", opError: "key is disabled", wantErr: "failed: key is disabled"},
+		{name: "legacy GCR", legacy: true, wantActions: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeGoogleAPI(t)
+			repositories := newFakeRepositories(api, tt.existing...)
+			repositories.status = tt.status
+			repositories.opError = tt.opError
+
+			p := &GCRPlugin{}
+			cfg := p.parseConfig(map[string]any{
+				"artifact_registry": !tt.legacy,
+				"project":           "my-project",
+				"repository":        "my-repo",
+				"image":             "my-app",
+				"endpoints":         api.EndpointsConfig(),
+				"dry_run":           tt.dryRun,
+				"ensure_repository": map[string]any{
+					"enabled":        true,
+					"description":    "Release images",
+					"labels":         map[string]any{"team": "platform"},
+					"kms_key_name":   "projects/kms/locations/us-central1/keyRings/ring/cryptoKeys/key",
+					"immutable_tags": true,
+				},
+			})
+			credentials := NewCredentialManager(&AuthConfig{Method: "access_token", AccessToken: "good-token"}, "", cfg.Endpoints)
+
+			results, err := p.ensureRepositories(context.Background(), cfg, cfg.repositories(), nil, credentials, &Redactor{out: &strings.Builder{}})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing '%s', got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var actions []string
+			for _, result := range results {
+				actions = append(actions, result["action"].(string))
+			}
+			if !reflect.DeepEqual(actions, tt.wantActions) {
+				t.Errorf("expected actions %v, got %v", tt.wantActions, actions)
+			}
+
+			created, ok := repositories.created[name]
+			if ok != tt.wantCreated {
+				t.Fatalf("expected created=%v, got %v", tt.wantCreated, repositories.created)
+			}
+			if !ok {
+				return
+			}
+			if created.Format != "DOCKER" || created.Description != "Release images" ||
+				created.Labels["team"] != "platform" || created.KMSKeyName == "" ||
+				created.DockerConfig == nil || !created.DockerConfig.ImmutableTags {
+				t.Errorf("expected configured settings, got %+v", created)
+			}
+		})
+	}
+}
+
+func TestPublishEnsuresRepositoryBeforePush(t *testing.T) {
+	logPath := installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	repositories := newFakeRepositories(api)
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":           "my-project",
+			"repository":        "my-repo",
+			"image":             "my-app",
+			"source_image":      "myapp:latest",
+			"auth":              map[string]any{"method": "access_token", "access_token": "good-token"},
+			"endpoints":         api.EndpointsConfig(),
+			"ensure_repository": map[string]any{"enabled": true},
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(repositories.created) != 1 {
+		t.Errorf("expected the repository to be created, got %v", repositories.created)
+	}
+	ensured, ok := resp.Outputs["repositories"].([]map[string]any)
+	if !ok || len(ensured) != 1 || ensured[0]["action"] != "created" {
+		t.Errorf("expected created repository in outputs, got %v", resp.Outputs["repositories"])
+	}
+
+	pushed := false
+	for _, line := range readFakeCommandLog(t, logPath) {
+		if strings.HasPrefix(line, "docker push us-central1-docker.pkg.dev/my-project/my-repo/my-app:1.2.3") {
+			pushed = true
+		}
+	}
+	if !pushed {
+		t.Error("expected the image to be pushed after the repository was created")
+	}
+}
+
+func TestValidateRepositorySettings(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   map[string]any
+		wantFields []string
+	}{
+		{name: "defaults", settings: map[string]any{}},
+		{name: "lowercase format", settings: map[string]any{"format": "docker"}},
+		{name: "maven format", settings: map[string]any{"format": "MAVEN"}, wantFields: []string{"ensure_repository.format"}},
+		{name: "invalid KMS key", settings: map[string]any{"kms_key_name": "my-key"}, wantFields: []string{"ensure_repository.kms_key_name"}},
+		{
+			name:       "invalid labels",
+			settings:   map[string]any{"labels": map[string]any{"Team": "x", "env": "Prod", "ok": "yes"}},
+			wantFields: []string{"ensure_repository.labels.Team", "ensure_repository.labels.env"},
+		},
+	}
+
+	p := &GCRPlugin{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := map[string]any{"enabled": true}
+			for k, v := range tt.settings {
+				settings[k] = v
+			}
+			cfg := p.parseConfig(map[string]any{"ensure_repository": settings})
+
+			vb := helpers.NewValidationBuilder()
+			p.validateRepositorySettings(vb, cfg)
+
+			var fields []string
+			for _, e := range vb.Build().Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, vb.Build().Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// versionTagPattern matches full version tags such as 1.2.3, v1.2.3 and
+// 1.2.3-rc.1. Partial versions such as 1.2 are floating tags.
+var versionTagPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?$`)
+
+// RetentionPolicy decides which version tags are pruned after a release.
+type RetentionPolicy struct {
+	Enabled          bool
+	KeepPatches      int
+	KeepMinors       int
+	PrunePrereleases bool
+}
+
+// parseRetentionPolicy parses the "retention" block.
+func parseRetentionPolicy(raw map[string]any) RetentionPolicy {
+	parser := helpers.NewConfigParser(raw)
+	return RetentionPolicy{
+		Enabled:          parser.GetBool("enabled", false),
+		KeepPatches:      parser.GetInt("keep_patches", 3),
+		KeepMinors:       parser.GetInt("keep_minors", 3),
+		PrunePrereleases: parser.GetBool("prune_prereleases", false),
+	}
+}
+
+// version is a parsed version tag.
+type version struct {
+	major, minor, patch int
+	prerelease          string
+}
+
+// parseVersionTag parses a full version tag.
+func parseVersionTag(tag string) (version, bool) {
+	m := versionTagPattern.FindStringSubmatch(tag)
+	if m == nil {
+		return version{}, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	patch, _ := strconv.Atoi(m[3])
+	return version{major: major, minor: minor, patch: patch, prerelease: m[4]}, true
+}
+
+// compare orders versions by semver precedence.
+func (v version) compare(o version) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			return d
+		}
+	}
+	return comparePrerelease(v.prerelease, o.prerelease)
+}
+
+// comparePrerelease orders prerelease identifiers; a release sorts after all
+// of its prereleases.
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			return an - bn
+		case aErr == nil && bErr != nil:
+			return -1
+		case aErr != nil && bErr == nil:
+			return 1
+		case aErr != nil && as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// retentionCandidates returns the version tags the policy prunes, oldest
+// first. The current version and anything newer are always kept, as are the
+// newest release of every major, the newest KeepMinors minors and the newest
+// KeepPatches releases of each of those minors.
+func retentionCandidates(tags []string, current version, policy RetentionPolicy) []string {
+	type versionTag struct {
+		tag     string
+		version version
+	}
+	var releases, prereleases []versionTag
+	for _, tag := range tags {
+		v, ok := parseVersionTag(tag)
+		if !ok {
+			continue
+		}
+		if v.prerelease == "" {
+			releases = append(releases, versionTag{tag, v})
+		} else {
+			prereleases = append(prereleases, versionTag{tag, v})
+		}
+	}
+	// The release counts even before it is pushed, as in dry-run
+	if current.prerelease == "" {
+		releases = append(releases, versionTag{"", current})
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].version.compare(releases[j].version) > 0
+	})
+
+	// Releases are visited newest first; v1.2.3 and 1.2.3 count once.
+	type minorKey struct{ major, minor int }
+	keep := make(map[version]bool)
+	counted := make(map[version]bool)
+	majors := make(map[int]bool)
+	minors := make(map[minorKey]int)
+	for _, release := range releases {
+		v := release.version
+		if counted[v] {
+			continue
+		}
+		counted[v] = true
+
+		if !majors[v.major] {
+			majors[v.major] = true
+			keep[v] = true
+		}
+
+		key := minorKey{v.major, v.minor}
+		patches, seen := minors[key]
+		if !seen && len(minors) >= policy.KeepMinors {
+			continue
+		}
+		if patches < policy.KeepPatches {
+			keep[v] = true
+		}
+		minors[key] = patches + 1
+	}
+
+	var candidates []versionTag
+	for _, release := range releases {
+		if !keep[release.version] && release.version.compare(current) < 0 {
+			candidates = append(candidates, release)
+		}
+	}
+	if policy.PrunePrereleases {
+		for _, prerelease := range prereleases {
+			if prerelease.version.compare(current) < 0 {
+				candidates = append(candidates, prerelease)
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].version.compare(candidates[j].version) < 0
+	})
+
+	result := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		result = append(result, candidate.tag)
+	}
+	return result
+}
+
+// prune deletes the version tags the retention policy no longer keeps from
+// every image and region of a target. Tags that share a digest with a
+// floating tag such as latest are kept, as are tags matching the tag_pattern
+// of a cleanup policy. On failure, the tags pruned so far are returned along
+// with the error.
+func (p *GCRPlugin) prune(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, credentials *CredentialManager, redactor *Redactor) ([]string, error) {
+	pruned := []string{}
+	current, ok := parseVersionTag(req.Context.Version)
+	if !ok {
+		redactor.Warnf("release version '%s' is not a semantic version; skipping retention", req.Context.Version)
+		return pruned, nil
+	}
+
+	for _, image := range cfg.images() {
+		for _, region := range cfg.regions() {
+			config := cfg.gcrConfig(region, "", credentials)
+			config.Repository = image.Repository
+			client := NewGCRClient(config)
+			registry := client.Registry()
+			path := client.GetImagePath(image.Image)
+
+			list, err := registry.ListTags(ctx, client.RepositoryPath(image.Image))
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return pruned, fmt.Errorf("failed to list tags of %s: %w", path, err)
+			}
+
+			candidates := retentionCandidates(list.Tags, current, cfg.Retention)
+			if len(candidates) == 0 {
+				continue
+			}
+
+			digests, err := registry.TagDigests(ctx, list)
+			if err != nil {
+				return pruned, err
+			}
+			floating := make(map[string]string)
+			sort.Strings(list.Tags)
+			for _, tag := range list.Tags {
+				if _, ok := parseVersionTag(tag); !ok {
+					if _, seen := floating[digests[tag]]; !seen {
+						floating[digests[tag]] = tag
+					}
+				}
+			}
+
+			for _, tag := range candidates {
+				ref := fmt.Sprintf("%s:%s", path, tag)
+				if id, ok := cfg.RepositorySettings.pin(tag); ok {
+					redactor.Printf("Keeping %s: matches the tag_pattern of cleanup policy %s\n", ref, id)
+					continue
+				}
+				if floatingTag, ok := floating[digests[tag]]; ok {
+					redactor.Printf("Keeping %s: referenced by %s\n", ref, floatingTag)
+					continue
+				}
+
+				if cfg.DryRun {
+					redactor.Printf("[dry-run] Would prune %s\n", ref)
+				} else {
+					if err := client.DeleteTag(ctx, image.Image, tag); err != nil {
+						return pruned, fmt.Errorf("failed to prune %s: %w", ref, err)
+					}
+					redactor.Printf("Pruned: %s\n", ref)
+				}
+				pruned = append(pruned, ref)
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// validateRetention checks the retention policy.
+func (p *GCRPlugin) validateRetention(vb *helpers.ValidationBuilder, cfg *Config) {
+	if !cfg.Retention.Enabled {
+		return
+	}
+	if cfg.Retention.KeepPatches < 1 {
+		vb.AddError("retention.keep_patches", "keep_patches must be at least 1")
+	}
+	if cfg.Retention.KeepMinors < 1 {
+		vb.AddError("retention.keep_minors", "keep_minors must be at least 1")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+func TestParseVersionTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want version
+		ok   bool
+	}{
+		{tag: "1.2.3", want: version{1, 2, 3, ""}, ok: true},
+		{tag: "v10.0.1", want: version{10, 0, 1, ""}, ok: true},
+		{tag: "2.0.0-rc.1", want: version{2, 0, 0, "rc.1"}, ok: true},
+		{tag: "1.2"},
+		{tag: "latest"},
+		{tag: "01.2.3"},
+		{tag: "1.2.3.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, ok := parseVersionTag(tt.tag)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("expected %+v (%v), got %+v (%v)", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// Each version sorts before the next, per the semver precedence rules.
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0", "2.0.0",
+	}
+	for i := 0; i+1 < len(ordered); i++ {
+		a, _ := parseVersionTag(ordered[i])
+		b, _ := parseVersionTag(ordered[i+1])
+		if a.compare(b) >= 0 || b.compare(a) <= 0 {
+			t.Errorf("expected %s < %s", ordered[i], ordered[i+1])
+		}
+	}
+}
+
+func TestRetentionCandidates(t *testing.T) {
+	tags := []string{
+		"latest", "1.2", "sha-abc",
+		"1.0.0", "1.0.1",
+		"1.1.0", "1.1.1", "1.1.2",
+		"2.0.0", "2.0.1", "2.1.0", "2.1.1", "2.1.2", "2.1.3",
+		"2.2.0-rc.1", "3.0.0",
+	}
+
+	tests := []struct {
+		name    string
+		tags    []string
+		current string
+		policy  RetentionPolicy
+		want    []string
+	}{
+		{
+			name:    "keeps recent patches and minors and every major's latest",
+			tags:    tags,
+			current: "2.1.3",
+			policy:  RetentionPolicy{KeepPatches: 2, KeepMinors: 2},
+			want:    []string{"1.0.0", "1.0.1", "1.1.0", "1.1.1", "2.0.0", "2.0.1", "2.1.0", "2.1.1"},
+		},
+		{
+			name:    "never prunes the current version or newer",
+			tags:    tags,
+			current: "1.1.2",
+			policy:  RetentionPolicy{KeepPatches: 1, KeepMinors: 1},
+			want:    []string{"1.0.0", "1.0.1", "1.1.0", "1.1.1"},
+		},
+		{
+			name:    "prunes older prereleases when asked to",
+			tags:    []string{"1.0.0-rc.1", "1.0.0", "1.1.0-rc.1", "1.1.0-rc.2"},
+			current: "1.1.0-rc.2",
+			policy:  RetentionPolicy{KeepPatches: 1, KeepMinors: 1, PrunePrereleases: true},
+			want:    []string{"1.0.0-rc.1", "1.1.0-rc.1"},
+		},
+		{
+			name:    "keeps prereleases by default",
+			tags:    []string{"1.0.0-rc.1", "1.0.0", "1.1.0-rc.1", "1.1.0"},
+			current: "1.1.0",
+			policy:  RetentionPolicy{KeepPatches: 1, KeepMinors: 1},
+			want:    []string{"1.0.0"},
+		},
+		{
+			name:    "prefixed and plain tags of a version count once",
+			tags:    []string{"1.0.0", "v1.0.1", "1.0.1", "v1.0.2"},
+			current: "1.0.2",
+			policy:  RetentionPolicy{KeepPatches: 2, KeepMinors: 1},
+			want:    []string{"1.0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, _ := parseVersionTag(tt.current)
+			got := retentionCandidates(tt.tags, current, tt.policy)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPublishPrunesOldVersions(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+	}{
+		{name: "prune"},
+		{name: "dry run", dryRun: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakeCommands(t)
+			api := newFakeGoogleAPI(t)
+			registry := newFakeRegistry(t)
+
+			const repository = "my-project/my-app"
+			registry.SeedImage(repository, "1.0.0", "1.0.0")
+			registry.SeedImage(repository, "1.1.0", "1.1.0")
+			registry.SeedImage(repository, "stable", "1.1.0")
+			registry.SeedImage(repository, "1.1.1", "1.1.1")
+			registry.SeedImage(repository, "2.0.0", "2.0.0")
+			registry.SeedImage(repository, "relicta-staging-2.0.1", "2.0.1")
+
+			config := cleanupConfig(api, registry, "")
+			delete(config, "cleanup")
+			config["dry_run"] = tt.dryRun
+			config["retention"] = map[string]any{"enabled": true, "keep_patches": 1, "keep_minors": 1}
+
+			p := &GCRPlugin{}
+			resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+				Hook:    plugin.HookPostPublish,
+				Config:  config,
+				Context: plugin.ReleaseContext{Version: "2.0.1"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// 1.1.0 is kept because stable points to it.
+			want := []string{"gcr.io/my-project/my-app:1.0.0", "gcr.io/my-project/my-app:2.0.0"}
+			if !reflect.DeepEqual(resp.Outputs["pruned_tags"], want) {
+				t.Errorf("expected pruned tags %v, got %v", want, resp.Outputs["pruned_tags"])
+			}
+
+			for _, tag := range []string{"1.0.0", "2.0.0"} {
+				if exists := registry.Digest(repository, tag) != ""; exists != tt.dryRun {
+					t.Errorf("expected %s to exist=%v", tag, tt.dryRun)
+				}
+			}
+			for _, tag := range []string{"1.1.0", "stable", "1.1.1"} {
+				if registry.Digest(repository, tag) == "" {
+					t.Errorf("expected %s to be kept", tag)
+				}
+			}
+		})
+	}
+}
+
+func TestPublishRetentionKeepsPinnedTags(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+
+	const repository = "my-project/my-app"
+	registry.SeedImage(repository, "1.0.0", "1.0.0")
+	registry.SeedImage(repository, "1.1.0", "1.1.0")
+	registry.SeedImage(repository, "2.0.0", "2.0.0")
+	registry.SeedImage(repository, "relicta-staging-2.0.1", "2.0.1")
+
+	config := cleanupConfig(api, registry, "")
+	delete(config, "cleanup")
+	config["retention"] = map[string]any{"enabled": true, "keep_patches": 1, "keep_minors": 1}
+	config["ensure_repository"] = map[string]any{
+		"cleanup_policies": []any{
+			map[string]any{"id": "keep-first-minor", "action": "keep", "tag_pattern": `^1\.0\.`},
+		},
+	}
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook:    plugin.HookPostPublish,
+		Config:  config,
+		Context: plugin.ReleaseContext{Version: "2.0.1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 1.1.0 is the newest release of major 1; 1.0.0 is pinned.
+	want := []string{"gcr.io/my-project/my-app:2.0.0"}
+	if !reflect.DeepEqual(resp.Outputs["pruned_tags"], want) {
+		t.Errorf("expected pruned tags %v, got %v", want, resp.Outputs["pruned_tags"])
+	}
+	if registry.Digest(repository, "1.0.0") == "" {
+		t.Error("expected the pinned 1.0.0 to be kept")
+	}
+}
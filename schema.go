@@ -0,0 +1,281 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+)
+
+// configSchema is the JSON Schema of the plugin configuration.
+//
+//go:embed schema.json
+var configSchema string
+
+// schemaNode is the subset of JSON Schema the plugin validates against.
+type schemaNode struct {
+	Type                 string                 `json:"type"`
+	Enum                 []string               `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	AdditionalProperties *additionalProperties  `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	Ref                  string                 `json:"$ref"`
+	Defs                 map[string]*schemaNode `json:"$defs"`
+}
+
+// additionalProperties is either a boolean or the schema of unlisted keys.
+type additionalProperties struct {
+	Allowed bool
+	Schema  *schemaNode
+}
+
+// UnmarshalJSON accepts both forms of additionalProperties.
+func (a *additionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// parsedConfigSchema is configSchema decoded once at startup.
+var parsedConfigSchema = mustParseSchema(configSchema)
+
+// mustParseSchema decodes an embedded schema, panicking if it is malformed.
+func mustParseSchema(data string) *schemaNode {
+	var root schemaNode
+	if err := json.Unmarshal([]byte(data), &root); err != nil {
+		panic(fmt.Sprintf("invalid config schema: %v", err))
+	}
+	return &root
+}
+
+// validateSchema reports every value in config that does not match the
+// configuration schema.
+func validateSchema(vb *helpers.ValidationBuilder, config map[string]any) {
+	root := parsedConfigSchema
+	root.validate(vb, root, "", config)
+}
+
+// validate checks value against the node. Field names are built from path.
+func (n *schemaNode) validate(vb *helpers.ValidationBuilder, root *schemaNode, path string, value any) {
+	if n.Ref != "" {
+		ref, ok := root.Defs[strings.TrimPrefix(n.Ref, "#/$defs/")]
+		if !ok {
+			panic(fmt.Sprintf("config schema: unresolved reference %s", n.Ref))
+		}
+		ref.validate(vb, root, path, value)
+		return
+	}
+
+	field := path
+	if field == "" {
+		field = "config"
+	}
+
+	switch n.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			vb.AddError(field, fmt.Sprintf("expected an object, got %s", describeType(value)))
+			return
+		}
+		n.validateObject(vb, root, path, obj)
+	case "array":
+		items, ok := toArray(value)
+		if !ok {
+			vb.AddError(field, fmt.Sprintf("expected a list, got %s", describeType(value)))
+			return
+		}
+		if n.Items != nil {
+			for i, item := range items {
+				n.Items.validate(vb, root, fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			vb.AddError(field, fmt.Sprintf("expected a string, got %s", describeType(value)))
+			return
+		}
+		if len(n.Enum) > 0 && !containsString(n.Enum, s) {
+			vb.AddError(field, fmt.Sprintf("must be one of %s, got '%s'", quoteList(n.Enum), s))
+		}
+	case "boolean":
+		if !isBoolean(value) {
+			vb.AddError(field, fmt.Sprintf("expected true or false, got %s", describeType(value)))
+		}
+	case "integer":
+		i, ok := toInteger(value)
+		if !ok {
+			vb.AddError(field, fmt.Sprintf("expected an integer, got %s", describeType(value)))
+			return
+		}
+		if n.Minimum != nil && float64(i) < *n.Minimum {
+			vb.AddError(field, fmt.Sprintf("must be at least %g", *n.Minimum))
+		}
+	}
+}
+
+// validateObject checks the keys of an object, suggesting the closest known
+// key for unknown ones.
+func (n *schemaNode) validateObject(vb *helpers.ValidationBuilder, root *schemaNode, path string, obj map[string]any) {
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		property, ok := n.Properties[key]
+		if !ok {
+			switch {
+			case n.AdditionalProperties == nil:
+			case n.AdditionalProperties.Schema != nil:
+				n.AdditionalProperties.Schema.validate(vb, root, prefix+key, obj[key])
+			case !n.AdditionalProperties.Allowed:
+				vb.AddError(prefix+key, n.unknownKeyMessage(key))
+			}
+			continue
+		}
+		property.validate(vb, root, prefix+key, obj[key])
+	}
+}
+
+// unknownKeyMessage describes an unknown key, with a suggestion when a known
+// key is spelled similarly.
+func (n *schemaNode) unknownKeyMessage(key string) string {
+	best, bestDistance := "", math.MaxInt
+	for known := range n.Properties {
+		distance := levenshtein(key, known)
+		if distance < bestDistance || (distance == bestDistance && known < best) {
+			best, bestDistance = known, distance
+		}
+	}
+
+	if best != "" && bestDistance <= max(2, len(key)/3) {
+		return fmt.Sprintf("unknown key '%s'; did you mean '%s'?", key, best)
+	}
+	return fmt.Sprintf("unknown key '%s'", key)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// toArray accepts the list types the config parser understands.
+func toArray(value any) ([]any, bool) {
+	switch v := value.(type) {
+	case []any:
+		return v, true
+	case []string:
+		items := make([]any, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+// isBoolean accepts booleans and strings the config parser reads as booleans.
+func isBoolean(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return true
+	case string:
+		_, err := strconv.ParseBool(v)
+		return err == nil
+	}
+	return false
+}
+
+// toInteger accepts integers, whole floats and numeric strings.
+func toInteger(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int(v), true
+	case string:
+		i, err := strconv.Atoi(v)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// describeType names the type of a decoded config value for error messages.
+func describeType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("string '%s'", v)
+	case bool:
+		return "boolean"
+	case int, int64, float64:
+		return "number"
+	case []any, []string:
+		return "list"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteList formats values as 'a', 'b' or 'c'.
+func quoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + v + "'"
+	}
+	if len(quoted) < 2 {
+		return strings.Join(quoted, "")
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+)
+
+func TestConfigSchemaIsValidJSON(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(configSchema), &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	if schema["type"] != "object" {
+		t.Errorf("expected an object schema, got %v", schema["type"])
+	}
+
+	p := &GCRPlugin{}
+	if p.GetInfo().ConfigSchema != configSchema {
+		t.Error("expected GetInfo to expose the config schema")
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]any
+		expected map[string]string
+	}{
+		{
+			name: "valid config",
+			config: map[string]any{
+				"project":           "my-project",
+				"artifact_registry": "false",
+				"tags":              []string{"latest"},
+				"auth":              map[string]any{"method": "service_account", "key_max_age_days": 90.0},
+				"multi_region":      map[string]any{"enabled": true, "regions": []any{"us", "eu"}},
+				"images":            []any{map[string]any{"image": "api", "tags": []any{"latest"}}},
+				"targets":           []any{map[string]any{"name": "prod", "auth": map[string]any{"method": "gcloud"}}},
+			},
+			expected: map[string]string{},
+		},
+		{
+			name:   "tags given as a string",
+			config: map[string]any{"tags": "latest"},
+			expected: map[string]string{
+				"tags": "expected a list, got string 'latest'",
+			},
+		},
+		{
+			name:   "misspelled top-level key",
+			config: map[string]any{"sorce_image": "myapp:latest"},
+			expected: map[string]string{
+				"sorce_image": "unknown key 'sorce_image'; did you mean 'source_image'?",
+			},
+		},
+		{
+			name:   "unrelated key",
+			config: map[string]any{"kubernetes": true},
+			expected: map[string]string{
+				"kubernetes": "unknown key 'kubernetes'",
+			},
+		},
+		{
+			name: "nested errors",
+			config: map[string]any{
+				"auth":         map[string]any{"metod": "gcloud", "key_warn_age_days": "soon"},
+				"multi_region": map[string]any{"enabled": "yes please"},
+				"images":       []any{map[string]any{"image": "api", "tgas": []any{"latest"}}, "worker"},
+				"targets":      []any{map[string]any{"auth": map[string]any{"method": "password"}}},
+			},
+			expected: map[string]string{
+				"auth.metod":             "unknown key 'metod'; did you mean 'method'?",
+				"auth.key_warn_age_days": "expected an integer, got string 'soon'",
+				"multi_region.enabled":   "expected true or false, got string 'yes please'",
+				"images[0].tgas":         "unknown key 'tgas'; did you mean 'tags'?",
+				"images[1]":              "expected an object, got string 'worker'",
+				"targets[0].auth.method": "must be one of 'gcloud', 'service_account' or 'access_token', got 'password'",
+			},
+		},
+		{
+			name:   "negative threshold",
+			config: map[string]any{"auth": map[string]any{"key_max_age_days": -1}},
+			expected: map[string]string{
+				"auth.key_max_age_days": "must be at least 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vb := helpers.NewValidationBuilder()
+			validateSchema(vb, tt.config)
+
+			errors := map[string]string{}
+			for _, e := range vb.Build().Errors {
+				errors[e.Field] = e.Message
+			}
+			if !reflect.DeepEqual(errors, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, errors)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "", b: "abc", expected: 3},
+		{a: "tags", b: "tags", expected: 0},
+		{a: "tgas", b: "tags", expected: 2},
+		{a: "regoin", b: "region", expected: 2},
+		{a: "kitten", b: "sitting", expected: 3},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.expected {
+			t.Errorf("levenshtein(%q, %q): expected %d, got %d", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// defaultSecretManagerEndpoint is the Secret Manager REST API.
+const defaultSecretManagerEndpoint = "https://secretmanager.googleapis.com"
+
+// secretRefPrefix marks a config value as a Secret Manager reference.
+const secretRefPrefix = "sm://"
+
+// secretRefPattern matches the resource name of a secret version.
+var secretRefPattern = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+/versions/[^/]+$`)
+
+// isSecretRef reports whether a config value refers to Secret Manager.
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, secretRefPrefix)
+}
+
+// parseSecretRef returns the secret version resource name of an sm:// reference.
+func parseSecretRef(ref string) (string, error) {
+	name := strings.TrimPrefix(ref, secretRefPrefix)
+	if !secretRefPattern.MatchString(name) {
+		return "", fmt.Errorf("invalid Secret Manager reference %q: expected sm://projects/PROJECT/secrets/SECRET/versions/VERSION", ref)
+	}
+	return name, nil
+}
+
+// accessSecret fetches the payload of a secret version. The payload is only
+// held in memory.
+func accessSecret(ctx context.Context, client *http.Client, endpoint, token, ref string) (string, error) {
+	name, err := parseSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	url := fmt.Sprintf("%s/v1/%s:access", endpoint, name)
+	if err := callAPI(ctx, client, http.MethodGet, url, token, nil, &resp); err != nil {
+		return "", fmt.Errorf("failed to access secret %s: %w", name, err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode secret %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
+// secretBootstrapAuth returns the credentials used to read Secret Manager
+// references: the configured credentials that are not references themselves,
+// falling back to gcloud.
+func secretBootstrapAuth(auth *AuthConfig) *AuthConfig {
+	switch {
+	case auth.Method == "access_token" && auth.AccessToken != "" && !isSecretRef(auth.AccessToken):
+		return &AuthConfig{Method: "access_token", AccessToken: auth.AccessToken}
+	case auth.Method == "access_token" && auth.AccessToken == "" && auth.AccessTokenFile != "":
+		return &AuthConfig{Method: "access_token", AccessTokenFile: auth.AccessTokenFile}
+	case auth.Method == "service_account" && auth.KeyFile != "":
+		return &AuthConfig{Method: "service_account", KeyFile: auth.KeyFile}
+	default:
+		return &AuthConfig{Method: "gcloud"}
+	}
+}
+
+// resolveSecrets replaces Secret Manager references in the secret fields of
+// cfg with their values and registers them with the redactor. Values are
+// cached per reference, so targets that inherit a reference fetch it once.
+// An access token read from Secret Manager is stored for the registry
+// directly, like an inline token.
+func resolveSecrets(ctx context.Context, cfg *Config, redactor *Redactor) error {
+	if cfg.secrets == nil {
+		cfg.secrets = make(map[string]string)
+	}
+	tokenRef := isSecretRef(cfg.AccessToken)
+	fields := []*string{&cfg.KeyJSON, &cfg.AccessToken}
+
+	var bootstrap *CredentialManager
+	var token string
+	for _, field := range fields {
+		if !isSecretRef(*field) {
+			continue
+		}
+
+		value, ok := cfg.secrets[*field]
+		if !ok {
+			if bootstrap == nil {
+				bootstrap = NewCredentialManager(secretBootstrapAuth(cfg.authConfig()), "", cfg.Endpoints)
+				var err error
+				if token, err = bootstrap.Token(ctx); err != nil {
+					return fmt.Errorf("failed to obtain credentials for Secret Manager: %w", err)
+				}
+			}
+
+			var err error
+			value, err = accessSecret(ctx, bootstrap.httpClient, cfg.Endpoints.SecretManager, token, *field)
+			if err != nil {
+				return err
+			}
+			cfg.secrets[*field] = value
+		}
+		redactor.Add(value)
+		*field = value
+	}
+
+	if tokenRef {
+		cfg.TokenLogin = true
+	}
+	return nil
+}
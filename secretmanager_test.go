@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// serveSecrets registers Secret Manager access handlers for the given
+// secret versions, readable with token.
+func serveSecrets(api *fakeGoogleAPI, token string, secrets map[string]string) {
+	api.Mux.HandleFunc("/v1/projects/", func(w http.ResponseWriter, r *http.Request) {
+		if !requireBearer(w, r, token) {
+			return
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), ":access")
+		value, ok := secrets[name]
+		if !ok || !strings.HasSuffix(r.URL.Path, ":access") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name":    name,
+			"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte(value))},
+		})
+	})
+}
+
+func TestParseSecretRef(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected string
+		wantErr  bool
+	}{
+		{ref: "sm://projects/my-project/secrets/gcr-key/versions/latest", expected: "projects/my-project/secrets/gcr-key/versions/latest"},
+		{ref: "sm://projects/123/secrets/gcr-key/versions/7", expected: "projects/123/secrets/gcr-key/versions/7"},
+		{ref: "sm://projects/my-project/secrets/gcr-key", wantErr: true},
+		{ref: "sm://gcr-key", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			name, err := parseSecretRef(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if name != tt.expected {
+				t.Errorf("expected '%s', got '%s'", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestAccessSecret(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	serveSecrets(api, "good-token", map[string]string{
+		"projects/my-project/secrets/token/versions/1": "secret-value",
+	})
+
+	value, err := accessSecret(context.Background(), api.Client(), api.URL, "good-token",
+		"sm://projects/my-project/secrets/token/versions/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != "secret-value" {
+		t.Errorf("expected 'secret-value', got '%s'", value)
+	}
+
+	_, err = accessSecret(context.Background(), api.Client(), api.URL, "good-token",
+		"sm://projects/my-project/secrets/missing/versions/1")
+	if err == nil {
+		t.Error("expected error for missing secret")
+	}
+}
+
+func TestSecretBootstrapAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     *AuthConfig
+		expected string
+	}{
+		{
+			name:     "key from secret manager uses gcloud",
+			auth:     &AuthConfig{Method: "service_account", KeyJSON: "sm://projects/p/secrets/s/versions/1"},
+			expected: "gcloud",
+		},
+		{
+			name:     "plain access token is reused",
+			auth:     &AuthConfig{Method: "access_token", AccessToken: "good-token"},
+			expected: "access_token",
+		},
+		{
+			name:     "access token from secret manager uses gcloud",
+			auth:     &AuthConfig{Method: "access_token", AccessToken: "sm://projects/p/secrets/s/versions/1"},
+			expected: "gcloud",
+		},
+		{
+			name:     "key file is reused",
+			auth:     &AuthConfig{Method: "service_account", KeyFile: "/path/to/key.json"},
+			expected: "service_account",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if method := secretBootstrapAuth(tt.auth).Method; method != tt.expected {
+				t.Errorf("expected '%s', got '%s'", tt.expected, method)
+			}
+		})
+	}
+}
+
+func TestExecuteResolvesSecretManagerKey(t *testing.T) {
+	logPath := installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	key := testServiceAccountKey(t, "my-project")
+	keyJSON := testServiceAccountKeyJSON(t, key)
+
+	// gcloud's token ("good-token") reads the secret holding the key.
+	serveSecrets(api, "good-token", map[string]string{
+		"projects/my-project/secrets/gcr-key/versions/latest": keyJSON,
+	})
+	key.TokenURI = api.URL + "/token"
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":      "my-project",
+			"repository":   "my-repo",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+			"auth": map[string]any{
+				"method":   "service_account",
+				"key_json": "sm://projects/my-project/secrets/gcr-key/versions/latest",
+			},
+			"endpoints": map[string]any{
+				"tokeninfo":      api.URL + "/tokeninfo",
+				"token":          api.URL + "/token",
+				"secret_manager": api.URL,
+			},
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Success {
+		t.Fatalf("expected success, got %+v", resp)
+	}
+
+	// The resolved key logs in like an inline key_json.
+	loggedIn := false
+	for _, line := range readFakeCommandLog(t, logPath) {
+		if strings.HasPrefix(line, "docker login -u _json_key --password-stdin") {
+			loggedIn = true
+		}
+	}
+	if !loggedIn {
+		t.Errorf("expected a key login, got %v", readFakeCommandLog(t, logPath))
+	}
+}
+
+func TestResolveSecretsCachesReferences(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	var accesses atomic.Int32
+	serveSecrets(api, "good-token", map[string]string{
+		"projects/my-project/secrets/token/versions/1": "secret-token",
+	})
+	api.Mux.HandleFunc("/v1/projects/my-project/secrets/token/versions/1:access", func(w http.ResponseWriter, r *http.Request) {
+		accesses.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("secret-token"))},
+		})
+	})
+
+	p := &GCRPlugin{}
+	cfg := p.parseConfig(map[string]any{
+		"project":    "my-project",
+		"repository": "my-repo",
+		"auth":       map[string]any{"method": "access_token", "access_token": "sm://projects/my-project/secrets/token/versions/1"},
+		"endpoints":  api.EndpointsConfig(),
+		"targets": []any{
+			map[string]any{"name": "prod"},
+			map[string]any{"name": "mirror", "project": "mirror-project"},
+		},
+	})
+
+	for range 2 {
+		for _, target := range cfg.targets() {
+			if err := resolveSecrets(context.Background(), target, &Redactor{out: io.Discard}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if target.AccessToken != "secret-token" || !target.TokenLogin {
+				t.Errorf("expected the resolved token with token login, got '%s' (%v)", target.AccessToken, target.TokenLogin)
+			}
+		}
+	}
+	if accesses.Load() != 1 {
+		t.Errorf("expected the secret to be fetched once, got %d", accesses.Load())
+	}
+}
+
+func TestTokenLoginDoesNotStoreKey(t *testing.T) {
+	api := newFakeGoogleAPI(t)
+	key := testServiceAccountKey(t, "my-project")
+	configDir := t.TempDir()
+
+	credentials := NewCredentialManager(&AuthConfig{
+		Method:     "service_account",
+		KeyJSON:    testServiceAccountKeyJSON(t, key),
+		TokenLogin: true,
+	}, configDir, api.Endpoints())
+
+	if err := credentials.Authenticate(context.Background(), "us-docker.pkg.dev"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), base64.StdEncoding.EncodeToString([]byte("_json_key"))[:8]) {
+		t.Error("expected no key login in docker config")
+	}
+
+	auths := readDockerAuths(t, configDir)
+	if auths["us-docker.pkg.dev"] != "oauth2accesstoken:sa-token" {
+		t.Errorf("expected short-lived token login, got %v", auths)
+	}
+}
+
+func TestValidateSecretManagerReferences(t *testing.T) {
+	p := &GCRPlugin{}
+
+	resp, err := p.Validate(context.Background(), map[string]any{
+		"project":      "my-project",
+		"repository":   "my-repo",
+		"image":        "my-app",
+		"source_image": "myapp:latest",
+		"auth": map[string]any{
+			"method":   "service_account",
+			"key_json": "sm://projects/my-project/secrets/gcr-key/versions/latest",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Errors) != 0 {
+		t.Errorf("expected valid reference to pass, got %v", resp.Errors)
+	}
+
+	resp, err = p.Validate(context.Background(), map[string]any{
+		"project":      "my-project",
+		"repository":   "my-repo",
+		"image":        "my-app",
+		"source_image": "myapp:latest",
+		"auth": map[string]any{
+			"method":       "access_token",
+			"access_token": "sm://gcr-token",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Field != "auth.access_token" {
+		t.Errorf("expected malformed reference error, got %v", resp.Errors)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// privateKeyIDPattern matches the hex key ID Google assigns to service account keys.
+var privateKeyIDPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ServiceAccountKey holds the fields of a service account JSON key.
+type ServiceAccountKey struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	ClientID     string `json:"client_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// readServiceAccountKey returns the raw key JSON from key_file or key_json.
+func readServiceAccountKey(auth *AuthConfig) ([]byte, error) {
+	if auth.KeyFile != "" {
+		data, err := os.ReadFile(auth.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		return data, nil
+	}
+
+	if auth.KeyJSON != "" {
+		return []byte(auth.KeyJSON), nil
+	}
+
+	return nil, fmt.Errorf("service account key not provided")
+}
+
+// parseServiceAccountKey decodes a service account JSON key.
+func parseServiceAccountKey(data []byte) (*ServiceAccountKey, error) {
+	var key ServiceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("service account key is not valid JSON (truncated or malformed?)")
+	}
+	return &key, nil
+}
+
+// Problems returns every reason the key cannot be used for authentication.
+func (k *ServiceAccountKey) Problems() []string {
+	var problems []string
+
+	if k.Type != "service_account" {
+		problems = append(problems, fmt.Sprintf("key type must be 'service_account', got '%s'", k.Type))
+	}
+
+	if k.ProjectID == "" {
+		problems = append(problems, "key is missing project_id")
+	}
+
+	if k.ClientEmail == "" {
+		problems = append(problems, "key is missing client_email")
+	} else if !strings.Contains(k.ClientEmail, "@") {
+		problems = append(problems, fmt.Sprintf("key client_email '%s' is not an email address", k.ClientEmail))
+	}
+
+	if k.PrivateKeyID == "" {
+		problems = append(problems, "key is missing private_key_id")
+	} else if !privateKeyIDPattern.MatchString(k.PrivateKeyID) {
+		problems = append(problems, "key private_key_id is malformed")
+	}
+
+	if k.PrivateKey == "" {
+		problems = append(problems, "key is missing private_key")
+	} else if _, err := k.rsaPrivateKey(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	return problems
+}
+
+// rsaPrivateKey decodes the PEM-encoded private key.
+func (k *ServiceAccountKey) rsaPrivateKey() (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("key private_key is not a PEM private key (truncated?)")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key private_key cannot be parsed (truncated?)")
+	}
+
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key private_key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+// checkKeyFilePermissions verifies that a key file exists and is not readable by others.
+// Group access is reported as a warning, world access as an error.
+func checkKeyFilePermissions(path string) (warning string, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("key file not found: %s", path)
+		}
+		return "", fmt.Errorf("cannot access key file: %w", err)
+	}
+
+	if info.IsDir() {
+		return "", fmt.Errorf("key file is a directory: %s", path)
+	}
+
+	// Windows does not expose POSIX permission bits.
+	if runtime.GOOS == "windows" {
+		return "", nil
+	}
+
+	perm := info.Mode().Perm()
+	if perm&0o007 != 0 {
+		return "", fmt.Errorf("key file %s is accessible by other users (%#o); restrict it to 0600", path, perm)
+	}
+	if perm&0o070 != 0 {
+		return fmt.Sprintf("key file %s is accessible by its group (%#o); consider 0600", path, perm), nil
+	}
+
+	return "", nil
+}
+
+// defaultTokenURI is used when a key does not specify its token endpoint.
+const defaultTokenURI = "https://oauth2.googleapis.com/token"
+
+// cloudPlatformScope grants access to all Google Cloud APIs the plugin calls.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// signedJWT returns a self-signed JWT assertion for the OAuth2 JWT bearer grant.
+func (k *ServiceAccountKey) signedJWT(audience, scope string, now time.Time) (string, error) {
+	privateKey, err := k.rsaPrivateKey()
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": k.PrivateKeyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		"iss":   k.ClientEmail,
+		"scope": scope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token request: %w", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// exchangeToken trades a signed JWT for an OAuth2 access token. An empty
+// tokenURI falls back to the key's token_uri.
+func (k *ServiceAccountKey) exchangeToken(ctx context.Context, client *http.Client, tokenURI string, now time.Time) (*cachedToken, error) {
+	if tokenURI == "" {
+		tokenURI = k.TokenURI
+	}
+	if tokenURI == "" {
+		tokenURI = defaultTokenURI
+	}
+
+	assertion, err := k.signedJWT(tokenURI, cloudPlatformScope, now)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("token request returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("token response did not include an access token")
+	}
+
+	token := &cachedToken{value: body.AccessToken, email: k.ClientEmail}
+	if body.ExpiresIn > 0 {
+		token.expiry = now.Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testRSAKeyOnce sync.Once
+	testRSAKey     *rsa.PrivateKey
+)
+
+// testServiceAccountKey returns a well-formed service account key for projectID.
+func testServiceAccountKey(t *testing.T, projectID string) *ServiceAccountKey {
+	t.Helper()
+
+	testRSAKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		testRSAKey = key
+	})
+
+	der, err := x509.MarshalPKCS8PrivateKey(testRSAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &ServiceAccountKey{
+		Type:         "service_account",
+		ProjectID:    projectID,
+		PrivateKeyID: "0123456789abcdef0123456789abcdef01234567",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		ClientEmail:  "ci@" + projectID + ".iam.gserviceaccount.com",
+		ClientID:     "123456789",
+		TokenURI:     "https://oauth2.googleapis.com/token",
+	}
+}
+
+// testServiceAccountKeyJSON returns the JSON encoding of key.
+func testServiceAccountKeyJSON(t *testing.T, key *ServiceAccountKey) string {
+	t.Helper()
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// writeTestKeyFile writes data to a key file with the given permissions.
+func writeTestKeyFile(t *testing.T, data string, perm os.FileMode) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, []byte(data), perm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseServiceAccountKey(t *testing.T) {
+	valid := testServiceAccountKeyJSON(t, testServiceAccountKey(t, "my-project"))
+
+	key, err := parseServiceAccountKey([]byte(valid))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key.ClientEmail != "ci@my-project.iam.gserviceaccount.com" {
+		t.Errorf("unexpected client_email '%s'", key.ClientEmail)
+	}
+
+	if _, err := parseServiceAccountKey([]byte(valid[:len(valid)/2])); err == nil {
+		t.Error("expected error for truncated JSON")
+	}
+}
+
+func TestServiceAccountKeyProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(k *ServiceAccountKey)
+		want   string
+	}{
+		{
+			name:   "valid key",
+			modify: func(k *ServiceAccountKey) {},
+		},
+		{
+			name:   "wrong type",
+			modify: func(k *ServiceAccountKey) { k.Type = "authorized_user" },
+			want:   "key type must be 'service_account'",
+		},
+		{
+			name:   "missing project",
+			modify: func(k *ServiceAccountKey) { k.ProjectID = "" },
+			want:   "missing project_id",
+		},
+		{
+			name:   "missing client email",
+			modify: func(k *ServiceAccountKey) { k.ClientEmail = "" },
+			want:   "missing client_email",
+		},
+		{
+			name:   "invalid client email",
+			modify: func(k *ServiceAccountKey) { k.ClientEmail = "not-an-email" },
+			want:   "not an email address",
+		},
+		{
+			name:   "malformed key id",
+			modify: func(k *ServiceAccountKey) { k.PrivateKeyID = "xyz" },
+			want:   "private_key_id is malformed",
+		},
+		{
+			name:   "missing private key",
+			modify: func(k *ServiceAccountKey) { k.PrivateKey = "" },
+			want:   "missing private_key",
+		},
+		{
+			name:   "truncated private key",
+			modify: func(k *ServiceAccountKey) { k.PrivateKey = k.PrivateKey[:len(k.PrivateKey)/2] },
+			want:   "truncated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := testServiceAccountKey(t, "my-project")
+			tt.modify(key)
+
+			problems := key.Problems()
+			if tt.want == "" {
+				if len(problems) != 0 {
+					t.Errorf("expected no problems, got %v", problems)
+				}
+				return
+			}
+
+			if len(problems) != 1 || !strings.Contains(problems[0], tt.want) {
+				t.Errorf("expected a single problem containing '%s', got %v", tt.want, problems)
+			}
+		})
+	}
+}
+
+func TestCheckKeyFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX permissions are not checked on Windows")
+	}
+
+	tests := []struct {
+		name        string
+		perm        os.FileMode
+		wantWarning bool
+		wantErr     bool
+	}{
+		{name: "owner only", perm: 0o600},
+		{name: "group readable", perm: 0o640, wantWarning: true},
+		{name: "world readable", perm: 0o644, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestKeyFile(t, "{}", tt.perm)
+
+			warning, err := checkKeyFilePermissions(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("expected warning %v, got '%s'", tt.wantWarning, warning)
+			}
+		})
+	}
+
+	if _, err := checkKeyFilePermissions(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected error for missing key file")
+	}
+}
+
+func TestExchangeToken(t *testing.T) {
+	key := testServiceAccountKey(t, "my-project")
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		if len(parts) != 3 {
+			t.Errorf("expected a JWT assertion, got %q", r.Form.Get("assertion"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&testRSAKey.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			t.Errorf("invalid assertion signature: %v", err)
+		}
+
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]any
+		_ = json.Unmarshal(payload, &claims)
+		if claims["iss"] != key.ClientEmail {
+			t.Errorf("expected issuer '%s', got %v", key.ClientEmail, claims["iss"])
+		}
+		if claims["aud"] != "http://"+r.Host+"/token" {
+			t.Errorf("expected audience to be the token endpoint, got %v", claims["aud"])
+		}
+		if claims["scope"] != cloudPlatformScope {
+			t.Errorf("unexpected scope %v", claims["scope"])
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "sa-token", "expires_in": 3600})
+	}))
+	defer server.Close()
+
+	key.TokenURI = server.URL + "/token"
+	token, err := key.exchangeToken(context.Background(), server.Client(), "", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if token.value != "sa-token" {
+		t.Errorf("expected token 'sa-token', got '%s'", token.value)
+	}
+	if !token.expiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected expiry in one hour, got %s", token.expiry)
+	}
+	if token.email != key.ClientEmail {
+		t.Errorf("expected identity '%s', got '%s'", key.ClientEmail, token.email)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SourceImage describes a resolved source image.
+type SourceImage struct {
+	Ref      string
+	Digest   string
+	Platform string
+	Size     int64
+
+	// Local is true when the image is present in the local Docker daemon.
+	Local bool
+	// Pulled is true when the image was pulled by this run.
+	Pulled bool
+}
+
+// localImage is the subset of `docker image inspect` output the plugin reads.
+type localImage struct {
+	ID           string   `json:"Id"`
+	RepoDigests  []string `json:"RepoDigests"`
+	Os           string   `json:"Os"`
+	Architecture string   `json:"Architecture"`
+	Variant      string   `json:"Variant"`
+	Size         int64    `json:"Size"`
+}
+
+// remoteManifest is one entry of `docker manifest inspect --verbose` output.
+type remoteManifest struct {
+	Descriptor struct {
+		Digest   string `json:"digest"`
+		Size     int64  `json:"size"`
+		Platform *struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+			Variant      string `json:"variant"`
+		} `json:"platform"`
+	} `json:"Descriptor"`
+	SchemaV2Manifest *struct {
+		Config struct {
+			Size int64 `json:"size"`
+		} `json:"config"`
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+	} `json:"SchemaV2Manifest"`
+}
+
+// InspectImage returns the source image from the local Docker daemon.
+func (d *DockerClient) InspectImage(ctx context.Context, image string) (*SourceImage, error) {
+	cmd := dockerCommand(ctx, d.configDir, "docker", "image", "inspect", image)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("image %s not found locally", image)
+	}
+
+	var images []localImage
+	if err := json.Unmarshal(output, &images); err != nil || len(images) == 0 {
+		return nil, fmt.Errorf("failed to parse docker image inspect output for %s", image)
+	}
+	local := images[0]
+
+	source := &SourceImage{
+		Ref:      image,
+		Digest:   local.ID,
+		Platform: formatPlatform(local.Os, local.Architecture, local.Variant),
+		Size:     local.Size,
+		Local:    true,
+	}
+	if len(local.RepoDigests) > 0 {
+		if i := strings.LastIndex(local.RepoDigests[0], "@"); i >= 0 {
+			source.Digest = local.RepoDigests[0][i+1:]
+		}
+	}
+	return source, nil
+}
+
+// InspectRemoteImage resolves the source image in its registry without
+// pulling it.
+func (d *DockerClient) InspectRemoteImage(ctx context.Context, image string) (*SourceImage, error) {
+	cmd := dockerCommand(ctx, d.configDir, "docker", "manifest", "inspect", "--verbose", image)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("image %s is not resolvable: %w\n%s", image, err, string(output))
+	}
+
+	// A single-platform image is one object, an image index a list.
+	var manifests []remoteManifest
+	index := true
+	if err := json.Unmarshal(output, &manifests); err != nil {
+		var manifest remoteManifest
+		if err := json.Unmarshal(output, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse docker manifest inspect output for %s", image)
+		}
+		manifests = []remoteManifest{manifest}
+		index = false
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("image %s has no manifests", image)
+	}
+
+	source := &SourceImage{Ref: image, Digest: manifests[0].Descriptor.Digest}
+	if index {
+		// The verbose output only lists the platform manifests, so the
+		// digest of the index itself is computed from its raw content.
+		if source.Digest, err = d.rawManifestDigest(ctx, image); err != nil {
+			return nil, err
+		}
+	}
+
+	var platforms []string
+	for _, manifest := range manifests {
+		if p := manifest.Descriptor.Platform; p != nil {
+			platforms = append(platforms, formatPlatform(p.OS, p.Architecture, p.Variant))
+		}
+		if m := manifest.SchemaV2Manifest; m != nil {
+			source.Size += m.Config.Size
+			for _, layer := range m.Layers {
+				source.Size += layer.Size
+			}
+		}
+	}
+	source.Platform = strings.Join(platforms, ",")
+
+	return source, nil
+}
+
+// rawManifestDigest returns the digest of the manifest or index image
+// refers to, computed from its raw content in the registry.
+func (d *DockerClient) rawManifestDigest(ctx context.Context, image string) (string, error) {
+	cmd := dockerCommand(ctx, d.configDir, "docker", "buildx", "imagetools", "inspect", "--raw", image)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the index of %s: %w", image, err)
+	}
+	return manifestDigest(nil, output), nil
+}
+
+// Pull pulls an image into the local Docker daemon.
+func (d *DockerClient) Pull(ctx context.Context, image string) error {
+	cmd := dockerCommand(ctx, d.configDir, "docker", "pull", image)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker pull failed: %w\n%s", err, string(output))
+	}
+	return nil
+}
+
+// formatPlatform returns an OCI platform string such as linux/arm64/v8.
+func formatPlatform(os, architecture, variant string) string {
+	platform := os + "/" + architecture
+	if variant != "" {
+		platform += "/" + variant
+	}
+	return platform
+}
+
+// resolveSourceImages checks that every source image is present locally.
+// Missing images are pulled when pull is set. With allowRemote, an image that
+// is only resolvable in its registry passes too; validation uses this, while
+// pushing needs the image in the local daemon for docker tag. The user's own
+// Docker config is used, since source images usually come from a registry
+// other than the target.
+func (p *GCRPlugin) resolveSourceImages(ctx context.Context, cfg *Config, pull, allowRemote bool) ([]*SourceImage, error) {
+	docker := NewDockerClient("")
+
+	var sources []*SourceImage
+	seen := make(map[string]bool)
+	for _, image := range cfg.images() {
+		if seen[image.SourceImage] {
+			continue
+		}
+		seen[image.SourceImage] = true
+
+		exists, err := docker.ImageExists(ctx, image.SourceImage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check source image %s: %w", image.SourceImage, err)
+		}
+
+		var source *SourceImage
+		switch {
+		case exists:
+			source, err = docker.InspectImage(ctx, image.SourceImage)
+			if err != nil {
+				return nil, err
+			}
+		case pull:
+			if err := docker.Pull(ctx, image.SourceImage); err != nil {
+				return nil, fmt.Errorf("source image %s is missing and could not be pulled: %w", image.SourceImage, err)
+			}
+			source, err = docker.InspectImage(ctx, image.SourceImage)
+			if err != nil {
+				return nil, err
+			}
+			source.Pulled = true
+		case allowRemote:
+			source, err = docker.InspectRemoteImage(ctx, image.SourceImage)
+			if err != nil {
+				return nil, fmt.Errorf("source image %s is neither present locally nor resolvable: %w", image.SourceImage, err)
+			}
+		default:
+			return nil, fmt.Errorf("source image %s is not present locally; build or pull it before the release, or set preflight.pull_source_image", image.SourceImage)
+		}
+
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// checksSourceImages reports whether source images are resolved before pushing.
+func (c *Config) checksSourceImages() bool {
+	return c.PreflightSourceImage || c.PullSourceImage
+}
+
+// printSourceImages reports the resolved source images.
+func printSourceImages(redactor *Redactor, sources []*SourceImage) {
+	for _, source := range sources {
+		location := "registry"
+		switch {
+		case source.Pulled:
+			location = "pulled"
+		case source.Local:
+			location = "local"
+		}
+		redactor.Printf("Source image %s (%s): digest %s, platform %s, %d bytes\n",
+			source.Ref, location, source.Digest, source.Platform, source.Size)
+	}
+}
+
+// sourceImageOutputs describes resolved source images for execute outputs.
+func sourceImageOutputs(sources []*SourceImage) []map[string]any {
+	outputs := make([]map[string]any, 0, len(sources))
+	for _, source := range sources {
+		outputs = append(outputs, map[string]any{
+			"image":    source.Ref,
+			"digest":   source.Digest,
+			"platform": source.Platform,
+			"size":     source.Size,
+			"local":    source.Local,
+			"pulled":   source.Pulled,
+		})
+	}
+	return outputs
+}
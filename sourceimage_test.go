@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+const fakeLocalImage = `[{
+	"Id": "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+	"RepoDigests": ["registry.example.com/myapp@sha256:2222222222222222222222222222222222222222222222222222222222222222"],
+	"Os": "linux",
+	"Architecture": "arm64",
+	"Variant": "v8",
+	"Size": 12345
+}]`
+
+const fakeRemoteIndex = `[
+	{
+		"Ref": "registry.example.com/myapp:latest@sha256:aaaa",
+		"Descriptor": {"digest": "sha256:aaaa", "size": 500, "platform": {"os": "linux", "architecture": "amd64"}},
+		"SchemaV2Manifest": {"config": {"size": 100}, "layers": [{"size": 1000}, {"size": 2000}]}
+	},
+	{
+		"Ref": "registry.example.com/myapp:latest@sha256:bbbb",
+		"Descriptor": {"digest": "sha256:bbbb", "size": 500, "platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}},
+		"SchemaV2Manifest": {"config": {"size": 100}, "layers": [{"size": 900}]}
+	}
+]`
+
+func TestInspectImage(t *testing.T) {
+	installFakeCommands(t)
+	t.Setenv("FAKE_DOCKER_IMAGE", fakeLocalImage)
+
+	source, err := NewDockerClient("").InspectImage(context.Background(), "myapp:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if source.Digest != "sha256:2222222222222222222222222222222222222222222222222222222222222222" {
+		t.Errorf("expected repo digest, got '%s'", source.Digest)
+	}
+	if source.Platform != "linux/arm64/v8" {
+		t.Errorf("expected platform 'linux/arm64/v8', got '%s'", source.Platform)
+	}
+	if source.Size != 12345 || !source.Local {
+		t.Errorf("expected local image of 12345 bytes, got %+v", source)
+	}
+
+	t.Setenv("FAKE_COMMAND_FAIL", "image")
+	if _, err := NewDockerClient("").InspectImage(context.Background(), "myapp:latest"); err == nil {
+		t.Error("expected error for missing image")
+	}
+}
+
+func TestInspectRemoteImage(t *testing.T) {
+	installFakeCommands(t)
+
+	rawIndex := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`
+	sum := sha256.Sum256([]byte(rawIndex))
+	t.Setenv("FAKE_DOCKER_MANIFEST", fakeRemoteIndex)
+	t.Setenv("FAKE_DOCKER_RAW_MANIFEST", rawIndex)
+	source, err := NewDockerClient("").InspectRemoteImage(context.Background(), "registry.example.com/myapp:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if source.Digest != "sha256:"+hex.EncodeToString(sum[:]) || source.Platform != "linux/amd64,linux/arm64/v8" || source.Size != 4100 {
+		t.Errorf("unexpected index resolution %+v", source)
+	}
+
+	t.Setenv("FAKE_DOCKER_MANIFEST", `{"Descriptor": {"digest": "sha256:cccc", "size": 500, "platform": {"os": "linux", "architecture": "amd64"}}}`)
+	source, err = NewDockerClient("").InspectRemoteImage(context.Background(), "registry.example.com/myapp:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if source.Digest != "sha256:cccc" || source.Platform != "linux/amd64" || source.Local {
+		t.Errorf("unexpected manifest resolution %+v", source)
+	}
+}
+
+func TestResolveSourceImages(t *testing.T) {
+	tests := []struct {
+		name        string
+		pull        bool
+		allowRemote bool
+		missing     bool
+		remote      string
+		wantErr     bool
+		wantLocal   bool
+		wantPulled  bool
+	}{
+		{name: "present locally", wantLocal: true},
+		{name: "resolvable in registry", missing: true, allowRemote: true, remote: fakeRemoteIndex},
+		{name: "remote only when pushing", missing: true, remote: fakeRemoteIndex, wantErr: true},
+		{name: "missing everywhere", missing: true, allowRemote: true, wantErr: true},
+		{name: "pulled when missing", missing: true, pull: true, wantLocal: true, wantPulled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logPath := installFakeCommands(t)
+			t.Setenv("FAKE_DOCKER_IMAGE", fakeLocalImage)
+			t.Setenv("FAKE_DOCKER_MANIFEST", tt.remote)
+			if tt.missing {
+				t.Setenv("FAKE_DOCKER_PULLED", filepath.Join(t.TempDir(), "pulled"))
+			}
+			if tt.missing && tt.remote == "" && !tt.pull {
+				t.Setenv("FAKE_COMMAND_FAIL", "manifest")
+			}
+
+			cfg := &Config{
+				Images: []ImageConfig{
+					{Image: "api", SourceImage: "myapp:latest"},
+					{Image: "api-mirror", SourceImage: "myapp:latest"},
+				},
+			}
+
+			p := &GCRPlugin{}
+			sources, err := p.resolveSourceImages(context.Background(), cfg, tt.pull, tt.allowRemote)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(sources) != 1 {
+				t.Fatalf("expected shared source image to be resolved once, got %d", len(sources))
+			}
+			if sources[0].Local != tt.wantLocal || sources[0].Pulled != tt.wantPulled {
+				t.Errorf("expected local=%v pulled=%v, got %+v", tt.wantLocal, tt.wantPulled, sources[0])
+			}
+
+			pulls := 0
+			for _, line := range readFakeCommandLog(t, logPath) {
+				if strings.HasPrefix(line, "docker pull ") {
+					pulls++
+				}
+			}
+			if tt.wantPulled != (pulls == 1) {
+				t.Errorf("expected pulled=%v, saw %d pulls", tt.wantPulled, pulls)
+			}
+		})
+	}
+}
+
+func TestResolveSourceImagesDaemonError(t *testing.T) {
+	installFakeCommands(t)
+	t.Setenv("FAKE_COMMAND_FAIL", "image")
+	t.Setenv("FAKE_COMMAND_STDERR", "Cannot connect to the Docker daemon")
+	t.Setenv("FAKE_DOCKER_MANIFEST", fakeRemoteIndex)
+
+	cfg := &Config{Images: []ImageConfig{{Image: "api", SourceImage: "myapp:latest"}}}
+
+	p := &GCRPlugin{}
+	_, err := p.resolveSourceImages(context.Background(), cfg, false, true)
+	if err == nil || !strings.Contains(err.Error(), "failed to check source image") {
+		t.Errorf("expected the daemon error, got %v", err)
+	}
+}
+
+func TestValidateSourceImage(t *testing.T) {
+	installFakeCommands(t)
+	t.Setenv("FAKE_COMMAND_FAIL", "manifest")
+	t.Setenv("FAKE_DOCKER_PULLED", filepath.Join(t.TempDir(), "pulled"))
+
+	p := &GCRPlugin{}
+	resp, err := p.Validate(context.Background(), map[string]any{
+		"project":      "my-project",
+		"repository":   "my-repo",
+		"image":        "my-app",
+		"source_image": "myapp:latest",
+		"preflight":    map[string]any{"source_image": true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Field != "preflight.source_image" {
+		t.Errorf("expected a source image error, got %v", resp.Errors)
+	}
+}
+
+func TestPrePublishSourceImage(t *testing.T) {
+	installFakeCommands(t)
+	t.Setenv("FAKE_DOCKER_IMAGE", fakeLocalImage)
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPrePublish,
+		Config: map[string]any{
+			"project":      "my-project",
+			"repository":   "my-repo",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+			"preflight":    map[string]any{"source_image": true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sources, ok := resp.Outputs["source_images"].([]map[string]any)
+	if !ok || len(sources) != 1 {
+		t.Fatalf("expected one source image, got %v", resp.Outputs["source_images"])
+	}
+	if sources[0]["platform"] != "linux/arm64/v8" {
+		t.Errorf("expected platform in outputs, got %v", sources[0])
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// defaultStagingTag is the tag images are staged under before promotion.
+const defaultStagingTag = "relicta-staging-{{.Version}}"
+
+// stagedImage is an image pushed by the pre_publish hook and promoted to its
+// final tags by post_publish.
+type stagedImage struct {
+	client *GCRClient
+	name   string
+	tag    string
+	digest string
+}
+
+// ref returns the staged image reference.
+func (s *stagedImage) ref() string {
+	return fmt.Sprintf("%s:%s", s.client.GetImagePath(s.name), s.tag)
+}
+
+// repository returns the registry repository path of the staged image.
+func (s *stagedImage) repository() string {
+	return s.client.RepositoryPath(s.name)
+}
+
+// resolve looks up the digest the staging tag points to.
+func (s *stagedImage) resolve(ctx context.Context) error {
+	digest, err := s.client.Registry().ManifestDigest(ctx, s.repository(), s.tag)
+	if isNotFound(err) {
+		return fmt.Errorf("staged image %s not found; the pre_publish hook must stage it before post_publish", s.ref())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve staged image %s: %w", s.ref(), err)
+	}
+	s.digest = digest
+	return nil
+}
+
+// stagedImage returns where image is staged in region: the staging
+// repository when one is set, otherwise the image's own repository under the
+// staging tag only.
+func (p *GCRPlugin) stagedImage(cfg *Config, region, dockerConfig string, credentials *CredentialManager, image ImageConfig, ctx *plugin.ReleaseContext) *stagedImage {
+	config := cfg.gcrConfig(region, dockerConfig, credentials)
+	config.Repository = image.Repository
+	name := image.Image
+	if cfg.StagingRepository != "" {
+		if cfg.ArtifactRegistry {
+			config.Repository = cfg.StagingRepository
+		} else {
+			// Legacy GCR has no repositories, so staging is a path prefix.
+			name = cfg.StagingRepository + "/" + image.Image
+		}
+	}
+
+	return &stagedImage{
+		client: NewGCRClient(config),
+		name:   name,
+		tag:    p.processTemplate(cfg.StagingTag, ctx),
+	}
+}
+
+// stage pushes every image under its staging tag so a failed push stops the
+// release before it is published.
+func (p *GCRPlugin) stage(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, redactor *Redactor) ([]map[string]any, error) {
+	dockerConfig := ""
+	if !cfg.DryRun {
+		dir, err := newDockerConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		dockerConfig = dir
+	}
+
+	staged := []map[string]any{}
+	for _, target := range cfg.targets() {
+		if target.skipReason(&req.Context) != "" {
+			continue
+		}
+
+		results, err := p.stageTarget(ctx, req, target, dockerConfig, redactor)
+		if err != nil {
+			if target.Name != "" {
+				return nil, fmt.Errorf("target %s: %w", target.Name, err)
+			}
+			return nil, err
+		}
+		staged = append(staged, results...)
+	}
+	return staged, nil
+}
+
+// stageTarget pushes every image of one target to its staging location.
+func (p *GCRPlugin) stageTarget(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, dockerConfig string, redactor *Redactor) ([]map[string]any, error) {
+	if err := resolveSecrets(ctx, cfg, redactor); err != nil {
+		return nil, err
+	}
+
+	dockerConfig, err := targetDockerConfig(dockerConfig, cfg)
+	if err != nil {
+		return nil, err
+	}
+	credentials := NewCredentialManager(cfg.authConfig(), dockerConfig, cfg.Endpoints)
+	credentials.warnf = redactor.Warnf
+	docker := NewDockerClient(dockerConfig)
+
+	// The staging repository is created along with the final ones
+	repositories := cfg.repositories()
+	if cfg.StagingRepository != "" && !containsString(repositories, cfg.StagingRepository) {
+		repositories = append(repositories, cfg.StagingRepository)
+	}
+	if _, err := p.ensureRepositories(ctx, cfg, repositories, p.releaseTags(cfg, &req.Context), credentials, redactor); err != nil {
+		return nil, err
+	}
+
+	results := []map[string]any{}
+	for _, image := range cfg.images() {
+		for _, region := range cfg.regions() {
+			staged := p.stagedImage(cfg, region, dockerConfig, credentials, image, &req.Context)
+			ref := staged.ref()
+
+			if cfg.DryRun {
+				redactor.Printf("[dry-run] Would stage %s as %s\n", image.SourceImage, ref)
+			} else {
+				if err := staged.client.Authenticate(ctx, region); err != nil {
+					return nil, fmt.Errorf("failed to authenticate with %s: %w", region, err)
+				}
+				if err := docker.Tag(ctx, image.SourceImage, ref); err != nil {
+					return nil, fmt.Errorf("failed to tag image: %w", err)
+				}
+				if err := docker.Push(ctx, ref); err != nil {
+					return nil, fmt.Errorf("failed to push image: %w", err)
+				}
+				if err := staged.resolve(ctx); err != nil {
+					return nil, err
+				}
+				redactor.Printf("Staged: %s (%s)\n", ref, staged.digest)
+			}
+
+			result := map[string]any{
+				"image":         image.Image,
+				"region":        region,
+				"staging_image": ref,
+				"digest":        staged.digest,
+			}
+			if cfg.Name != "" {
+				result["target"] = cfg.Name
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// promote points tag at the staged digest in the final repository.
+func (p *GCRPlugin) promote(ctx context.Context, staged *stagedImage, client *GCRClient, image, tag string) error {
+	registry := client.Registry()
+	if err := registry.CopyManifest(ctx, staged.repository(), staged.digest, client.RepositoryPath(image), tag); err != nil {
+		return fmt.Errorf("failed to promote %s: %w", staged.ref(), err)
+	}
+	return nil
+}
+
+// validateStaging checks the staging repository and tag.
+func (p *GCRPlugin) validateStaging(vb *helpers.ValidationBuilder, cfg *Config) {
+	if !cfg.StagingEnabled {
+		return
+	}
+
+	if cfg.StagingRepository != "" {
+		if err := checkRepositoryName(cfg.StagingRepository); err != nil {
+			vb.AddError("staging.repository", err.Error())
+		}
+	}
+
+	tag := p.processTemplate(cfg.StagingTag, &sampleReleaseContext)
+	if tag == "" {
+		vb.AddError("staging.tag", "staging tag must not be empty")
+	} else if err := checkTag(tag); err != nil {
+		vb.AddError("staging.tag", err.Error())
+	}
+}
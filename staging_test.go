@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// stagingConfig returns a configuration that stages my-app in the fake
+// registry, with extra keys merged into the staging block.
+func stagingConfig(api *fakeGoogleAPI, registry *fakeRegistry, staging map[string]any) map[string]any {
+	endpoints := api.EndpointsConfig()
+	endpoints["registry"] = registry.URL
+
+	block := map[string]any{"enabled": true}
+	for k, v := range staging {
+		block[k] = v
+	}
+
+	return map[string]any{
+		"project":      "my-project",
+		"repository":   "my-repo",
+		"image":        "my-app",
+		"source_image": "myapp:latest",
+		"tags":         []any{"{{.Version}}", "latest"},
+		"auth":         map[string]any{"method": "access_token", "access_token": "good-token"},
+		"endpoints":    endpoints,
+		"staging":      block,
+	}
+}
+
+func TestPrePublishStagesImages(t *testing.T) {
+	logPath := installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+
+	// Stands in for the layers docker push uploads.
+	digest := registry.SeedImage("my-project/my-repo/my-app", "relicta-staging-1.2.3", "layer")
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook:    plugin.HookPrePublish,
+		Config:  stagingConfig(api, registry, nil),
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ref := "us-central1-docker.pkg.dev/my-project/my-repo/my-app:relicta-staging-1.2.3"
+	staged, ok := resp.Outputs["staged_images"].([]map[string]any)
+	if !ok || len(staged) != 1 {
+		t.Fatalf("expected one staged image, got %v", resp.Outputs["staged_images"])
+	}
+	if staged[0]["staging_image"] != ref || staged[0]["digest"] != digest {
+		t.Errorf("expected %s at %s, got %v", ref, digest, staged[0])
+	}
+
+	var pushes []string
+	for _, line := range readFakeCommandLog(t, logPath) {
+		if strings.HasPrefix(line, "docker push ") {
+			pushes = append(pushes, strings.Fields(line)[2])
+		}
+	}
+	if !reflect.DeepEqual(pushes, []string{ref}) {
+		t.Errorf("expected only the staging tag to be pushed, got %v", pushes)
+	}
+}
+
+func TestPostPublishPromotesStagedDigest(t *testing.T) {
+	tests := []struct {
+		name           string
+		staging        map[string]any
+		stagingRepo    string
+		wantStagingTag bool
+	}{
+		{
+			name:        "staged by digest in the final repository",
+			stagingRepo: "my-project/my-repo/my-app",
+		},
+		{
+			name:           "staged in a staging repository",
+			staging:        map[string]any{"repository": "staging", "tag": "rc-{{.Version}}"},
+			stagingRepo:    "my-project/staging/my-app",
+			wantStagingTag: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logPath := installFakeCommands(t)
+			api := newFakeGoogleAPI(t)
+			registry := newFakeRegistry(t)
+
+			stagingTag := "relicta-staging-1.2.3"
+			if tt.staging != nil {
+				stagingTag = "rc-1.2.3"
+			}
+			digest := registry.SeedImage(tt.stagingRepo, stagingTag, "layer")
+
+			// Artifact Registry tags are deleted through its REST API.
+			var deleted []string
+			api.Mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+				if !requireBearer(w, r, "good-token") || r.Method != http.MethodDelete {
+					return
+				}
+				deleted = append(deleted, r.URL.EscapedPath())
+				_, _ = w.Write([]byte(`{}`))
+			})
+
+			p := &GCRPlugin{}
+			resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+				Hook:    plugin.HookPostPublish,
+				Config:  stagingConfig(api, registry, tt.staging),
+				Context: plugin.ReleaseContext{Version: "1.2.3"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, tag := range []string{"1.2.3", "latest"} {
+				if got := registry.Digest("my-project/my-repo/my-app", tag); got != digest {
+					t.Errorf("expected %s to be promoted to %s, got '%s'", tag, digest, got)
+				}
+			}
+
+			images := resp.Outputs["images"].([]map[string]any)
+			if images[0]["digest"] != digest {
+				t.Errorf("expected promoted digest in outputs, got %v", images[0])
+			}
+
+			stagingDeleted := len(deleted) == 1 &&
+				deleted[0] == "/v1/projects/my-project/locations/us-central1/repositories/my-repo/packages/my-app/tags/relicta-staging-1.2.3"
+			if tt.wantStagingTag == stagingDeleted {
+				t.Errorf("expected staging tag kept=%v, got deletes %v", tt.wantStagingTag, deleted)
+			}
+
+			for _, line := range readFakeCommandLog(t, logPath) {
+				if strings.HasPrefix(line, "docker push ") {
+					t.Errorf("expected promotion without docker push, got '%s'", line)
+				}
+			}
+		})
+	}
+}
+
+func TestPostPublishRequiresStagedImage(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+
+	p := &GCRPlugin{}
+	_, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook:    plugin.HookPostPublish,
+		Config:  stagingConfig(api, registry, nil),
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "the pre_publish hook must stage it before post_publish") {
+		t.Errorf("expected missing staged image error, got %v", err)
+	}
+}
+
+func TestValidateStaging(t *testing.T) {
+	tests := []struct {
+		name       string
+		staging    map[string]any
+		wantFields []string
+	}{
+		{name: "defaults", staging: map[string]any{}},
+		{name: "invalid repository", staging: map[string]any{"repository": "Staging!"}, wantFields: []string{"staging.repository"}},
+		{name: "invalid tag", staging: map[string]any{"tag": "-{{.Version}}"}, wantFields: []string{"staging.tag"}},
+		{name: "empty tag", staging: map[string]any{"tag": "{{.CommitSHA}}"}, wantFields: []string{"staging.tag"}},
+	}
+
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+	p := &GCRPlugin{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := p.Validate(context.Background(), stagingConfig(api, registry, tt.staging))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var fields []string
+			for _, e := range resp.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, resp.Errors)
+			}
+		})
+	}
+}
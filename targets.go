@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/helpers"
+)
+
+// TargetConfig describes one registry destination. Empty fields inherit the
+// top-level settings of the plugin configuration.
+type TargetConfig struct {
+	Name             string
+	ArtifactRegistry *bool
+	Project          string
+	Region           string
+	Regions          []string
+	Repository       string
+
+	// Auth replaces the top-level credentials when set.
+	Auth *AuthConfig
+
+	// Key rotation thresholds of the target's key; unset inherits the
+	// top-level thresholds.
+	KeyWarnAgeDays *int
+	KeyMaxAgeDays  *int
+
+	// Only and Except replace the top-level release filters when set.
+	Only   *ReleaseFilter
+	Except *ReleaseFilter
+}
+
+// parseTargets parses the "targets" list. Target credentials never fall back
+// to environment variables, so one target cannot pick up another's key.
+func parseTargets(raw map[string]any) []TargetConfig {
+	list, ok := raw["targets"].([]any)
+	if !ok {
+		return nil
+	}
+
+	targets := make([]TargetConfig, 0, len(list))
+	for i, item := range list {
+		entry, _ := item.(map[string]any)
+		parser := helpers.NewConfigParser(entry)
+
+		target := TargetConfig{
+			Name:       parser.GetString("name", "", ""),
+			Project:    parser.GetString("project", "", ""),
+			Region:     parser.GetString("region", "", ""),
+			Regions:    parser.GetStringSlice("regions", nil),
+			Repository: parser.GetString("repository", "", ""),
+		}
+
+		target.Only = parseReleaseFilter(parser.GetMap("only"))
+		target.Except = parseReleaseFilter(parser.GetMap("except"))
+
+		if target.Name == "" {
+			target.Name = fmt.Sprintf("target-%d", i+1)
+		}
+
+		if parser.Has("artifact_registry") {
+			artifactRegistry := parser.GetBool("artifact_registry", true)
+			target.ArtifactRegistry = &artifactRegistry
+		}
+
+		if authRaw, ok := entry["auth"].(map[string]any); ok {
+			authParser := helpers.NewConfigParser(authRaw)
+			target.Auth = &AuthConfig{
+				Method:          authParser.GetString("method", "", "gcloud"),
+				KeyFile:         authParser.GetString("key_file", "", ""),
+				KeyJSON:         authParser.GetString("key_json", "", ""),
+				AccessToken:     authParser.GetString("access_token", "", ""),
+				AccessTokenFile: authParser.GetString("access_token_file", "", ""),
+			}
+			if authParser.Has("key_warn_age_days") {
+				days := authParser.GetInt("key_warn_age_days", 0)
+				target.KeyWarnAgeDays = &days
+			}
+			if authParser.Has("key_max_age_days") {
+				days := authParser.GetInt("key_max_age_days", 0)
+				target.KeyMaxAgeDays = &days
+			}
+		}
+
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// targets returns one configuration per target with inherited settings filled
+// in. A configuration without a "targets" list is its own single target.
+func (c *Config) targets() []*Config {
+	if len(c.Targets) == 0 {
+		return []*Config{c}
+	}
+
+	configs := make([]*Config, 0, len(c.Targets))
+	for i, t := range c.Targets {
+		target := *c
+		target.Targets = nil
+		target.Name = t.Name
+		target.index = i
+
+		if t.ArtifactRegistry != nil {
+			target.ArtifactRegistry = *t.ArtifactRegistry
+			if !target.regionSet {
+				target.Region = defaultRegion(target.ArtifactRegistry)
+			}
+		}
+		if t.Project != "" {
+			target.Project = t.Project
+		}
+		if t.Repository != "" {
+			target.Repository = t.Repository
+		}
+		if len(t.Regions) > 0 {
+			target.MultiRegionEnabled = true
+			target.MultiRegionRegions = t.Regions
+		} else if t.Region != "" {
+			target.Region = t.Region
+			target.regionSet = true
+			target.MultiRegionEnabled = false
+		}
+		if t.Only != nil {
+			target.Only = t.Only
+		}
+		if t.Except != nil {
+			target.Except = t.Except
+		}
+		if t.Auth != nil {
+			target.AuthMethod = t.Auth.Method
+			target.KeyFile = t.Auth.KeyFile
+			target.KeyJSON = t.Auth.KeyJSON
+			target.AccessToken = t.Auth.AccessToken
+			target.AccessTokenFile = t.Auth.AccessTokenFile
+			target.TokenLogin = false
+		}
+		if t.KeyWarnAgeDays != nil {
+			target.KeyWarnAgeDays = *t.KeyWarnAgeDays
+		}
+		if t.KeyMaxAgeDays != nil {
+			target.KeyMaxAgeDays = *t.KeyMaxAgeDays
+		}
+
+		configs = append(configs, &target)
+	}
+	return configs
+}
+
+// fieldPrefix returns the prefix of validation fields for the target.
+func (c *Config) fieldPrefix() string {
+	if c.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("targets[%d].", c.index)
+}
+
+// outputLabel returns the prefix of messages about the target.
+func (c *Config) outputLabel() string {
+	if c.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("Target %s: ", c.Name)
+}
+
+// validateTargets checks every target and that target names are unique.
+func (p *GCRPlugin) validateTargets(vb *helpers.ValidationBuilder, cfg *Config, redactor *Redactor) {
+	seen := make(map[string]int)
+	for i, target := range cfg.targets() {
+		prefix := target.fieldPrefix()
+
+		if first, ok := seen[target.Name]; ok {
+			vb.AddError(prefix+"name", fmt.Sprintf("target name '%s' is already used by targets[%d]", target.Name, first))
+		} else {
+			seen[target.Name] = i
+		}
+
+		p.validateTarget(vb, target, prefix, redactor)
+
+		// Thresholds the target sets itself must be consistent
+		t := cfg.Targets[i]
+		if (t.KeyWarnAgeDays != nil || t.KeyMaxAgeDays != nil) &&
+			target.KeyWarnAgeDays > 0 && target.KeyMaxAgeDays > 0 && target.KeyWarnAgeDays >= target.KeyMaxAgeDays {
+			vb.AddError(prefix+"auth.key_warn_age_days", "key_warn_age_days must be less than key_max_age_days")
+		}
+	}
+}
+
+// targetSecrets returns the inline secrets of every target's credentials.
+func (c *Config) targetSecrets() []string {
+	var secrets []string
+	for _, target := range c.Targets {
+		if target.Auth != nil {
+			secrets = append(secrets, target.Auth.KeyJSON, target.Auth.AccessToken)
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+func TestConfigTargets(t *testing.T) {
+	p := &GCRPlugin{}
+	cfg := p.parseConfig(map[string]any{
+		"project":    "prod-project",
+		"repository": "prod-repo",
+		"region":     "us-central1",
+		"image":      "my-app",
+		"auth": map[string]any{
+			"method":       "access_token",
+			"access_token": "prod-token",
+		},
+		"targets": []any{
+			map[string]any{"name": "prod"},
+			map[string]any{
+				"name":       "partner",
+				"project":    "partner-project",
+				"repository": "shared",
+				"regions":    []any{"us-east1", "europe-west1"},
+				"auth":       map[string]any{"method": "access_token", "access_token": "partner-token"},
+			},
+			map[string]any{
+				"artifact_registry": false,
+				"region":            "eu",
+			},
+		},
+	})
+
+	targets := cfg.targets()
+	if len(targets) != 3 {
+		t.Fatalf("expected 3 targets, got %d", len(targets))
+	}
+
+	prod, partner, legacy := targets[0], targets[1], targets[2]
+
+	if prod.Name != "prod" || prod.Project != "prod-project" || prod.AccessToken != "prod-token" {
+		t.Errorf("expected prod to inherit top-level settings, got %+v", prod)
+	}
+
+	if partner.Project != "partner-project" || partner.Repository != "shared" {
+		t.Errorf("expected partner overrides, got project '%s' repository '%s'", partner.Project, partner.Repository)
+	}
+	if !reflect.DeepEqual(partner.regions(), []string{"us-east1", "europe-west1"}) {
+		t.Errorf("expected partner regions, got %v", partner.regions())
+	}
+	if partner.AccessToken != "partner-token" {
+		t.Errorf("expected partner credentials, got '%s'", partner.AccessToken)
+	}
+
+	if legacy.Name != "target-3" {
+		t.Errorf("expected default name 'target-3', got '%s'", legacy.Name)
+	}
+	if legacy.ArtifactRegistry || legacy.Region != "eu" {
+		t.Errorf("expected legacy GCR in eu, got artifact_registry=%v region=%s", legacy.ArtifactRegistry, legacy.Region)
+	}
+
+	// The top-level configuration is not modified.
+	if cfg.Project != "prod-project" || cfg.AccessToken != "prod-token" {
+		t.Errorf("expected top-level configuration to be unchanged, got %+v", cfg)
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     map[string]any
+		wantFields []string
+	}{
+		{
+			name: "valid targets",
+			config: map[string]any{
+				"project":    "prod-project",
+				"repository": "prod-repo",
+				"targets": []any{
+					map[string]any{"name": "prod"},
+					map[string]any{"name": "legacy", "artifact_registry": false, "region": "us"},
+				},
+			},
+		},
+		{
+			name: "project only on targets",
+			config: map[string]any{
+				"repository": "prod-repo",
+				"targets": []any{
+					map[string]any{"name": "prod", "project": "prod-project"},
+					map[string]any{"name": "partner"},
+				},
+			},
+			wantFields: []string{"targets[1].project"},
+		},
+		{
+			name: "duplicate names and bad auth",
+			config: map[string]any{
+				"project":    "prod-project",
+				"repository": "prod-repo",
+				"targets": []any{
+					map[string]any{"name": "prod"},
+					map[string]any{"name": "prod", "auth": map[string]any{"method": "access_token"}},
+				},
+			},
+			wantFields: []string{"targets[1].name", "targets[1].auth"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config["image"] = "my-app"
+			tt.config["source_image"] = "myapp:latest"
+
+			p := &GCRPlugin{}
+			resp, err := p.Validate(context.Background(), tt.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var fields []string
+			for _, e := range resp.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("expected errors on %v, got %v", tt.wantFields, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestExecuteMultipleTargets(t *testing.T) {
+	logPath := installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook: plugin.HookPostPublish,
+		Config: map[string]any{
+			"project":      "prod-project",
+			"repository":   "prod-repo",
+			"region":       "us",
+			"image":        "my-app",
+			"source_image": "myapp:latest",
+			"auth": map[string]any{
+				"method":       "access_token",
+				"access_token": "good-token",
+			},
+			"endpoints": api.EndpointsConfig(),
+			"targets": []any{
+				map[string]any{"name": "prod"},
+				map[string]any{
+					"name":    "partner",
+					"project": "partner-project",
+					"auth":    map[string]any{"method": "access_token", "access_token": "sa-token"},
+				},
+				map[string]any{
+					"name":              "legacy",
+					"artifact_registry": false,
+					"auth":              map[string]any{"method": "gcloud"},
+				},
+			},
+		},
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"us-docker.pkg.dev/prod-project/prod-repo/my-app:1.2.3",
+		"us-docker.pkg.dev/partner-project/prod-repo/my-app:1.2.3",
+		"gcr.io/prod-project/my-app:1.2.3",
+	}
+	if pushed := resp.Outputs["pushed_images"]; !reflect.DeepEqual(pushed, expected) {
+		t.Errorf("expected pushed images %v, got %v", expected, pushed)
+	}
+
+	targets, ok := resp.Outputs["targets"].([]map[string]any)
+	if !ok || len(targets) != 3 {
+		t.Fatalf("expected three target results, got %v", resp.Outputs["targets"])
+	}
+	for i, name := range []string{"prod", "partner", "legacy"} {
+		if targets[i]["name"] != name {
+			t.Errorf("expected target %d to be '%s', got %v", i, name, targets[i]["name"])
+		}
+		if !reflect.DeepEqual(targets[i]["pushed_images"], expected[i:i+1]) {
+			t.Errorf("expected target '%s' to push %v, got %v", name, expected[i:i+1], targets[i]["pushed_images"])
+		}
+	}
+
+	// Both Artifact Registry targets use the same host with different
+	// credentials, so each pushes with its own Docker config.
+	configs := make(map[string]string)
+	for _, line := range readFakeCommandLog(t, logPath) {
+		if !strings.HasPrefix(line, "docker push ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		configs[fields[2]] = strings.TrimPrefix(fields[3], "DOCKER_CONFIG=")
+	}
+	if len(configs) != 3 {
+		t.Fatalf("expected three pushes, got %v", configs)
+	}
+	if configs[expected[0]] == configs[expected[1]] {
+		t.Errorf("expected separate Docker configs per target, got %v", configs)
+	}
+}
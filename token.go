@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultTokenInfoEndpoint is the Google OAuth2 token introspection endpoint.
+	defaultTokenInfoEndpoint = "https://oauth2.googleapis.com/tokeninfo"
+
+	// accessTokenUsername is the registry username used with OAuth2 access tokens.
+	accessTokenUsername = "oauth2accesstoken"
+
+	// minAccessTokenLifetime is the minimum remaining lifetime required to start pushing.
+	minAccessTokenLifetime = 5 * time.Minute
+)
+
+// errInvalidAccessToken is returned when the token info endpoint rejects a token.
+var errInvalidAccessToken = errors.New("access token is invalid or expired")
+
+// TokenInfo holds the details reported by the token info endpoint.
+type TokenInfo struct {
+	Email     string
+	Scope     string
+	ExpiresIn time.Duration
+}
+
+// readAccessToken returns the configured access token, reading it from file if needed.
+func readAccessToken(auth *AuthConfig) (string, error) {
+	if auth.AccessToken != "" {
+		return strings.TrimSpace(auth.AccessToken), nil
+	}
+
+	if auth.AccessTokenFile != "" {
+		data, err := os.ReadFile(auth.AccessTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read access token file: %w", err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("access token file %s is empty", auth.AccessTokenFile)
+		}
+		return token, nil
+	}
+
+	return "", fmt.Errorf("access token not provided")
+}
+
+// lookupTokenInfo queries the token info endpoint for the given access token.
+func lookupTokenInfo(ctx context.Context, client *http.Client, endpoint, token string) (*TokenInfo, error) {
+	form := url.Values{"access_token": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token info request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token info request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return nil, errInvalidAccessToken
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token info request returned %s", resp.Status)
+	}
+
+	// The endpoint reports numbers as strings.
+	var body struct {
+		Email     string `json:"email"`
+		Scope     string `json:"scope"`
+		ExpiresIn string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode token info: %w", err)
+	}
+
+	seconds, err := strconv.Atoi(body.ExpiresIn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expires_in in token info: %q", body.ExpiresIn)
+	}
+
+	return &TokenInfo{
+		Email:     body.Email,
+		Scope:     body.Scope,
+		ExpiresIn: time.Duration(seconds) * time.Second,
+	}, nil
+}
+
+// tokenLifetimeError is returned, along with the token info, for a valid
+// token that has less than minAccessTokenLifetime left.
+type tokenLifetimeError struct {
+	expiresIn time.Duration
+}
+
+func (e *tokenLifetimeError) Error() string {
+	return fmt.Sprintf("access token expires in %s, need at least %s", e.expiresIn, minAccessTokenLifetime)
+}
+
+// checkAccessToken verifies that the token is valid and will not expire mid-push.
+// Tokens that cannot be looked up (e.g. no network access to the endpoint) are
+// accepted, in which case the returned info is nil.
+func checkAccessToken(ctx context.Context, client *http.Client, endpoint, token string) (*TokenInfo, error) {
+	info, err := lookupTokenInfo(ctx, client, endpoint, token)
+	if errors.Is(err, errInvalidAccessToken) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, nil
+	}
+
+	if info.ExpiresIn < minAccessTokenLifetime {
+		return info, &tokenLifetimeError{expiresIn: info.ExpiresIn}
+	}
+
+	return info, nil
+}
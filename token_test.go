@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTokenInfoServer(t *testing.T, expiresIn string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		if r.Form.Get("access_token") != "good-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": "invalid_token"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"email":      "ci@my-project.iam.gserviceaccount.com",
+			"scope":      "https://www.googleapis.com/auth/cloud-platform",
+			"expires_in": expiresIn,
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestReadAccessToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		auth     *AuthConfig
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "inline token",
+			auth:     &AuthConfig{AccessToken: " inline-token "},
+			expected: "inline-token",
+		},
+		{
+			name:     "inline token wins over file",
+			auth:     &AuthConfig{AccessToken: "inline-token", AccessTokenFile: tokenFile},
+			expected: "inline-token",
+		},
+		{
+			name:     "token file",
+			auth:     &AuthConfig{AccessTokenFile: tokenFile},
+			expected: "file-token",
+		},
+		{
+			name:    "empty token file",
+			auth:    &AuthConfig{AccessTokenFile: emptyFile},
+			wantErr: true,
+		},
+		{
+			name:    "missing token file",
+			auth:    &AuthConfig{AccessTokenFile: filepath.Join(dir, "missing")},
+			wantErr: true,
+		},
+		{
+			name:    "no token",
+			auth:    &AuthConfig{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := readAccessToken(tt.auth)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got token '%s'", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if token != tt.expected {
+				t.Errorf("expected '%s', got '%s'", tt.expected, token)
+			}
+		})
+	}
+}
+
+func TestLookupTokenInfo(t *testing.T) {
+	server := newTokenInfoServer(t, "3599")
+
+	info, err := lookupTokenInfo(context.Background(), server.Client(), server.URL, "good-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.ExpiresIn != 3599*time.Second {
+		t.Errorf("expected expiry 3599s, got %s", info.ExpiresIn)
+	}
+	if info.Email != "ci@my-project.iam.gserviceaccount.com" {
+		t.Errorf("unexpected email '%s'", info.Email)
+	}
+
+	_, err = lookupTokenInfo(context.Background(), server.Client(), server.URL, "bad-token")
+	if !errors.Is(err, errInvalidAccessToken) {
+		t.Errorf("expected errInvalidAccessToken, got %v", err)
+	}
+}
+
+func TestCheckAccessToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn string
+		token     string
+		wantErr   bool
+	}{
+		{name: "valid token", expiresIn: "3599", token: "good-token"},
+		{name: "token about to expire", expiresIn: "30", token: "good-token", wantErr: true},
+		{name: "rejected token", expiresIn: "3599", token: "bad-token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTokenInfoServer(t, tt.expiresIn)
+			_, err := checkAccessToken(context.Background(), server.Client(), server.URL, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("unreachable endpoint is tolerated", func(t *testing.T) {
+		server := newTokenInfoServer(t, "3599")
+		server.Close()
+		info, err := checkAccessToken(context.Background(), http.DefaultClient, server.URL, "good-token")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if info != nil {
+			t.Errorf("expected unknown token info, got %+v", info)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// snapshotTags records the current digest of every tag a target is about to
+// move, before the first push.
+func (p *GCRPlugin) snapshotTags(ctx context.Context, req plugin.ExecuteRequest, cfg *Config, dockerConfig string, credentials *CredentialManager, record *pushRecord) error {
+	for _, image := range cfg.images() {
+		for _, region := range cfg.regions() {
+			config := cfg.gcrConfig(region, dockerConfig, credentials)
+			config.Repository = image.Repository
+			client := NewGCRClient(config)
+
+			for _, tag := range p.processTags(image.Tags, &req.Context) {
+				if tag == "" {
+					continue
+				}
+				if _, err := record.track(ctx, client, cfg, region, image, tag); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rollback reverts every tag a failed transactional run moved. The push
+// error is returned with the rollback result, and the response carries the
+// rollback report.
+func (p *GCRPlugin) rollback(ctx context.Context, cfg *Config, record *pushRecord, pushErr error, redactor *Redactor) (*plugin.ExecuteResponse, error) {
+	redactor.Printf("Push failed; rolling back %d tag(s)\n", len(record.Entries))
+
+	report, err := p.revertRecord(ctx, cfg, record, redactor)
+	if err != nil {
+		err = fmt.Errorf("%w; rollback incomplete: %v", pushErr, err)
+		return &plugin.ExecuteResponse{
+			Success: false,
+			Message: "Push failed and rollback is incomplete",
+			Error:   err.Error(),
+			Outputs: map[string]any{"rolled_back": false, "rollback": report},
+		}, err
+	}
+
+	// Nothing is left for on_error to clean up
+	if err := record.remove(); err != nil {
+		return nil, err
+	}
+
+	err = fmt.Errorf("%w; rolled back %d tag(s)", pushErr, len(report))
+	return &plugin.ExecuteResponse{
+		Success: false,
+		Message: fmt.Sprintf("Push failed; rolled back %d tag(s)", len(report)),
+		Error:   err.Error(),
+		Outputs: map[string]any{"rolled_back": true, "rollback": report},
+	}, err
+}
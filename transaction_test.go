@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/relicta-tech/relicta-plugin-sdk/plugin"
+)
+
+// transactionConfig returns a legacy GCR configuration that promotes my-app
+// to two projects, the second of which has nothing staged.
+func transactionConfig(api *fakeGoogleAPI, registry *fakeRegistry) map[string]any {
+	config := cleanupConfig(api, registry, "")
+	delete(config, "cleanup")
+	config["transactional"] = true
+	config["targets"] = []any{
+		map[string]any{"name": "primary"},
+		map[string]any{"name": "mirror", "project": "other-project"},
+	}
+	return config
+}
+
+func TestTransactionalPushRollsBack(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+
+	previous := registry.SeedImage("my-project/my-app", "latest", "old layer")
+	registry.SeedImage("my-project/my-app", "relicta-staging-1.2.3", "new layer")
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook:    plugin.HookPostPublish,
+		Config:  transactionConfig(api, registry),
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "target mirror: staged image") || !strings.Contains(err.Error(), "rolled back 4 tag(s)") {
+		t.Fatalf("expected the mirror failure with the rollback result, got %v", err)
+	}
+	if resp == nil || resp.Success || resp.Error != err.Error() {
+		t.Fatalf("expected a failed response with the rollback report, got %+v", resp)
+	}
+	if resp.Outputs["rolled_back"] != true {
+		t.Errorf("expected rolled_back, got %v", resp.Outputs)
+	}
+
+	if got := registry.Digest("my-project/my-app", "latest"); got != previous {
+		t.Errorf("expected latest to be restored to %s, got '%s'", previous, got)
+	}
+	if got := registry.Digest("my-project/my-app", "1.2.3"); got != "" {
+		t.Errorf("expected 1.2.3 to be deleted, got '%s'", got)
+	}
+
+	var actions []string
+	for _, entry := range resp.Outputs["rollback"].([]map[string]any) {
+		actions = append(actions, entry["action"].(string))
+	}
+	want := []string{"unchanged", "unchanged", "restored", "deleted"}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("expected rollback actions %v, got %v", want, actions)
+	}
+}
+
+func TestTransactionalPushSucceeds(t *testing.T) {
+	installFakeCommands(t)
+	api := newFakeGoogleAPI(t)
+	registry := newFakeRegistry(t)
+
+	digest := registry.SeedImage("my-project/my-app", "relicta-staging-1.2.3", "new layer")
+	registry.SeedImage("other-project/my-app", "relicta-staging-1.2.3", "new layer")
+
+	p := &GCRPlugin{}
+	resp, err := p.Execute(context.Background(), plugin.ExecuteRequest{
+		Hook:    plugin.HookPostPublish,
+		Config:  transactionConfig(api, registry),
+		Context: plugin.ReleaseContext{Version: "1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Success {
+		t.Fatalf("expected success, got %+v", resp)
+	}
+	if _, ok := resp.Outputs["rollback"]; ok {
+		t.Errorf("expected no rollback, got %v", resp.Outputs["rollback"])
+	}
+	for _, repository := range []string{"my-project/my-app", "other-project/my-app"} {
+		if got := registry.Digest(repository, "latest"); got != digest {
+			t.Errorf("expected %s:latest at %s, got '%s'", repository, digest, got)
+		}
+	}
+}